@@ -0,0 +1,169 @@
+// Package admin serves the operational endpoints of the process: the metrics and the health probes.
+package admin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"common/metrics"
+	mdl "common/model"
+	cmpt "common/model/component"
+)
+
+const (
+	DefaultAddr = ":9090"
+
+	MetricsPath = "/metrics"
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+
+	// the time the in-flight requests have to complete when the Server stops
+	defaultShutdownTimeout = 5 * time.Second
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ cmpt.Cpt          = (*Server)(nil)
+	_ mdl.WorkerRecover = (*Server)(nil)
+)
+
+// Server is the component serving the admin HTTP endpoints: the metrics of a Registry
+// on MetricsPath, the liveness and readiness of a HealthAggregator on HealthzPath and ReadyzPath,
+// and the handlers added with Handle.
+type Server struct {
+	*cmpt.CptMetaSt
+	addr string
+	mux  *http.ServeMux
+
+	mu     *sync.Mutex // guards reg health ln srv
+	reg    *metrics.Registry
+	health *cmpt.HealthAggregator
+	ln     net.Listener
+	srv    *http.Server
+}
+
+// NewServer returns the Server listening on addr, DefaultAddr if empty, and serving metrics.Default.
+// Accepted type of v as NewCptMetaSt, e.g. *mdl.CtrlSt.
+func NewServer(addr string, v ...any) *Server {
+	if len(addr) == 0 {
+		addr = DefaultAddr
+	}
+	s := &Server{
+		addr: addr,
+		mux:  http.NewServeMux(),
+		mu:   &sync.Mutex{},
+		reg:  metrics.Default,
+	}
+	s.mux.Handle(MetricsPath, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		reg := s.reg
+		s.mu.Unlock()
+		reg.Handler().ServeHTTP(rw, r)
+	}))
+	s.mux.Handle(HealthzPath, s.probe((*cmpt.HealthAggregator).Liveness))
+	s.mux.Handle(ReadyzPath, s.probe((*cmpt.HealthAggregator).Readiness))
+	v = append([]any{cmpt.KindName("admin"), cmpt.IdName("server")}, v...)
+	s.CptMetaSt = cmpt.NewCptMetaSt(append(v, mdl.WorkerRecover(s))...)
+	return s
+}
+
+// WithRegistry serves the metrics of reg instead of metrics.Default.
+func (s *Server) WithRegistry(reg *metrics.Registry) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reg = reg
+	return s
+}
+
+// WithHealth serves the probes of ha, without it they only tell that the process answers.
+func (s *Server) WithHealth(ha *cmpt.HealthAggregator) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = ha
+	return s
+}
+
+// probe serves the HealthReport of the probe as JSON, with the status 503 when it fails.
+func (s *Server) probe(p func(*cmpt.HealthAggregator, context.Context) cmpt.HealthReport) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ha := s.health
+		s.mu.Unlock()
+		rp := cmpt.HealthReport{Status: cmpt.HealthUp, OK: true}
+		if ha != nil {
+			rp = p(ha, r.Context())
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		if !rp.OK {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = mdl.Json.NewEncoder(rw).Encode(rp)
+	})
+}
+
+// Handle adds the handler h for pattern, see http.ServeMux.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Addr returns the address the Server listens on once started, the configured one before.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln != nil {
+		return s.ln.Addr().String()
+	}
+	return s.addr
+}
+
+// Start listens on the address, so that an address in use fails Start, and starts serving.
+func (s *Server) Start() error {
+	if s.IsRunning() {
+		return s.CptMetaSt.Start()
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.srv = &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	s.mu.Unlock()
+	if err = s.CptMetaSt.Start(); err != nil {
+		ln.Close()
+	}
+	return err
+}
+
+// Work serves until the Server is stopped, then waits for the in-flight requests.
+func (s *Server) Work() error {
+	s.mu.Lock()
+	ln, srv := s.ln, s.srv
+	s.mu.Unlock()
+	ctx := s.Ctrl().Context()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-errc:
+		s.Log().Error("admin server failed", "addr", ln.Addr().String(), "err", err)
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		s.Log().Warn("admin server shutdown", "err", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
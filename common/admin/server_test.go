@@ -0,0 +1,97 @@
+package admin_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"common/admin"
+	"common/metrics"
+	cmpt "common/model/component"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("requests_total", "").Add(7)
+
+	s := admin.NewServer("127.0.0.1:0").WithRegistry(reg)
+	s.Handle("/ping", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "pong")
+	}))
+	require.NoError(t, s.Start())
+	base := "http://" + s.Addr()
+
+	code, body := get(t, base+admin.MetricsPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "# TYPE requests_total counter\nrequests_total 7\n", body)
+	code, body = get(t, base+"/ping")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pong", body)
+
+	// the address is in use
+	assert.Error(t, admin.NewServer(s.Addr()).Start())
+
+	require.NoError(t, s.Stop())
+	require.NoError(t, s.Finalize())
+	_, err := http.Get(base + "/ping")
+	assert.Error(t, err)
+}
+
+// link is a component whose health is set by the test.
+type link struct {
+	*cmpt.CptMetaSt
+	status cmpt.Health
+}
+
+func (l *link) Check(ctx context.Context) cmpt.HealthStatus {
+	return cmpt.HealthStatus{Status: l.status, Details: map[string]any{"peer": "10.0.0.2"}}
+}
+
+func TestServerHealth(t *testing.T) {
+	s := admin.NewServer("127.0.0.1:0")
+	require.NoError(t, s.Start())
+	base := "http://" + s.Addr()
+
+	// without an aggregator the probes tell the process answers
+	code, body := get(t, base+admin.HealthzPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"up","ok":true,"components":null}`, body)
+
+	l := &link{status: cmpt.HealthUp}
+	l.CptMetaSt = cmpt.NewCptMetaSt(cmpt.KindName("link"), cmpt.IdName("uplink"), l)
+	ha := cmpt.NewHealthAggregator()
+	ha.AddCritical(l)
+	s.WithHealth(ha)
+
+	code, _ = get(t, base+admin.ReadyzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.NoError(t, l.Start())
+	code, body = get(t, base+admin.ReadyzPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"kind":"link","id":"uplink","critical":true,"running":true`)
+	assert.Contains(t, body, `"details":{"peer":"10.0.0.2"}`)
+
+	l.status = cmpt.HealthDown
+	code, body = get(t, base+admin.HealthzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, `"status":"down","ok":false`)
+
+	require.NoError(t, l.Stop())
+	require.NoError(t, l.Finalize())
+	require.NoError(t, s.Stop())
+	require.NoError(t, s.Finalize())
+}
@@ -0,0 +1,452 @@
+// Package app runs the components of a process from start to exit: it starts them, waits for
+// a signal or a Shutdown, stops and finalizes them within a deadline and maps the errors to the exit code.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+	"sync"
+	"syscall"
+	"time"
+
+	"common/log"
+	mdl "common/model"
+	cmpt "common/model/component"
+	"common/trace"
+)
+
+// the exit codes of Run, an error implementing ExitCoder gives its own
+const (
+	ExitOK              = 0
+	ExitFailure         = 1 // a component failed to stop or finalize, or Shutdown was given an error
+	ExitStartFailed     = 3
+	ExitShutdownTimeout = 4 // the components didn't stop within the deadline, or a second signal forced the exit
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	// the interval the readiness is checked at until READY=1 is sent
+	defaultReadyInterval = time.Second
+)
+
+var (
+	// ErrShutdownTimeout is returned by Err when the components didn't stop within the deadline.
+	ErrShutdownTimeout = errors.New("app: shutdown deadline exceeded")
+	// ErrForcedExit is returned by Err when a second signal interrupted the shutdown.
+	ErrForcedExit = errors.New("app: forced exit")
+)
+
+// ExitCoder is implemented by the errors choosing the exit code of the process.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode returns the exit code of err: ExitOK if nil, the code of the first ExitCoder in its tree,
+// or def.
+func ExitCode(err error, def int) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	return def
+}
+
+// exitError is an error with its exit code.
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+func (e *exitError) ExitCode() int { return e.code }
+
+// WithExitCode returns err exiting the process with code.
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{err: err, code: code}
+}
+
+// Reloader reloads the configuration on SIGHUP, e.g. *config.Watcher.
+type Reloader interface {
+	Reload() error
+}
+
+// App owns the root CtrlSt of the process and the components it runs.
+//
+//	a := app.New("gateway")
+//	a.Add(sensor.New(a.Ctrl().ForkCtxWg()), admin.NewServer("", a.Ctrl().ForkCtxWg()))
+//	a.Main()
+type App struct {
+	name  string
+	ctrl  *mdl.CtrlSt
+	ready chan struct{}
+	quit  chan struct{} // 第一次Shutdown时关闭 根CtrlSt在组件停止后才取消
+
+	mu              *sync.Mutex // guards cpts reloaders health sd shutdownTimeout dump cause err quit
+	cpts            cmpt.Cpts
+	reloaders       []Reloader
+	health          *cmpt.HealthAggregator
+	sd              *SdNotifier
+	shutdownTimeout time.Duration
+	dump            io.Writer
+	cause           error // 通过Shutdown传入的停止原因
+	err             error
+}
+
+// New returns the App name with a root CtrlSt on context.Background.
+func New(name string) *App {
+	return &App{
+		name:            name,
+		ctrl:            mdl.NewCtrlSt(context.Background()),
+		ready:           make(chan struct{}),
+		quit:            make(chan struct{}),
+		mu:              &sync.Mutex{},
+		cpts:            cmpt.NewCpts(),
+		sd:              NewSdNotifier(),
+		shutdownTimeout: defaultShutdownTimeout,
+		dump:            os.Stderr,
+	}
+}
+
+// Name returns the name of the App.
+func (a *App) Name() string {
+	return a.name
+}
+
+// Ctrl returns the root CtrlSt, cancelled once the components are stopped when the App shuts down.
+// The components fork it to be cancelled with the process.
+func (a *App) Ctrl() *mdl.CtrlSt {
+	return a.ctrl
+}
+
+// Add adds the components started by Run in the order they are added, and stopped in the reverse
+// order, each stopped and cancelled before the previous one is stopped. The components depended on
+// are added first, so that the servers and the consumers stop before them. They are finalized once
+// the root CtrlSt is cancelled, since those forked from it share its WorkerWG.
+func (a *App) Add(cps ...cmpt.Cpt) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cpts.AddCpts(cps...)
+	return a
+}
+
+// Cpts returns the components of the App.
+func (a *App) Cpts() cmpt.Cpts {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return cmpt.NewCpts(a.cpts...)
+}
+
+// WithShutdownTimeout sets the time the components have to stop and finalize, 30s by default.
+func (a *App) WithShutdownTimeout(d time.Duration) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d > 0 {
+		a.shutdownTimeout = d
+	}
+	return a
+}
+
+// WithReloader adds the reloaders called on SIGHUP.
+func (a *App) WithReloader(rs ...Reloader) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reloaders = append(a.reloaders, rs...)
+	return a
+}
+
+// WithHealth gates the notifications to systemd on ha: READY=1 once the components are ready,
+// and WATCHDOG=1 while they are alive.
+func (a *App) WithHealth(ha *cmpt.HealthAggregator) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.health = ha
+	return a
+}
+
+// WithSdNotifier notifies n instead of the service manager of the environment.
+func (a *App) WithSdNotifier(n *SdNotifier) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sd = n
+	return a
+}
+
+// WithDumpWriter writes the goroutine dumps of SIGQUIT to w, os.Stderr by default.
+func (a *App) WithDumpWriter(w io.Writer) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dump = w
+	return a
+}
+
+// Ready is closed once the components are started.
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// Shutdown makes Run stop the components, cause is the reason the process exits, nil for a normal exit.
+// Only the first cause is kept.
+func (a *App) Shutdown(cause error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.quit:
+		return
+	default:
+	}
+	a.cause = cause
+	// 不取消根CtrlSt 否则从它派生的组件会同时被取消 由stop按相反的顺序逐个停止和取消
+	close(a.quit)
+}
+
+// Err returns the error Run exited with.
+func (a *App) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Main runs the App and exits the process with the exit code of Run.
+func (a *App) Main() {
+	os.Exit(a.Run())
+}
+
+// Run starts the components and waits for SIGINT, SIGTERM or Shutdown, reloading the configuration
+// on SIGHUP and dumping the goroutines on SIGQUIT. It then stops and finalizes the components
+// within the shutdown deadline, flushes the traces, closes the loggers and returns the exit code.
+// A second SIGINT or SIGTERM during the shutdown returns at once.
+//
+// Under systemd, it sends READY=1 once the components are started and ready, WATCHDOG=1 while they
+// are alive, every half of the watchdog timeout once ready, and STOPPING=1 when the shutdown begins.
+func (a *App) Run() (code int) {
+	defer func() {
+		_ = trace.Default().Shutdown()
+		// 关闭log.New和log.Zap创建的日志 刷新异步缓冲并关闭文件和远程输出的连接
+		_ = log.CloseLoggers()
+		// 标准错误输出Sync会返回EINVAL 忽略
+		if zl, ok := mdl.ZapOf(mdl.Log()); ok {
+			_ = zl.Sync()
+		}
+		_ = mdl.Zap().Sync()
+	}()
+
+	sigc := make(chan os.Signal, 4)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigc)
+
+	cps := a.Cpts()
+	lg := mdl.Log().With("app", a.name)
+	lg.Info("app starting", "components", cps.Len())
+	wg := &sync.WaitGroup{}
+	if err := cps.Start(); err != nil {
+		lg.Error("app start failed", "err", err)
+		a.Shutdown(WithExitCode(fmt.Errorf("app %s start: %w", a.name, err), ExitCode(err, ExitStartFailed)))
+	} else {
+		close(a.ready)
+		lg.Info("app started")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.notify(lg)
+		}()
+	}
+
+	a.wait(sigc, lg)
+	code = a.stop(cps, sigc, lg)
+	wg.Wait()
+	return code
+}
+
+// notify sends READY=1 once the components are ready, then WATCHDOG=1 while they are alive,
+// until the App shuts down. The readiness is checked every defaultReadyInterval,
+// or every half of the watchdog timeout if shorter, the pings are sent every half of it once ready.
+func (a *App) notify(lg mdl.Logger) {
+	a.mu.Lock()
+	ha, sd := a.health, a.sd
+	a.mu.Unlock()
+	if !sd.Enabled() {
+		return
+	}
+	wd := sd.Watchdog()
+
+	ctx := a.ctrl.Context()
+	interval := defaultReadyInterval
+	if wd > 0 {
+		interval = min(interval, wd/2)
+	}
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	ready := false
+	for {
+		if !ready && (ha == nil || ha.Readiness(ctx).OK) && ctx.Err() == nil {
+			ready = true
+			if err := sd.Notify(SdReady, "STATUS=ready"); err != nil {
+				lg.Warn("app sd_notify failed", "state", SdReady, "err", err)
+			}
+			// 就绪后只需每半个看门狗超时发送一次
+			if wd > 0 {
+				tk.Reset(wd / 2)
+			}
+		}
+		if wd > 0 {
+			// 存活检查失败时不发送WATCHDOG=1 由systemd在超时后重启进程
+			if rp := a.liveness(ctx, ha); rp.OK && ctx.Err() == nil {
+				if err := sd.Notify(SdWatchdog); err != nil {
+					lg.Warn("app sd_notify failed", "state", SdWatchdog, "err", err)
+				}
+			} else if ctx.Err() == nil {
+				lg.Warn("app not alive, watchdog not pinged", "status", rp.Status)
+			}
+		} else if ready {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.quit:
+			return
+		case <-tk.C:
+		}
+	}
+}
+
+func (a *App) liveness(ctx context.Context, ha *cmpt.HealthAggregator) cmpt.HealthReport {
+	if ha == nil {
+		return cmpt.HealthReport{Status: cmpt.HealthUp, OK: true}
+	}
+	return ha.Liveness(ctx)
+}
+
+// wait handles the signals until Shutdown.
+func (a *App) wait(sigc <-chan os.Signal, lg mdl.Logger) {
+	for {
+		select {
+		case <-a.quit:
+			return
+		case sig := <-sigc:
+			switch sig {
+			case syscall.SIGHUP:
+				a.reload(lg)
+			case syscall.SIGQUIT:
+				a.dumpGoroutines(lg)
+			default:
+				lg.Info("app signaled", "signal", sig.String())
+				a.Shutdown(nil)
+				return
+			}
+		}
+	}
+}
+
+func (a *App) reload(lg mdl.Logger) {
+	a.mu.Lock()
+	rs := append([]Reloader(nil), a.reloaders...)
+	a.mu.Unlock()
+	var err error
+	for _, r := range rs {
+		err = errors.Join(err, r.Reload())
+	}
+	if err != nil {
+		lg.Error("app reload failed", "err", err)
+		return
+	}
+	lg.Info("app reloaded", "reloaders", len(rs))
+}
+
+func (a *App) dumpGoroutines(lg mdl.Logger) {
+	a.mu.Lock()
+	w := a.dump
+	a.mu.Unlock()
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		lg.Error("app goroutine dump failed", "err", err)
+	}
+}
+
+// stop stops and cancels cps one by one in the reverse order, then cancels the root CtrlSt and
+// finalizes them in the reverse order within the deadline, and returns the exit code.
+func (a *App) stop(cps cmpt.Cpts, sigc <-chan os.Signal, lg mdl.Logger) int {
+	a.mu.Lock()
+	timeout, cause, sd := a.shutdownTimeout, a.cause, a.sd
+	a.mu.Unlock()
+	lg.Info("app stopping", "timeout", timeout)
+	if err := sd.Notify(SdStopping); err != nil {
+		lg.Warn("app sd_notify failed", "state", SdStopping, "err", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := len(cps) - 1; i >= 0; i-- {
+			cp := cps[i]
+			if cp == nil {
+				continue
+			}
+			if cp.IsRunning() {
+				err = errors.Join(err, cp.Stop())
+			}
+			// 未启动的组件也要取消 否则Finalize会一直等待
+			cp.Ctrl().Cancel()
+		}
+		// 从根CtrlSt派生的组件共用它的WorkerWG 都取消后才能逐个Finalize
+		a.ctrl.Cancel()
+		for i := len(cps) - 1; i >= 0; i-- {
+			if cr, ok := cps[i].(cmpt.CptRoot); ok {
+				err = errors.Join(err, cr.Finalize())
+			}
+		}
+		done <- err
+	}()
+
+	tm := mdl.TimerPool.Get(timeout)
+	defer mdl.TimerPool.Put(tm)
+	var err error
+	code := ExitCode(cause, ExitFailure)
+wait:
+	for {
+		select {
+		case serr := <-done:
+			err = errors.Join(cause, serr)
+			if serr != nil && code == ExitOK {
+				code = ExitCode(serr, ExitFailure)
+			}
+		case <-tm.C:
+			err = errors.Join(cause, ErrShutdownTimeout)
+			code = ExitShutdownTimeout
+		case sig := <-sigc:
+			if sig != syscall.SIGINT && sig != syscall.SIGTERM {
+				if sig == syscall.SIGQUIT {
+					a.dumpGoroutines(lg)
+				}
+				continue
+			}
+			err = errors.Join(cause, ErrForcedExit)
+			code = ExitShutdownTimeout
+		}
+		break wait
+	}
+	// 超时或强制退出时也取消未停止的组件
+	a.ctrl.Cancel()
+
+	a.mu.Lock()
+	a.err = err
+	a.mu.Unlock()
+	if err != nil {
+		lg.Error("app stopped", "code", code, "err", err)
+	} else {
+		lg.Info("app stopped")
+	}
+	return code
+}
@@ -0,0 +1,245 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"common/app"
+	"common/log"
+	mdl "common/model"
+	cmpt "common/model/component"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloader counts the reloads, failing when err is set.
+type reloader struct {
+	n   atomic.Int32
+	err error
+}
+
+func (r *reloader) Reload() error {
+	r.n.Add(1)
+	return r.err
+}
+
+// syncBuffer is a bytes.Buffer written by Run and read by the test.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.b.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.b.String()
+}
+
+// stuck is a component whose worker ignores the cancellation until released.
+type stuck struct {
+	*cmpt.CptMetaSt
+	release chan struct{}
+}
+
+func newStuck(ctrl *mdl.CtrlSt) *stuck {
+	s := &stuck{release: make(chan struct{})}
+	s.CptMetaSt = cmpt.NewCptMetaSt(cmpt.KindName("stuck"), cmpt.IdName("s1"), ctrl, mdl.WorkerRecover(s))
+	return s
+}
+
+func (s *stuck) Work() error {
+	<-s.release
+	return nil
+}
+
+// failing is a component failing to start.
+type failing struct {
+	*cmpt.CptMetaSt
+	err error
+}
+
+func (f *failing) Start() error {
+	return f.err
+}
+
+// ordered records the order its components stop in, and those cancelled before being stopped.
+type ordered struct {
+	*cmpt.CptMetaSt
+	stops *[]string
+}
+
+func (o *ordered) Stop() error {
+	id := string(o.Id())
+	if o.Ctrl().Context().Err() != nil {
+		id += " cancelled"
+	}
+	*o.stops = append(*o.stops, id)
+	return o.CptMetaSt.Stop()
+}
+
+func run(a *app.App) <-chan int {
+	codec := make(chan int, 1)
+	go func() { codec <- a.Run() }()
+	return codec
+}
+
+func TestRunSignals(t *testing.T) {
+	a := app.New("gw")
+	cp := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), a.Ctrl().ForkCtxWg())
+	ok, bad := &reloader{}, &reloader{err: errors.New("bad config")}
+	dump := &syncBuffer{}
+	a.Add(cp).WithReloader(ok, bad).WithDumpWriter(dump)
+
+	codec := run(a)
+	<-a.Ready()
+	assert.True(t, cp.IsRunning())
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return ok.n.Load() == 1 && bad.n.Load() == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGQUIT))
+	assert.Eventually(t, func() bool { return bytes.Contains([]byte(dump.String()), []byte("goroutine ")) }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case code := <-codec:
+		assert.Equal(t, app.ExitOK, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return on SIGTERM")
+	}
+	assert.NoError(t, a.Err())
+	assert.False(t, cp.IsRunning())
+	assert.Error(t, a.Ctrl().Context().Err())
+}
+
+func TestRunShutdown(t *testing.T) {
+	// a normal exit
+	a := app.New("gw")
+	cp := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), a.Ctrl().ForkCtxWg())
+	codec := run(a.Add(cp))
+	<-a.Ready()
+	a.Shutdown(nil)
+	assert.Equal(t, app.ExitOK, <-codec)
+	assert.False(t, cp.IsRunning())
+
+	// the cause gives the exit code
+	a = app.New("gw")
+	codec = run(a)
+	<-a.Ready()
+	a.Shutdown(errors.New("lost the broker"))
+	a.Shutdown(errors.New("ignored"))
+	assert.Equal(t, app.ExitFailure, <-codec)
+	assert.EqualError(t, a.Err(), "lost the broker")
+
+	a = app.New("gw")
+	codec = run(a)
+	<-a.Ready()
+	a.Shutdown(app.WithExitCode(errors.New("bad license"), 78))
+	assert.Equal(t, 78, <-codec)
+}
+
+func TestRunStartFailed(t *testing.T) {
+	a := app.New("gw")
+	cp := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), a.Ctrl().ForkCtxWg())
+	f := &failing{
+		CptMetaSt: cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t2"), a.Ctrl().ForkCtxWg()),
+		err:       errors.New("no device"),
+	}
+	code := <-run(a.Add(cp, f))
+	assert.Equal(t, app.ExitStartFailed, code)
+	assert.ErrorContains(t, a.Err(), "no device")
+	// the components started are stopped
+	assert.False(t, cp.IsRunning())
+	select {
+	case <-a.Ready():
+		t.Fatal("Ready closed")
+	default:
+	}
+
+	a = app.New("gw")
+	f = &failing{
+		CptMetaSt: cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t2"), a.Ctrl().ForkCtxWg()),
+		err:       app.WithExitCode(errors.New("no permission"), 77),
+	}
+	assert.Equal(t, 77, <-run(a.Add(f)))
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	a := app.New("gw").WithShutdownTimeout(50 * time.Millisecond)
+	s := newStuck(a.Ctrl().ForkCtxWg())
+	codec := run(a.Add(s))
+	<-a.Ready()
+	a.Shutdown(nil)
+	assert.Equal(t, app.ExitShutdownTimeout, <-codec)
+	assert.ErrorIs(t, a.Err(), app.ErrShutdownTimeout)
+	close(s.release)
+
+	// a second signal forces the exit
+	a = app.New("gw")
+	s = newStuck(a.Ctrl().ForkCtxWg())
+	codec = run(a.Add(s))
+	<-a.Ready()
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	assert.Eventually(t, func() bool { return s.Ctrl().Context().Err() != nil }, time.Second, 5*time.Millisecond)
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGINT))
+	assert.Equal(t, app.ExitShutdownTimeout, <-codec)
+	assert.ErrorIs(t, a.Err(), app.ErrForcedExit)
+	close(s.release)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, app.ExitOK, app.ExitCode(nil, 9))
+	assert.Equal(t, 9, app.ExitCode(errors.New("x"), 9))
+	err := errors.Join(errors.New("x"), app.WithExitCode(errors.New("y"), 70))
+	assert.Equal(t, 70, app.ExitCode(err, 9))
+	assert.NoError(t, app.WithExitCode(nil, 70))
+}
+
+func TestRunStopOrder(t *testing.T) {
+	a := app.New("gw")
+	var stops []string
+	for _, id := range []string{"broker", "consumer", "server"} {
+		a.Add(&ordered{CptMetaSt: cmpt.NewCptMetaSt(cmpt.KindName("cpt"), cmpt.IdName(id), a.Ctrl().ForkCtxWg()), stops: &stops})
+	}
+	codec := run(a)
+	<-a.Ready()
+	a.Shutdown(nil)
+	assert.Equal(t, app.ExitOK, <-codec)
+	// each component is cancelled when stopped, not with the root before the later ones are stopped
+	assert.Equal(t, []string{"server", "consumer", "broker"}, stops)
+	assert.Error(t, a.Ctrl().Context().Err())
+}
+
+func TestRunClosesLoggers(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.New(log.LogConf{
+		Director: dir,
+		Rotated:  log.RotatedConf{Filename: "app.log", MaxSize: 1},
+		Async:    log.AsyncConf{Enable: true, FlushInterval: time.Hour},
+	})
+	require.NoError(t, err)
+
+	a := app.New("gw")
+	codec := run(a)
+	<-a.Ready()
+	logger.Info("buffered until the exit")
+	a.Shutdown(nil)
+	assert.Equal(t, app.ExitOK, <-codec)
+
+	bs, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "buffered until the exit")
+}
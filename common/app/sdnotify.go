@@ -0,0 +1,70 @@
+package app
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the states sent to systemd, see sd_notify(3)
+const (
+	SdReady     = "READY=1"
+	SdReloading = "RELOADING=1"
+	SdStopping  = "STOPPING=1"
+	SdWatchdog  = "WATCHDOG=1"
+)
+
+// SdNotifier sends the state of the process to the service manager over $NOTIFY_SOCKET,
+// the sd_notify protocol of systemd. Without the socket it sends nothing.
+type SdNotifier struct {
+	addr     string
+	watchdog time.Duration
+}
+
+// NewSdNotifier returns the SdNotifier of the environment set by systemd for a Type=notify service:
+// NOTIFY_SOCKET and, with WatchdogSec, WATCHDOG_USEC and WATCHDOG_PID.
+func NewSdNotifier() *SdNotifier {
+	n := &SdNotifier{addr: os.Getenv("NOTIFY_SOCKET")}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return n
+	}
+	// WATCHDOG_PID为空 或者是本进程时 看门狗才针对本进程
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+	n.watchdog = time.Duration(usec) * time.Microsecond
+	return n
+}
+
+// Enabled reports whether the process runs under a service manager listening for the notifications.
+func (n *SdNotifier) Enabled() bool {
+	return n != nil && len(n.addr) > 0
+}
+
+// Watchdog returns the watchdog timeout of the service, 0 if disabled.
+// The pings are to be sent every half of it.
+func (n *SdNotifier) Watchdog() time.Duration {
+	if !n.Enabled() {
+		return 0
+	}
+	return n.watchdog
+}
+
+// Notify sends the states, e.g. SdReady and "STATUS=serving", in a datagram.
+// It does nothing if not Enabled.
+func (n *SdNotifier) Notify(states ...string) error {
+	if !n.Enabled() || len(states) == 0 {
+		return nil
+	}
+	// 以@开头的是抽象命名空间的套接字 net包会转换
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
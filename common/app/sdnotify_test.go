@@ -0,0 +1,151 @@
+package app_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"common/app"
+	cmpt "common/model/component"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen listens on a unixgram socket as systemd does and returns its path and the datagrams received.
+func listen(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	// 套接字路径长度有限 不使用t.TempDir
+	dir, err := os.MkdirTemp("", "sd")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+
+	msgs := make(chan string, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+	return path, msgs
+}
+
+// next returns the next datagram other than WATCHDOG=1, failing after a second.
+func next(t *testing.T, msgs <-chan string) string {
+	t.Helper()
+	tm := time.After(time.Second)
+	for {
+		select {
+		case m := <-msgs:
+			if m != app.SdWatchdog {
+				return m
+			}
+		case <-tm:
+			t.Fatal("no notification")
+			return ""
+		}
+	}
+}
+
+// probe is a component whose health is set by the test.
+type probe struct {
+	*cmpt.CptMetaSt
+	status atomic.Value
+}
+
+func (p *probe) Check(ctx context.Context) cmpt.HealthStatus {
+	return cmpt.HealthStatus{Status: p.status.Load().(cmpt.Health)}
+}
+
+func TestSdNotifier(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n := app.NewSdNotifier()
+	assert.False(t, n.Enabled())
+	assert.NoError(t, n.Notify(app.SdReady))
+	assert.Zero(t, n.Watchdog())
+
+	path, msgs := listen(t)
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "3000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	n = app.NewSdNotifier()
+	assert.True(t, n.Enabled())
+	assert.Equal(t, 3*time.Second, n.Watchdog())
+	require.NoError(t, n.Notify(app.SdReady, "STATUS=serving"))
+	assert.Equal(t, "READY=1\nSTATUS=serving", next(t, msgs))
+
+	// the watchdog of another process
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Zero(t, app.NewSdNotifier().Watchdog())
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, app.NewSdNotifier().Notify(app.SdReady))
+}
+
+func TestRunSdNotify(t *testing.T) {
+	path, msgs := listen(t)
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	a := app.New("gw")
+	p := &probe{CptMetaSt: cmpt.NewCptMetaSt(cmpt.KindName("link"), cmpt.IdName("l1"), a.Ctrl().ForkCtxWg())}
+	p.status.Store(cmpt.HealthDown)
+	ha := cmpt.NewHealthAggregator().WithTimeout(20 * time.Millisecond)
+	ha.AddCritical(p)
+	codec := run(a.Add(p).WithHealth(ha))
+	<-a.Ready()
+
+	// started but down, neither ready nor alive
+	select {
+	case m := <-msgs:
+		t.Fatalf("notified %q while down", m)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	p.status.Store(cmpt.HealthUp)
+	assert.Equal(t, "READY=1\nSTATUS=ready", next(t, msgs))
+	for range 2 {
+		select {
+		case m := <-msgs:
+			assert.Equal(t, app.SdWatchdog, m)
+		case <-time.After(time.Second):
+			t.Fatal("no watchdog ping")
+		}
+	}
+
+	// hung, the pings stop for systemd to restart the process
+	p.status.Store(cmpt.HealthDown)
+	time.Sleep(100 * time.Millisecond)
+	for len(msgs) > 0 {
+		<-msgs
+	}
+	select {
+	case m := <-msgs:
+		t.Fatalf("notified %q while down", m)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	p.status.Store(cmpt.HealthUp)
+	a.Shutdown(nil)
+	assert.Equal(t, app.SdStopping, next(t, msgs))
+	assert.Equal(t, app.ExitOK, <-codec)
+}
@@ -1,9 +1,16 @@
 package common_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	cm "common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPath(t *testing.T) {
@@ -12,3 +19,51 @@ func TestPath(t *testing.T) {
 	fp, err := cm.ExecutedCurrentFilePath()
 	t.Logf("ExecutedCurrentFilePath:%+v,err:%+v", fp, err)
 }
+
+func TestOSInfo(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"proc/sys/kernel/osrelease": "6.1.0-18-arm64\n",
+		"proc/stat":                 "cpu  1 2 3\nbtime 1700000000\nprocesses 42\n",
+		"proc/uptime":               "3600.52 7000.10\n",
+		"proc/meminfo":              "MemTotal:        2048000 kB\nMemFree:          100 kB\nMemAvailable:    1024000 kB\n",
+		"etc/os-release":            "# gateway\nID=debian\nNAME=\"Debian GNU/Linux\"\nVERSION_ID=\"12\"\nPRETTY_NAME='Debian GNU/Linux 12 (bookworm)'\n",
+		"etc/machine-id":            "0123456789abcdef0123456789abcdef\n",
+	} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	osi := cm.NewOSInfo().WithRoot(root).WithDiskPaths(root, filepath.Join(root, "missing"))
+	err := osi.Refresh()
+	// only the missing disk path fails
+	require.ErrorIs(t, err, cm.ErrHostInfo)
+	assert.Contains(t, err.Error(), "missing")
+	assert.Equal(t, 1, strings.Count(err.Error(), "os info:"))
+
+	assert.Equal(t, "6.1.0-18-arm64", osi.KernelVersion)
+	assert.Equal(t, cm.OSRelease{ID: "debian", Name: "Debian GNU/Linux", VersionID: "12", PrettyName: "Debian GNU/Linux 12 (bookworm)"}, osi.Distro)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", osi.MachineID)
+	assert.True(t, time.Unix(1700000000, 0).Equal(osi.BootTime))
+	assert.Equal(t, time.Hour, osi.Uptime)
+	assert.Equal(t, uint64(2048000*1024), osi.MemTotal)
+	assert.Equal(t, uint64(1024000*1024), osi.MemAvailable)
+	require.Len(t, osi.Disks, 1)
+	assert.Equal(t, root, osi.Disks[0].Path)
+	assert.Positive(t, osi.Disks[0].Total)
+	assert.Equal(t, osi.Disks[0].Total-osi.Disks[0].Free, osi.Disks[0].Used)
+	assert.NotEmpty(t, osi.Build.GoVersion)
+	assert.NotEmpty(t, osi.OsHostname)
+
+	s := osi.String()
+	assert.Contains(t, s, `"kernel_version":"6.1.0-18-arm64"`)
+	assert.Contains(t, s, `"distro":{"id":"debian"`)
+	assert.Contains(t, s, `"uptime":3600000000000`)
+
+	// refreshed on demand
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc/uptime"), []byte("7200.00 1.0\n"), 0o644))
+	osi.WithDiskPaths(root)
+	require.NoError(t, osi.Refresh())
+	assert.Equal(t, 2*time.Hour, osi.Uptime)
+}
@@ -0,0 +1,42 @@
+// Command confdoc prints the documentation of the configuration sections of the library,
+// generated from the tags of their structs:
+//
+//	confdoc -f yaml > app.yaml            # the commented default YAML
+//	confdoc -f schema > app.schema.json   # the JSON Schema
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"common/config"
+	"common/log"
+
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	format := pflag.StringP("format", "f", "yaml", "output format: yaml or schema")
+	pflag.Parse()
+
+	doc := config.NewDoc().Section("log_property", &log.LogConf{Rotated: log.RotatedConf{Filename: "app.log"}})
+
+	var (
+		out []byte
+		err error
+	)
+	switch *format {
+	case "yaml":
+		out, err = doc.YAML()
+	case "schema":
+		out, err = doc.JSONSchema()
+		out = append(out, '\n')
+	default:
+		err = fmt.Errorf("unrecognized format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "confdoc:", err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(out)
+}
@@ -0,0 +1,293 @@
+// Package config loads the layered configuration of a service:
+// the defaults, then a YAML TOML or JSON file, then the environment, then the flags,
+// each layer overriding the ones before. The sections are unmarshalled into typed structs
+// whose `default` and `validate` tags are applied, and each component reads its own section by kind and id.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	cmpt "common/model/component"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// the root key of the component sections
+	ComponentsKey = "components"
+	// the id of the section shared by all the components of a kind
+	DefaultId = "default"
+)
+
+// Option configures New.
+type Option func(*Config)
+
+// WithFile reads the config file at path, its type is given by the extension.
+func WithFile(path string) Option {
+	return func(c *Config) {
+		c.file = path
+	}
+}
+
+// WithSearch reads the first config file named name (without extension) found in paths,
+// no file found is not an error.
+func WithSearch(name string, paths ...string) Option {
+	return func(c *Config) {
+		c.name = name
+		c.paths = append(c.paths, paths...)
+	}
+}
+
+// WithEnvPrefix reads the environment variables PREFIX_KEY, the dots and dashes of the key are underscores,
+// e.g. APP_LOG_PROPERTY_LEVEL for log_property.level.
+func WithEnvPrefix(prefix string) Option {
+	return func(c *Config) {
+		c.envPrefix = prefix
+		c.env = true
+	}
+}
+
+// WithFlags overrides the keys named by the changed flags of fs, e.g. a flag "log_property.level".
+func WithFlags(fs *pflag.FlagSet) Option {
+	return func(c *Config) {
+		c.flags = fs
+	}
+}
+
+// WithDefaults sets the default values by key, below all the other layers.
+func WithDefaults(defaults map[string]any) Option {
+	return func(c *Config) {
+		for k, v := range defaults {
+			c.defaults[k] = v
+		}
+	}
+}
+
+// Config is the layered configuration, it is safe for concurrent use.
+type Config struct {
+	file      string
+	name      string
+	paths     []string
+	env       bool
+	envPrefix string
+	flags     *pflag.FlagSet
+	defaults  map[string]any
+	secrets   []SecretProvider
+
+	mu *sync.Mutex // guards v, viper is not safe for concurrent use
+	v  *viper.Viper
+}
+
+// New builds the layers and reads the config file.
+func New(opts ...Option) (*Config, error) {
+	c := &Config{
+		defaults: make(map[string]any),
+		mu:       &sync.Mutex{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.v = viper.New()
+	for k, v := range c.defaults {
+		c.v.SetDefault(k, v)
+	}
+	if c.env {
+		c.v.SetEnvPrefix(c.envPrefix)
+		c.v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+		c.v.AutomaticEnv()
+	}
+	if c.flags != nil {
+		if err := c.v.BindPFlags(c.flags); err != nil {
+			return nil, fmt.Errorf("config: bind flags: %w", err)
+		}
+	}
+
+	if err := c.readFile(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// must hold c.mu or not be shared
+func (c *Config) readFile() error {
+	switch {
+	case len(c.file) > 0:
+		c.v.SetConfigFile(c.file)
+	case len(c.name) > 0:
+		c.v.SetConfigName(c.name)
+		for _, p := range c.paths {
+			c.v.AddConfigPath(p)
+		}
+	default:
+		return nil
+	}
+
+	if err := c.v.ReadInConfig(); err != nil {
+		var nf viper.ConfigFileNotFoundError
+		if errors.As(err, &nf) {
+			return nil
+		}
+		return fmt.Errorf("config: read %s: %w", c.v.ConfigFileUsed(), err)
+	}
+	return nil
+}
+
+// Reload reads the config file again.
+func (c *Config) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readFile()
+}
+
+// File returns the path of the config file read, empty if none.
+func (c *Config) File() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v.ConfigFileUsed()
+}
+
+// Viper returns the underlying viper, e.g. for log.FromViper.
+// It must not be used concurrently with Reload.
+func (c *Config) Viper() *viper.Viper {
+	return c.v
+}
+
+// IsSet reports whether key is set by any layer.
+func (c *Config) IsSet(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v.IsSet(key)
+}
+
+// Get returns the value of key, the ${secret:name} references are not resolved, see Unmarshal.
+func (c *Config) Get(key string) any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v.Get(key)
+}
+
+// Unmarshal reads the section key into out, a pointer to a struct.
+// The `default` tags fill the fields unset by all the layers, then the `validate` tags are checked
+// and all the violations are returned. An empty key reads the whole configuration.
+// The ${secret:name} references of the string values are resolved, see WithSecrets.
+func (c *Config) Unmarshal(key string, out any) error {
+	if err := Defaults(out); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	err := c.unmarshal(key, out)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return Validate(out)
+}
+
+// must hold c.mu
+func (c *Config) unmarshal(key string, out any) error {
+	if c.env {
+		c.bindEnv(key, reflect.TypeOf(out))
+	}
+	// AllSettings merges all the layers, including the keys only set by the environment
+	sub := lookup(c.v.AllSettings(), key)
+	if sub == nil {
+		return nil
+	}
+	if len(c.secrets) > 0 {
+		var err error
+		if sub, err = c.resolveTree(key, sub); err != nil {
+			return err
+		}
+	}
+	if err := decode(sub, out); err != nil {
+		if len(key) == 0 {
+			return fmt.Errorf("config: unmarshal: %w", err)
+		}
+		return fmt.Errorf("config: unmarshal %s: %w", key, err)
+	}
+	return nil
+}
+
+// lookup returns the value of the dotted key in settings, nil if not found.
+func lookup(settings map[string]any, key string) any {
+	if len(key) == 0 {
+		return settings
+	}
+	var cur any = settings
+	for _, k := range strings.Split(strings.ToLower(key), ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if cur, ok = m[k]; !ok {
+			return nil
+		}
+	}
+	return cur
+}
+
+// decode decodes input into out with the decode hooks of viper.
+func decode(input, out any) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           out,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(input)
+}
+
+// bindEnv binds the keys of the fields of t under prefix, viper only reads from the environment
+// the keys it knows of otherwise. must hold c.mu
+func (c *Config) bindEnv(prefix string, t reflect.Type) {
+	walkKeys(prefix, t, func(key string) {
+		_ = c.v.BindEnv(key)
+	})
+}
+
+// SectionKey returns the key of the section of the component kind:id,
+// DefaultId for the section shared by the components of kind.
+// The dots of kind and id are replaced by underscores, they would nest the keys otherwise,
+// e.g. the section of the id gw.local is components.<kind>.gw_local.
+func SectionKey(kind cmpt.KindName, id cmpt.IdName) string {
+	return ComponentsKey + "." + sectionName(string(kind)) + "." + sectionName(string(id))
+}
+
+func sectionName(s string) string {
+	return strings.ReplaceAll(s, ".", "_")
+}
+
+// Section reads the section of the component kind:id into out:
+// the `default` tags, then the section of DefaultId, then the one of id.
+func (c *Config) Section(kind cmpt.KindName, id cmpt.IdName, out any) error {
+	if err := Defaults(out); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	err := c.unmarshal(SectionKey(kind, DefaultId), out)
+	if err == nil && id != DefaultId {
+		err = c.unmarshal(SectionKey(kind, id), out)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return Validate(out)
+}
+
+// Cpt reads the section of cp into out, see Section.
+func (c *Config) Cpt(cp cmpt.Cpt, out any) error {
+	return c.Section(cp.Kind(), cp.Id(), out)
+}
@@ -0,0 +1,141 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"common/config"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type appConf struct {
+	Name    string   `mapstructure:"name" validate:"required"`
+	Workers int      `mapstructure:"workers" default:"4" validate:"min=1,max=64"`
+	Tags    []string `mapstructure:"tags" default:"a,b"`
+	Server  struct {
+		Addr    string        `mapstructure:"addr" default:":8080"`
+		Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"min=1s"`
+	} `mapstructure:"server"`
+}
+
+type sensorConf struct {
+	Poll time.Duration `mapstructure:"poll" default:"1s" validate:"min=100ms"`
+	Unit string        `mapstructure:"unit" default:"C" validate:"oneof=C F"`
+	Addr string        `mapstructure:"addr" validate:"required"`
+}
+
+const yamlConf = `
+name: file
+workers: 8
+server:
+  timeout: 10s
+components:
+  sensor:
+    default:
+      poll: 2s
+      unit: F
+    s1:
+      addr: 10.0.0.1
+    gw_local:
+      addr: 10.0.0.3
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLayers(t *testing.T) {
+	t.Setenv("APP_WORKERS", "16")
+	t.Setenv("APP_SERVER_ADDR", ":9090")
+	fs := pflag.NewFlagSet("app", pflag.ContinueOnError)
+	fs.String("name", "unused", "")
+	fs.Int("workers", 1, "")
+	require.NoError(t, fs.Parse([]string{"--name=flag"}))
+
+	c, err := config.New(
+		config.WithDefaults(map[string]any{"name": "default"}),
+		config.WithFile(writeFile(t, "app.yaml", yamlConf)),
+		config.WithEnvPrefix("APP"),
+		config.WithFlags(fs),
+	)
+	require.NoError(t, err)
+
+	var conf appConf
+	require.NoError(t, c.Unmarshal("", &conf))
+	assert.Equal(t, "flag", conf.Name)                   // flag over file and default
+	assert.Equal(t, 16, conf.Workers)                    // env over file, unchanged flag ignored
+	assert.Equal(t, []string{"a", "b"}, conf.Tags)       // default tag
+	assert.Equal(t, ":9090", conf.Server.Addr)           // env only
+	assert.Equal(t, 10*time.Second, conf.Server.Timeout) // file over default tag
+}
+
+func TestFormats(t *testing.T) {
+	for name, content := range map[string]string{
+		"app.toml": "name = \"toml\"\nworkers = 2\n",
+		"app.json": `{"name": "json", "workers": 2}`,
+	} {
+		c, err := config.New(config.WithFile(writeFile(t, name, content)))
+		require.NoError(t, err)
+		var conf appConf
+		require.NoError(t, c.Unmarshal("", &conf))
+		assert.Equal(t, filepath.Ext(name)[1:], conf.Name)
+		assert.Equal(t, 2, conf.Workers)
+	}
+
+	_, err := config.New(config.WithFile(writeFile(t, "bad.yaml", "name: [")))
+	assert.Error(t, err)
+
+	c, err := config.New(config.WithSearch("missing", t.TempDir()))
+	require.NoError(t, err)
+	assert.Empty(t, c.File())
+}
+
+func TestSection(t *testing.T) {
+	t.Setenv("APP_COMPONENTS_SENSOR_S1_POLL", "500ms")
+	c, err := config.New(config.WithFile(writeFile(t, "app.yaml", yamlConf)), config.WithEnvPrefix("APP"))
+	require.NoError(t, err)
+
+	var s1 sensorConf
+	require.NoError(t, c.Section("sensor", "s1", &s1))
+	assert.Equal(t, sensorConf{Poll: 500 * time.Millisecond, Unit: "F", Addr: "10.0.0.1"}, s1)
+	assert.Equal(t, "components.sensor.s1", config.SectionKey("sensor", "s1"))
+
+	// the dots of the kind and the id don't nest the keys
+	assert.Equal(t, "components.*cmpt_Sensor.10_0_0_1", config.SectionKey("*cmpt.Sensor", "10.0.0.1"))
+	var s3 sensorConf
+	require.NoError(t, c.Section("sensor", "gw.local", &s3))
+	assert.Equal(t, "10.0.0.3", s3.Addr)
+
+	var s2 sensorConf
+	err = c.Section("sensor", "s2", &s2)
+	var fe *config.FieldError
+	require.True(t, errors.As(err, &fe))
+	assert.Equal(t, "addr", fe.Field)
+	assert.Equal(t, "required", fe.Rule)
+}
+
+func TestValidate(t *testing.T) {
+	conf := appConf{Workers: 100, Tags: []string{"x"}}
+	conf.Server.Timeout = time.Millisecond
+	err := config.Validate(&conf)
+
+	var merr *multierror.Error
+	require.True(t, errors.As(err, &merr))
+	require.Len(t, merr.Errors, 3)
+	assert.EqualError(t, merr.Errors[0], "config: name is required")
+	assert.EqualError(t, merr.Errors[1], "config: workers must be at most 64, got 100")
+	assert.EqualError(t, merr.Errors[2], "config: server.timeout must be at least 1s, got 1ms")
+
+	s := sensorConf{Poll: time.Second, Unit: "K", Addr: "x"}
+	assert.EqualError(t, config.Validate(s), "1 error occurred:\n\t* config: unit must be one of [C F], got K\n\n")
+}
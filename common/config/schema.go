@@ -0,0 +1,434 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	// the durations of time.ParseDuration, e.g. 1m30s
+	durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$`
+)
+
+var (
+	secretType = reflect.TypeOf(Secret(""))
+)
+
+// Doc documents the sections of a configuration file from the tags of their structs:
+// the keys of mapstructure, the `desc` descriptions, the `default` values and the `validate` rules.
+type Doc struct {
+	keys     []string
+	sections map[string]any
+}
+
+// NewDoc returns an empty Doc.
+func NewDoc() *Doc {
+	return &Doc{sections: make(map[string]any)}
+}
+
+// Section adds the section at the dotted key described by proto, a struct or a pointer to one,
+// an empty key is the root. The non zero fields of proto are the defaults along with the `default` tags.
+func (d *Doc) Section(key string, proto any) *Doc {
+	if _, ok := d.sections[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.sections[key] = proto
+	return d
+}
+
+// defaultsOf returns a copy of the struct of proto with its `default` tags applied.
+func defaultsOf(proto any) (reflect.Value, error) {
+	rv := reflect.ValueOf(proto)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv = reflect.New(rv.Type().Elem()).Elem()
+			break
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("config: %T is not a struct", proto)
+	}
+	cp := reflect.New(rv.Type())
+	cp.Elem().Set(rv)
+	if err := Defaults(cp.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return cp.Elem(), nil
+}
+
+// JSONSchema returns the JSON Schema of the sections.
+func (d *Doc) JSONSchema() ([]byte, error) {
+	root := map[string]any{"$schema": schemaDraft, "type": "object"}
+	for _, key := range d.keys {
+		dv, err := defaultsOf(d.sections[key])
+		if err != nil {
+			return nil, err
+		}
+		s := schemaOf(dv.Type(), dv)
+		if len(key) == 0 {
+			for k, v := range s {
+				root[k] = v
+			}
+			continue
+		}
+		parent := root
+		parts := strings.Split(key, ".")
+		for _, p := range parts[:len(parts)-1] {
+			props := properties(parent)
+			next, ok := props[p].(map[string]any)
+			if !ok {
+				next = map[string]any{"type": "object"}
+				props[p] = next
+			}
+			parent = next
+		}
+		properties(parent)[parts[len(parts)-1]] = s
+	}
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func properties(s map[string]any) map[string]any {
+	props, ok := s["properties"].(map[string]any)
+	if !ok {
+		props = make(map[string]any)
+		s["properties"] = props
+	}
+	return props
+}
+
+// schemaOf returns the schema of t, dv is the default value of t if valid.
+func schemaOf(t reflect.Type, dv reflect.Value) map[string]any {
+	switch t {
+	case secretType:
+		return map[string]any{"type": "string", "writeOnly": true}
+	case durationType:
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if dv.IsValid() && !dv.IsNil() {
+			return schemaOf(t.Elem(), dv.Elem())
+		}
+		return schemaOf(t.Elem(), reflect.Value{})
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), reflect.Value{})}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), reflect.Value{})}
+	case reflect.Struct:
+		s := map[string]any{"type": "object"}
+		props := make(map[string]any)
+		var required []string
+		structSchema(t, dv, props, &required)
+		if len(props) > 0 {
+			s["properties"] = props
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, dv reflect.Value, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, squash, skip := fieldKey(sf)
+		if skip {
+			continue
+		}
+		var fv reflect.Value
+		if dv.IsValid() {
+			fv = dv.Field(i)
+		}
+		if squash && indirectType(sf.Type).Kind() == reflect.Struct {
+			if fv.IsValid() && fv.Kind() == reflect.Pointer {
+				fv = reflect.Indirect(fv)
+			}
+			structSchema(indirectType(sf.Type), fv, props, required)
+			continue
+		}
+
+		s := schemaOf(sf.Type, fv)
+		if desc := sf.Tag.Get("desc"); len(desc) > 0 {
+			s["description"] = desc
+		}
+		if fv.IsValid() && !fv.IsZero() && fv.Kind() != reflect.Struct && sf.Type != secretType {
+			s["default"] = plainValue(fv)
+		}
+		if applyRules(s, sf.Type, sf.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		props[name] = s
+	}
+}
+
+// applyRules adds the constraints of the `validate` rules to the schema s of a field of type t,
+// and reports whether the field is required.
+func applyRules(s map[string]any, t reflect.Type, tag string) (required bool) {
+	if len(tag) == 0 {
+		return false
+	}
+	omitempty := false
+	cons := make(map[string]any)
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		case "oneof":
+			var enum []any
+			for _, opt := range strings.Fields(param) {
+				enum = append(enum, parseParam(t, opt))
+			}
+			cons["enum"] = enum
+		case "min", "max", "gt", "lt":
+			limitRule(cons, t, name, param)
+		}
+	}
+	if len(cons) == 0 {
+		return required
+	}
+	if omitempty {
+		// the zero value is allowed besides the constrained ones
+		s["anyOf"] = []any{map[string]any{"const": plainValue(reflect.Zero(t))}, cons}
+		return required
+	}
+	for k, v := range cons {
+		s[k] = v
+	}
+	return required
+}
+
+// limitRule adds the constraint of the rule min max gt or lt, the durations are strings and not constrained.
+func limitRule(cons map[string]any, t reflect.Type, rule, param string) {
+	if t == durationType {
+		return
+	}
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	var prefix string
+	switch indirectType(t).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		cons[map[string]string{"min": "minimum", "max": "maximum", "gt": "exclusiveMinimum", "lt": "exclusiveMaximum"}[rule]] = n
+		return
+	case reflect.String:
+		prefix = "Length"
+	case reflect.Slice, reflect.Array:
+		prefix = "Items"
+	case reflect.Map:
+		prefix = "Properties"
+	default:
+		return
+	}
+	// the lengths are integers, gt and lt are the next ones
+	switch rule {
+	case "gt":
+		rule, n = "min", n+1
+	case "lt":
+		rule, n = "max", n-1
+	}
+	cons[rule+prefix] = int(n)
+}
+
+// parseParam returns the JSON value of the parameter opt of a rule for a field of type t.
+func parseParam(t reflect.Type, opt string) any {
+	v := reflect.New(t).Elem()
+	if t == secretType || setString(v, opt) != nil {
+		return opt
+	}
+	return plainValue(v)
+}
+
+// plainValue returns v as a value of JSON or YAML, the durations are strings.
+func plainValue(v reflect.Value) any {
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Type() == secretType:
+		return ""
+	case v.Kind() == reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return plainValue(v.Elem())
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []any{}
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = plainValue(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key())] = plainValue(iter.Value())
+		}
+		return out
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface()
+		}
+		out := make(map[string]any)
+		structPlain(v, out)
+		return out
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+func structPlain(v reflect.Value, out map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, squash, skip := fieldKey(t.Field(i))
+		if skip {
+			continue
+		}
+		fv := reflect.Indirect(v.Field(i))
+		if squash && fv.Kind() == reflect.Struct {
+			structPlain(fv, out)
+			continue
+		}
+		if !fv.IsValid() {
+			out[name] = nil
+			continue
+		}
+		out[name] = plainValue(fv)
+	}
+}
+
+// YAML returns the YAML of the sections with their default values,
+// the keys are commented by their `desc` and `validate` tags.
+func (d *Doc) YAML() ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range d.keys {
+		dv, err := defaultsOf(d.sections[key])
+		if err != nil {
+			return nil, err
+		}
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		structNodes(dv, node)
+		if len(key) == 0 {
+			root.Content = append(root.Content, node.Content...)
+			continue
+		}
+		parent := root
+		parts := strings.Split(key, ".")
+		for _, p := range parts[:len(parts)-1] {
+			parent = childMapping(parent, p)
+		}
+		parent.Content = append(parent.Content, scalarNode(parts[len(parts)-1]), node)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// childMapping returns the mapping of key in the mapping m, added if not found.
+func childMapping(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key && m.Content[i+1].Kind == yaml.MappingNode {
+			return m.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	m.Content = append(m.Content, scalarNode(key), child)
+	return child
+}
+
+func scalarNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// structNodes appends the keys and values of the fields of the struct v to the mapping m.
+func structNodes(v reflect.Value, m *yaml.Node) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, squash, skip := fieldKey(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Pointer && indirectType(sf.Type).Kind() == reflect.Struct {
+			if fv.IsNil() {
+				fv = reflect.New(sf.Type.Elem())
+			}
+			fv = fv.Elem()
+		}
+		if squash && fv.Kind() == reflect.Struct {
+			structNodes(fv, m)
+			continue
+		}
+
+		kn := scalarNode(name)
+		var comments []string
+		if desc := sf.Tag.Get("desc"); len(desc) > 0 {
+			comments = append(comments, desc)
+		}
+		if rules := sf.Tag.Get("validate"); len(rules) > 0 {
+			comments = append(comments, "validate: "+rules)
+		}
+		kn.HeadComment = strings.Join(comments, "\n")
+
+		var vn *yaml.Node
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			vn = &yaml.Node{Kind: yaml.MappingNode}
+			structNodes(fv, vn)
+		} else {
+			vn = &yaml.Node{}
+			if err := vn.Encode(plainValue(fv)); err != nil {
+				vn = scalarNode(fmt.Sprint(plainValue(fv)))
+			}
+			if vn.Kind == yaml.SequenceNode || vn.Kind == yaml.MappingNode {
+				if len(vn.Content) == 0 {
+					vn.Style = yaml.FlowStyle
+				}
+			}
+		}
+		m.Content = append(m.Content, kn, vn)
+	}
+}
@@ -0,0 +1,145 @@
+package config_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"common/config"
+	"common/log"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pollerConf struct {
+	Name     string        `mapstructure:"name" validate:"required" desc:"name of the poller"`
+	Interval time.Duration `mapstructure:"interval" default:"1s" validate:"min=100ms" desc:"poll interval"`
+	Retries  int           `mapstructure:"retries" default:"3" validate:"gt=0,lt=10"`
+	Mode     string        `mapstructure:"mode" validate:"omitempty,oneof=fast slow"`
+	Tags     []string      `mapstructure:"tags" validate:"max=4"`
+	Password config.Secret `mapstructure:"password" desc:"device password"`
+	CertDir  string        `mapstructure:"cert-dir" validate:"dir"`
+	CAFile   string        `mapstructure:"ca-file" validate:"file"`
+	Device   struct {
+		Addr string `mapstructure:"addr" default:"127.0.0.1" desc:"device address"`
+	} `mapstructure:"device"`
+}
+
+func TestValidateRules(t *testing.T) {
+	dir := t.TempDir()
+	conf := pollerConf{
+		Interval: time.Second,
+		Retries:  10,
+		Mode:     "FAST",
+		CertDir:  filepath.Join(dir, "missing"),
+		CAFile:   dir,
+	}
+	err := config.Validate(&conf)
+	var merr *multierror.Error
+	require.True(t, errors.As(err, &merr))
+	require.Len(t, merr.Errors, 4)
+	assert.EqualError(t, merr.Errors[0], "config: name is required")
+	assert.EqualError(t, merr.Errors[1], "config: retries must be less than 10, got 10")
+	assert.EqualError(t, merr.Errors[2], "config: cert-dir "+conf.CertDir+" does not exist")
+	assert.EqualError(t, merr.Errors[3], "config: ca-file "+dir+" is not a regular file")
+
+	conf = pollerConf{Name: "p", Interval: time.Second, Retries: 1, CertDir: dir}
+	assert.NoError(t, config.Validate(&conf))
+}
+
+func TestValidateLogConf(t *testing.T) {
+	conf := log.LogConf{Level: "verbose", Format: "xml", Backend: "zap"}
+	conf.Rotated.Filename = "app.log"
+	conf.Rotated.MaxAge = -1
+	err := config.Validate(&conf)
+	var merr *multierror.Error
+	require.True(t, errors.As(err, &merr))
+	// LogConf.Validate is the only check of LogConf, its tags only document the rules
+	assert.Equal(t, conf.Validate().Error(), err.Error())
+	assert.Len(t, merr.Errors, 3)
+	assert.ErrorContains(t, err, `log: unrecognized level "verbose"`)
+	assert.ErrorContains(t, err, `log: unrecognized format "xml"`)
+	assert.ErrorContains(t, err, "must not be negative")
+
+	path := writeFile(t, "app.yaml", `
+log_property:
+  level: debug
+  rotated-property:
+    filename: app.log
+`)
+	// a zero MaxSize is the default of 100 megabytes, as in RotateWriter
+	assert.NoError(t, config.Validate(&log.LogConf{Rotated: log.RotatedConf{Filename: "app.log"}}))
+	assert.ErrorContains(t, config.Validate(&log.LogConf{}), "rotated-property.filename is empty")
+
+	c, err := config.New(config.WithFile(path))
+	require.NoError(t, err)
+	var lc log.LogConf
+	require.NoError(t, c.Unmarshal("log_property", &lc))
+	assert.Equal(t, "debug", lc.Level)
+	assert.Equal(t, "console", lc.Format)
+	assert.Equal(t, 100, lc.Rotated.MaxSize)
+	assert.Equal(t, 4096, lc.Async.Size)
+}
+
+func TestDocSchema(t *testing.T) {
+	bs, err := config.NewDoc().Section("components.poller.default", &pollerConf{}).JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(bs, &schema))
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", schema["$schema"])
+	s := schema["properties"].(map[string]any)["components"].(map[string]any)["properties"].(map[string]any)["poller"].(map[string]any)["properties"].(map[string]any)["default"].(map[string]any)
+	assert.Equal(t, []any{"name"}, s["required"])
+
+	props := s["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "description": "name of the poller"}, props["name"])
+	assert.Equal(t, "1s", props["interval"].(map[string]any)["default"])
+	assert.Equal(t, "poll interval", props["interval"].(map[string]any)["description"])
+	assert.Equal(t, map[string]any{"type": "integer", "default": 3.0, "exclusiveMinimum": 0.0, "exclusiveMaximum": 10.0}, props["retries"])
+	assert.Equal(t, []any{map[string]any{"const": ""}, map[string]any{"enum": []any{"fast", "slow"}}}, props["mode"].(map[string]any)["anyOf"])
+	assert.Equal(t, 4.0, props["tags"].(map[string]any)["maxItems"])
+	assert.Equal(t, true, props["password"].(map[string]any)["writeOnly"])
+	assert.Equal(t, "127.0.0.1", props["device"].(map[string]any)["properties"].(map[string]any)["addr"].(map[string]any)["default"])
+
+	bs, err = config.NewDoc().Section("log_property", &log.LogConf{}).JSONSchema()
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), `"LowercaseColorLevelEncoder"`)
+	// maxsize 0 is valid, the default of 100 megabytes
+	assert.NotContains(t, string(bs), `"exclusiveMinimum"`)
+}
+
+func TestDocYAML(t *testing.T) {
+	proto := &pollerConf{Name: "p1", Password: "hunter2"}
+	bs, err := config.NewDoc().
+		Section("components.poller.default", proto).
+		Section("log_property", &log.LogConf{Rotated: log.RotatedConf{Filename: "app.log"}}).
+		YAML()
+	require.NoError(t, err)
+	out := string(bs)
+	assert.Contains(t, out, "components:\n  poller:\n    default:\n      # name of the poller\n      # validate: required\n      name: p1\n")
+	assert.Contains(t, out, "      # poll interval\n      # validate: min=100ms\n      interval: 1s\n")
+	assert.Contains(t, out, "      tags: []\n")
+	assert.Contains(t, out, "  # minimum level\n")
+	assert.NotContains(t, out, "hunter2")
+
+	// the generated file reads back as the defaults
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	require.NoError(t, os.WriteFile(path, bs, 0o644))
+	c, err := config.New(config.WithFile(path))
+	require.NoError(t, err)
+	var pc pollerConf
+	require.NoError(t, c.Section("poller", "p1", &pc))
+	assert.Equal(t, "p1", pc.Name)
+	assert.Equal(t, time.Second, pc.Interval)
+	assert.Equal(t, 3, pc.Retries)
+	assert.Equal(t, "127.0.0.1", pc.Device.Addr)
+	var lc log.LogConf
+	require.NoError(t, c.Unmarshal("log_property", &lc))
+	assert.Equal(t, "info", lc.Level)
+	assert.Equal(t, 100, lc.Rotated.MaxSize)
+}
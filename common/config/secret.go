@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// SecretMask replaces the value of a Secret when it's printed, marshalled or logged
+	SecretMask = "******"
+)
+
+var (
+	ErrSecretNotFound = errors.New("config: secret not found")
+	ErrSecretName     = errors.New("config: invalid secret name")
+
+	// ${secret:name}
+	secretRef = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+	//Verify Satisfies interfaces
+	_ fmt.Stringer   = Secret("")
+	_ fmt.GoStringer = Secret("")
+	_ slog.LogValuer = Secret("")
+
+	_ SecretProvider = (*FileSecrets)(nil)
+	_ SecretProvider = (*EnvSecrets)(nil)
+)
+
+// Secret is a sensitive config value, e.g. a device password. It's masked when printed,
+// marshalled to JSON or text, or logged with zap or slog, Value returns the plain value.
+type Secret string
+
+// Value returns the plain value of the secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return SecretMask
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// SecretProvider looks up the secrets referenced by ${secret:name} in the config values.
+type SecretProvider interface {
+	// Secret returns the secret name, an error wrapping ErrSecretNotFound if there is none.
+	Secret(name string) (Secret, error)
+}
+
+// FileSecrets reads each secret from the file of its name in a directory,
+// as the secrets of Kubernetes are mounted. The file is read on each lookup
+// so that a rotated secret is seen, the trailing newline is trimmed.
+type FileSecrets struct {
+	dir string
+}
+
+// NewFileSecrets returns the provider of the secrets in dir.
+func NewFileSecrets(dir string) *FileSecrets {
+	return &FileSecrets{dir: dir}
+}
+
+func (fs *FileSecrets) Secret(name string) (Secret, error) {
+	// the name is a file of dir, not a path
+	if len(name) == 0 || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrSecretName, name)
+	}
+	bs, err := os.ReadFile(filepath.Join(fs.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s in %s", ErrSecretNotFound, name, fs.dir)
+		}
+		return "", fmt.Errorf("config: secret %s: %w", name, err)
+	}
+	return Secret(strings.TrimRight(string(bs), "\r\n")), nil
+}
+
+// EnvSecrets reads the secrets from the environment variables PREFIX_NAME,
+// the name is upper cased and its dots and dashes are underscores.
+type EnvSecrets struct {
+	prefix string
+}
+
+// NewEnvSecrets returns the provider of the secrets in the environment variables prefixed by prefix,
+// an empty prefix reads NAME.
+func NewEnvSecrets(prefix string) *EnvSecrets {
+	return &EnvSecrets{prefix: prefix}
+}
+
+func (es *EnvSecrets) Secret(name string) (Secret, error) {
+	if len(name) == 0 {
+		return "", fmt.Errorf("%w: %q", ErrSecretName, name)
+	}
+	key := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+	if len(es.prefix) > 0 {
+		key = strings.ToUpper(es.prefix) + "_" + key
+	}
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s in env %s", ErrSecretNotFound, name, key)
+	}
+	return Secret(v), nil
+}
+
+// WithSecrets resolves the ${secret:name} references of the config values from the providers,
+// the first one having the secret wins.
+func WithSecrets(providers ...SecretProvider) Option {
+	return func(c *Config) {
+		c.secrets = append(c.secrets, providers...)
+	}
+}
+
+// Secret looks up the secret name in the providers of WithSecrets.
+func (c *Config) Secret(name string) (Secret, error) {
+	for _, p := range c.secrets {
+		s, err := p.Secret(name)
+		if err == nil {
+			return s, nil
+		}
+		if !errors.Is(err, ErrSecretNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// resolveSecrets replaces the ${secret:name} references of s by the secrets.
+func (c *Config) resolveSecrets(s string) (string, error) {
+	var err error
+	out := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		var sec Secret
+		sec, err = c.Secret(secretRef.FindStringSubmatch(ref)[1])
+		return sec.Value()
+	})
+	return out, err
+}
+
+// resolveTree returns v with the references of its string values resolved,
+// key is the key of v for the errors. The maps and slices are copied, not modified.
+func (c *Config) resolveTree(key string, v any) (any, error) {
+	switch tv := v.(type) {
+	case string:
+		if !strings.Contains(tv, "${secret:") {
+			return tv, nil
+		}
+		rs, err := c.resolveSecrets(tv)
+		if err != nil {
+			return nil, fmt.Errorf("config: %s: %w", key, err)
+		}
+		return rs, nil
+	case map[string]any:
+		out := make(map[string]any, len(tv))
+		for k, e := range tv {
+			re, err := c.resolveTree(joinKey(key, k), e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = re
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(tv))
+		for i, e := range tv {
+			re, err := c.resolveTree(fmt.Sprintf("%s[%d]", key, i), e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = re
+		}
+		return out, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"common/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type deviceConf struct {
+	Addr     string        `mapstructure:"addr"`
+	User     string        `mapstructure:"user"`
+	Password config.Secret `mapstructure:"password" validate:"required"`
+	DSN      string        `mapstructure:"dsn"`
+}
+
+func TestSecretMasked(t *testing.T) {
+	s := config.Secret("hunter2")
+	assert.Equal(t, "hunter2", s.Value())
+	for _, out := range []string{
+		s.String(),
+		fmt.Sprint(s),
+		fmt.Sprintf("%v %s %q %x %+v", s, s, s, s, s),
+		fmt.Sprintf("%#v", s),
+		fmt.Sprintf("%+v", deviceConf{Password: s}),
+	} {
+		assert.NotContains(t, out, "hunter2")
+	}
+	bs, err := json.Marshal(deviceConf{Password: s})
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), `"Password":"******"`)
+
+	buf := &bytes.Buffer{}
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel))
+	logger.Info("zap", zap.Any("password", s), zap.Any("conf", deviceConf{Password: s}))
+	slog.New(slog.NewJSONHandler(buf, nil)).Info("slog", "password", s, "conf", deviceConf{Password: s})
+	slog.New(slog.NewTextHandler(buf, nil)).Info("slog", "password", s)
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), `"password":"******"`)
+}
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sensor-pw"), []byte("from-file\n"), 0o600))
+	t.Setenv("APP_SENSOR_PW", "from-env")
+	t.Setenv("APP_DB_PW", "db-env")
+
+	path := writeFile(t, "app.yaml", `
+components:
+  device:
+    d1:
+      addr: 10.0.0.1
+      password: ${secret:sensor-pw}
+      dsn: postgres://u:${secret:db.pw}@db/x
+    d2:
+      password: ${secret:missing}
+`)
+	c, err := config.New(config.WithFile(path),
+		config.WithSecrets(config.NewFileSecrets(dir), config.NewEnvSecrets("APP")))
+	require.NoError(t, err)
+
+	var d1 deviceConf
+	require.NoError(t, c.Section("device", "d1", &d1))
+	assert.Equal(t, "from-file", d1.Password.Value())
+	assert.Equal(t, "postgres://u:db-env@db/x", d1.DSN)
+	// the raw value is not resolved
+	assert.Equal(t, "${secret:sensor-pw}", c.Get("components.device.d1.password"))
+
+	var d2 deviceConf
+	err = c.Section("device", "d2", &d2)
+	assert.ErrorIs(t, err, config.ErrSecretNotFound)
+	assert.ErrorContains(t, err, "missing")
+
+	s, err := config.NewEnvSecrets("APP").Secret("sensor-pw")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", s.Value())
+	_, err = config.NewFileSecrets(dir).Secret("../etc/passwd")
+	assert.ErrorIs(t, err, config.ErrSecretName)
+}
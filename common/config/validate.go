@@ -0,0 +1,393 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Validator is implemented by the structs checking themselves instead of by their `validate` tags,
+// e.g. log.LogConf.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is a violation of a `validate` tag, Field is the dotted key of the field.
+type FieldError struct {
+	Field string
+	Rule  string
+	Param string
+	Value any
+}
+
+func (fe *FieldError) Error() string {
+	switch fe.Rule {
+	case "required":
+		return fmt.Sprintf("config: %s is required", fe.Field)
+	case "min":
+		return fmt.Sprintf("config: %s must be at least %s, got %v", fe.Field, fe.Param, fe.Value)
+	case "max":
+		return fmt.Sprintf("config: %s must be at most %s, got %v", fe.Field, fe.Param, fe.Value)
+	case "gt":
+		return fmt.Sprintf("config: %s must be greater than %s, got %v", fe.Field, fe.Param, fe.Value)
+	case "lt":
+		return fmt.Sprintf("config: %s must be less than %s, got %v", fe.Field, fe.Param, fe.Value)
+	case "oneof":
+		return fmt.Sprintf("config: %s must be one of [%s], got %v", fe.Field, fe.Param, fe.Value)
+	case "exists":
+		return fmt.Sprintf("config: %s %v does not exist", fe.Field, fe.Value)
+	case "dir":
+		return fmt.Sprintf("config: %s %v is not a directory", fe.Field, fe.Value)
+	case "file":
+		return fmt.Sprintf("config: %s %v is not a regular file", fe.Field, fe.Value)
+	}
+	return fmt.Sprintf("config: %s violates %s=%s", fe.Field, fe.Rule, fe.Param)
+}
+
+// fieldKey returns the config key of a struct field from its mapstructure tag.
+func fieldKey(sf reflect.StructField) (key string, squash, skip bool) {
+	if !sf.IsExported() {
+		return "", false, true
+	}
+	tag := sf.Tag.Get("mapstructure")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	squash = strings.Contains(opts, "squash") || (sf.Anonymous && len(name) == 0)
+	if len(name) == 0 {
+		name = sf.Name
+	}
+	return name, squash, false
+}
+
+func joinKey(prefix, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// walkKeys calls fn with the keys of the leaf fields of t under prefix.
+func walkKeys(prefix string, t reflect.Type, fn func(key string)) {
+	t = indirectType(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, squash, skip := fieldKey(sf)
+		if skip {
+			continue
+		}
+		ft := indirectType(sf.Type)
+		switch {
+		case squash:
+			walkKeys(prefix, ft, fn)
+		case ft.Kind() == reflect.Struct && ft != timeType:
+			walkKeys(joinKey(prefix, strings.ToLower(name)), ft, fn)
+		default:
+			fn(joinKey(prefix, strings.ToLower(name)))
+		}
+	}
+}
+
+// Defaults sets the zero fields of out, a pointer to a struct, from their `default` tags,
+// e.g. `default:"1s"`, the slices are comma separated.
+func Defaults(out any) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: %T is not a pointer to a struct", out)
+	}
+	return defaults("", rv.Elem())
+}
+
+func defaults(prefix string, rv reflect.Value) (err error) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, squash, skip := fieldKey(sf)
+		if skip {
+			continue
+		}
+		key := prefix
+		if !squash {
+			key = joinKey(prefix, name)
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			if derr := defaults(key, fv); derr != nil {
+				err = multierror.Append(err, derr)
+			}
+			continue
+		}
+
+		def, ok := sf.Tag.Lookup("default")
+		if !ok || !fv.IsZero() {
+			continue
+		}
+		if serr := setString(fv, def); serr != nil {
+			err = multierror.Append(err, fmt.Errorf("config: default of %s: %w", key, serr))
+		}
+	}
+	return err
+}
+
+// setString sets v from its string form.
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		sl := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(sl.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Validate checks the `validate` tags of v, a struct or a pointer to it, and returns all the violations
+// as *FieldError in a multierror. The rules are comma separated:
+// required, min=N max=N gt=N and lt=N (the value of numbers and durations, the length of strings slices and maps),
+// oneof=a b c (case insensitive), and exists dir and file for the non empty paths. omitempty skips the rules after it for a zero value.
+// The nested structs, slices and maps of structs are checked too. A struct implementing Validator
+// is checked by it only, its tags and those of the structs nested in it are then only used by Doc,
+// so that each rule has a single source and is reported once, e.g. log.LogConf.
+func Validate(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs *multierror.Error
+	validate("", rv, &errs)
+	return errs.ErrorOrNil()
+}
+
+// validate calls the Validator of rv if it implements it, or checks the tags of rv and the structs nested.
+func validate(prefix string, rv reflect.Value, errs **multierror.Error) {
+	if vd := validatorOf(rv); vd != nil {
+		if err := vd.Validate(); err != nil {
+			var merr *multierror.Error
+			if errors.As(err, &merr) {
+				*errs = multierror.Append(*errs, merr.Errors...)
+			} else {
+				*errs = multierror.Append(*errs, err)
+			}
+		}
+		return
+	}
+
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, squash, skip := fieldKey(sf)
+		if skip {
+			continue
+		}
+		key := prefix
+		if !squash {
+			key = joinKey(prefix, name)
+		}
+		fv := rv.Field(i)
+
+		if tag := sf.Tag.Get("validate"); len(tag) > 0 {
+			for _, rule := range strings.Split(tag, ",") {
+				if strings.TrimSpace(rule) == "omitempty" {
+					if fv.IsZero() {
+						break
+					}
+					continue
+				}
+				if fe := checkRule(key, fv, rule); fe != nil {
+					*errs = multierror.Append(*errs, fe)
+				}
+			}
+		}
+		validateNested(key, fv, errs)
+	}
+}
+
+// validatorOf returns the Validator of rv, nil if it doesn't implement it.
+func validatorOf(rv reflect.Value) Validator {
+	switch {
+	case rv.CanAddr() && rv.Addr().Type().Implements(reflect.TypeOf((*Validator)(nil)).Elem()):
+		return rv.Addr().Interface().(Validator)
+	case rv.CanInterface():
+		if vd, ok := rv.Interface().(Validator); ok {
+			return vd
+		}
+	}
+	return nil
+}
+
+func validateNested(key string, fv reflect.Value, errs **multierror.Error) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() != timeType {
+			validate(key, fv, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			validateNested(fmt.Sprintf("%s[%d]", key, i), fv.Index(i), errs)
+		}
+	case reflect.Map:
+		iter := fv.MapRange()
+		for iter.Next() {
+			validateNested(fmt.Sprintf("%s.%v", key, iter.Key()), iter.Value(), errs)
+		}
+	}
+}
+
+func checkRule(key string, fv reflect.Value, rule string) *FieldError {
+	name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+	fe := &FieldError{Field: key, Rule: name, Param: param, Value: valueOf(fv)}
+	switch name {
+	case "required":
+		if fv.IsZero() {
+			return fe
+		}
+	case "min", "max", "gt", "lt":
+		n, limit, ok := measure(fv, param)
+		if !ok {
+			return fe
+		}
+		if (name == "min" && n < limit) || (name == "max" && n > limit) ||
+			(name == "gt" && n <= limit) || (name == "lt" && n >= limit) {
+			return fe
+		}
+	case "oneof":
+		s := fmt.Sprint(valueOf(fv))
+		for _, opt := range strings.Fields(param) {
+			if strings.EqualFold(s, opt) {
+				return nil
+			}
+		}
+		return fe
+	case "exists", "dir", "file":
+		if fv.Kind() != reflect.String || fv.Len() == 0 {
+			return nil
+		}
+		fi, err := os.Stat(fv.String())
+		switch {
+		case err != nil:
+			fe.Rule = "exists"
+			return fe
+		case name == "dir" && !fi.IsDir(), name == "file" && !fi.Mode().IsRegular():
+			return fe
+		}
+	case "":
+	default:
+		fe.Rule, fe.Param = "unknown rule", name
+		return fe
+	}
+	return nil
+}
+
+// measure returns the measure of fv compared by min and max, and the limit parsed from param.
+func measure(fv reflect.Value, param string) (n, limit float64, ok bool) {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(param)
+		return float64(fv.Int()), float64(d), err == nil
+	}
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), limit, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), limit, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), limit, true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), limit, true
+	}
+	return 0, 0, false
+}
+
+func valueOf(fv reflect.Value) any {
+	if fv.Type() == durationType {
+		return time.Duration(fv.Int())
+	}
+	if fv.CanInterface() {
+		return fv.Interface()
+	}
+	return nil
+}
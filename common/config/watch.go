@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	mdl "common/model"
+	cmpt "common/model/component"
+	evc "common/model/eventchans"
+
+	"github.com/fsnotify/fsnotify"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+const (
+	// ReloadTopic is the EvtChans topic reserved for the config changes,
+	// the changes of a section are published on Topic(kind, id) under it.
+	ReloadTopic = "config.reload"
+
+	// the delay coalescing the events of a file write, editors often write a file in several steps
+	defaultWatchDelay = 100 * time.Millisecond
+	// the time a Change waits for the subscribers of its topic
+	defaultPublishTimeout = time.Second
+)
+
+var (
+	// ErrRestart is returned by Reconfigure when the change can't be applied live,
+	// the component is then restarted.
+	ErrRestart = errors.New("config: restart required")
+
+	//Verify Satisfies interfaces
+	_ cmpt.Cpt          = (*Watcher)(nil)
+	_ mdl.WorkerRecover = (*Watcher)(nil)
+)
+
+// Change is the change of the section of the component kind:id, Old and New are the values
+// unmarshalled as Section does and Keys the keys of the fields that differ.
+type Change[T any] struct {
+	Kind cmpt.KindName
+	Id   cmpt.IdName
+	Old  T
+	New  T
+	Keys []string
+}
+
+// Changed reports whether the field key, or a field under it, changed.
+func (ch Change[T]) Changed(key string) bool {
+	for _, k := range ch.Keys {
+		if k == key || (len(k) > len(key) && k[:len(key)] == key && k[len(key)] == '.') {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconfigurable is implemented by the components applying a change of their section live,
+// returning ErrRestart makes the Watcher restart the component instead.
+type Reconfigurable[T any] interface {
+	Reconfigure(change Change[T]) error
+}
+
+// Topic returns the topic the changes of the section of the component kind:id are published on.
+func Topic(kind cmpt.KindName, id cmpt.IdName) string {
+	return ReloadTopic + "/" + SectionKey(kind, id)
+}
+
+// watch is a section watched by a component.
+type watch struct {
+	kind   cmpt.KindName
+	id     cmpt.IdName
+	reload func() error
+}
+
+// Watcher reloads the config when its file changes and notifies the components
+// watching their section, see Watch. It's a component watching the file while it's running,
+// Reload may be called anyway, e.g. on SIGHUP.
+//
+// The file is watched with fsnotify as viper's WatchConfig does, the reload is done under
+// the lock of Config since viper's one re-reads the file concurrently with the readers.
+type Watcher struct {
+	*cmpt.CptMetaSt
+	c     *Config
+	evts  *evc.EvtChans
+	delay time.Duration
+
+	mu   *sync.Mutex // guards subs
+	subs []*watch
+	rmu  *sync.Mutex // serializes the reloads
+}
+
+// NewWatcher returns the Watcher of c publishing the changes on evts, evts may be nil.
+// Accepted type of v as NewCptMetaSt, e.g. *mdl.CtrlSt.
+func NewWatcher(c *Config, evts *evc.EvtChans, v ...any) *Watcher {
+	w := &Watcher{
+		c:     c,
+		evts:  evts,
+		delay: defaultWatchDelay,
+		mu:    &sync.Mutex{},
+		rmu:   &sync.Mutex{},
+	}
+	v = append([]any{cmpt.KindName("config"), cmpt.IdName("watcher")}, v...)
+	w.CptMetaSt = cmpt.NewCptMetaSt(append(v, mdl.WorkerRecover(w))...)
+	return w
+}
+
+// WithDelay sets the delay coalescing the events of a file write before the reload.
+func (w *Watcher) WithDelay(delay time.Duration) *Watcher {
+	w.delay = delay
+	return w
+}
+
+// Watch reads the section of cp into a T and watches it: after a reload changing it,
+// the Change[T] is published on Topic(kind, id) and applied to cp.
+// The change is applied live if cp implements Reconfigurable[T] or its topic is subscribed,
+// otherwise the running cp is restarted through Stop and Start.
+// A section failing validation is reported by Reload and keeps its previous value.
+func Watch[T any](w *Watcher, cp cmpt.Cpt) (T, error) {
+	var cur T
+	if err := w.c.Cpt(cp, &cur); err != nil {
+		return cur, err
+	}
+
+	wt := &watch{kind: cp.Kind(), id: cp.Id()}
+	// cur is only used by the reloads, which are serialized
+	wt.reload = func() error {
+		var next T
+		if err := w.c.Cpt(cp, &next); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(cur, next) {
+			return nil
+		}
+		change := Change[T]{
+			Kind: wt.kind,
+			Id:   wt.id,
+			Old:  cur,
+			New:  next,
+			Keys: diffKeys("", reflect.ValueOf(cur), reflect.ValueOf(next)),
+		}
+		cur = next
+
+		topic := Topic(wt.kind, wt.id)
+		live := false
+		if w.evts != nil && w.evts.HasChansLen(topic) > 0 {
+			live = true
+			if err := w.evts.PublishAsync(w.Ctrl().Context(), defaultPublishTimeout, topic, change); err != nil {
+				w.Log().Warn("config change not delivered", "topic", topic, "err", err)
+			}
+		}
+		if r, ok := cp.(Reconfigurable[T]); ok {
+			err := r.Reconfigure(change)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, ErrRestart) {
+				return fmt.Errorf("config: reconfigure %s: %w", cp.CmptInfo(), err)
+			}
+			live = false
+		}
+		if live || !cp.IsRunning() {
+			return nil
+		}
+		w.Log().Info("restarting component to apply config", "component", cp.CmptInfo(), "keys", change.Keys)
+		if err := cmpt.Restart(cp); err != nil {
+			return fmt.Errorf("config: restart %s: %w", cp.CmptInfo(), err)
+		}
+		return nil
+	}
+
+	w.mu.Lock()
+	w.subs = append(w.subs, wt)
+	w.mu.Unlock()
+	return cur, nil
+}
+
+// Unwatch stops watching the section of cp.
+func (w *Watcher) Unwatch(cp cmpt.Cpt) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = slices.DeleteFunc(w.subs, func(wt *watch) bool {
+		return wt.kind == cp.Kind() && wt.id == cp.Id()
+	})
+}
+
+// Reload reads the config file again and applies the changes of the watched sections.
+// A file failing to parse keeps the previous config.
+func (w *Watcher) Reload() error {
+	w.rmu.Lock()
+	defer w.rmu.Unlock()
+	if err := w.c.Reload(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	subs := slices.Clone(w.subs)
+	w.mu.Unlock()
+
+	var err error
+	for _, wt := range subs {
+		if rerr := wt.reload(); rerr != nil {
+			err = multierror.Append(err, rerr)
+		}
+	}
+	return err
+}
+
+// Work watches the directory of the config file until the Watcher is stopped,
+// so that the file replaced by a rename or a symlink swap is still seen.
+func (w *Watcher) Work() error {
+	ctx := w.Ctrl().Context()
+	file := w.c.File()
+	if len(file) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.Log().Warn("config watch failed", "err", err)
+		return err
+	}
+	defer fw.Close()
+
+	file = filepath.Clean(file)
+	resolved, _ := filepath.EvalSymlinks(file)
+	if err := fw.Add(filepath.Dir(file)); err != nil {
+		w.Log().Warn("config watch failed", "file", file, "err", err)
+		return err
+	}
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			cur, _ := filepath.EvalSymlinks(file)
+			if (filepath.Clean(ev.Name) == file && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create))) ||
+				(len(cur) > 0 && cur != resolved) {
+				resolved = cur
+				fire = time.After(w.delay)
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.Log().Warn("config watch error", "err", err)
+		case <-fire:
+			fire = nil
+			_, sp := w.StartSpan("config.reload", "file", file)
+			err := w.Reload()
+			if err != nil {
+				w.Log().Warn("config reload failed", "file", file, "err", err)
+			}
+			sp.SetError(err)
+			sp.End()
+		}
+	}
+}
+
+// diffKeys returns the keys of the fields of the structs a and b that differ.
+func diffKeys(prefix string, a, b reflect.Value) (keys []string) {
+	if a.Kind() == reflect.Struct && a.Type() != timeType {
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, squash, skip := fieldKey(t.Field(i))
+			if skip {
+				continue
+			}
+			key := prefix
+			if !squash {
+				key = joinKey(prefix, name)
+			}
+			keys = append(keys, diffKeys(key, a.Field(i), b.Field(i))...)
+		}
+		return keys
+	}
+	if a.IsValid() && b.IsValid() && reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return nil
+	}
+	return []string{prefix}
+}
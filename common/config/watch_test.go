@@ -0,0 +1,174 @@
+package config_test
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"common/config"
+	cmpt "common/model/component"
+	evc "common/model/eventchans"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// liveSensor applies the poll interval live and needs a restart for the address.
+type liveSensor struct {
+	*cmpt.CptMetaSt
+	mu      sync.Mutex
+	changes []config.Change[sensorConf]
+}
+
+func (s *liveSensor) Reconfigure(change config.Change[sensorConf]) error {
+	s.mu.Lock()
+	s.changes = append(s.changes, change)
+	s.mu.Unlock()
+	if change.Changed("addr") {
+		return config.ErrRestart
+	}
+	return nil
+}
+
+func (s *liveSensor) Changes() []config.Change[sensorConf] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]config.Change[sensorConf](nil), s.changes...)
+}
+
+// countedSensor counts its runs, it can't apply a change live.
+type countedSensor struct {
+	*cmpt.CptMetaSt
+	runs atomic.Int32
+}
+
+func (s *countedSensor) Work() error {
+	s.runs.Add(1)
+	return s.CptMetaSt.Work()
+}
+
+const watchConf = `
+components:
+  sensor:
+    default:
+      poll: 2s
+    s1:
+      addr: 10.0.0.1
+    s2:
+      addr: 10.0.0.2
+`
+
+func TestWatchReload(t *testing.T) {
+	path := writeFile(t, "app.yaml", watchConf)
+	c, err := config.New(config.WithFile(path))
+	require.NoError(t, err)
+	evts := evc.NewEvtChans(10)
+	w := config.NewWatcher(c, evts)
+
+	s1 := &liveSensor{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("s1"), cmpt.KindName("sensor"))}
+	s2 := &countedSensor{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("s2"), cmpt.KindName("sensor"))}
+	s2.WorkerRecover = s2
+	cur, err := config.Watch[sensorConf](w, s1)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cur.Poll)
+	_, err = config.Watch[sensorConf](w, s2)
+	require.NoError(t, err)
+	ch := evts.Subscribe(config.Topic("sensor", "s1"))
+
+	require.NoError(t, s1.Start())
+	require.NoError(t, s2.Start())
+	assert.Eventually(t, func() bool { return s2.runs.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	// the poll interval of both, applied live by s1 and by a restart of s2
+	require.NoError(t, os.WriteFile(path, []byte(`
+components:
+  sensor:
+    default:
+      poll: 500ms
+    s1:
+      addr: 10.0.0.1
+    s2:
+      addr: 10.0.0.2
+`), 0o644))
+	require.NoError(t, w.Reload())
+
+	changes := s1.Changes()
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"poll"}, changes[0].Keys)
+	assert.Equal(t, 2*time.Second, changes[0].Old.Poll)
+	assert.Equal(t, 500*time.Millisecond, changes[0].New.Poll)
+	select {
+	case msg := <-ch:
+		assert.Equal(t, changes[0], msg)
+	default:
+		t.Fatal("change not published")
+	}
+	assert.Eventually(t, func() bool { return s2.runs.Load() == 2 }, time.Second, 5*time.Millisecond)
+	assert.True(t, s2.IsRunning())
+
+	// an invalid section is reported and keeps its value, a reload without change notifies nothing
+	require.NoError(t, os.WriteFile(path, []byte(`
+components:
+  sensor:
+    default:
+      poll: 500ms
+    s1:
+      addr: 10.0.0.1
+      unit: K
+    s2:
+      addr: 10.0.0.2
+`), 0o644))
+	assert.ErrorContains(t, w.Reload(), "config: unit must be one of [C F], got K")
+	assert.Len(t, s1.Changes(), 1)
+	assert.Equal(t, int32(2), s2.runs.Load())
+
+	// ErrRestart restarts a Reconfigurable component
+	w.Unwatch(s2)
+	require.NoError(t, os.WriteFile(path, []byte(`
+components:
+  sensor:
+    s1:
+      addr: 10.0.0.9
+`), 0o644))
+	require.NoError(t, w.Reload())
+	changes = s1.Changes()
+	require.Len(t, changes, 2)
+	assert.ElementsMatch(t, []string{"poll", "addr"}, changes[1].Keys)
+	assert.True(t, s1.IsRunning())
+	assert.NoError(t, s1.Ctrl().Context().Err())
+	assert.Equal(t, int32(2), s2.runs.Load())
+
+	for _, cp := range []cmpt.CptRoot{s1, s2} {
+		require.NoError(t, cp.Stop())
+		require.NoError(t, cp.Finalize())
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := writeFile(t, "app.yaml", watchConf)
+	c, err := config.New(config.WithFile(path))
+	require.NoError(t, err)
+	w := config.NewWatcher(c, nil).WithDelay(10 * time.Millisecond)
+
+	s1 := &liveSensor{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("s1"), cmpt.KindName("sensor"))}
+	_, err = config.Watch[sensorConf](w, s1)
+	require.NoError(t, err)
+	require.NoError(t, w.Start())
+	// let the watch be set up before the write
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+components:
+  sensor:
+    s1:
+      addr: 10.0.0.1
+      poll: 3s
+`), 0o644))
+	assert.Eventually(t, func() bool { return len(s1.Changes()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3*time.Second, s1.Changes()[0].New.Poll)
+
+	require.NoError(t, w.Stop())
+	require.NoError(t, w.Finalize())
+}
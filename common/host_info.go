@@ -0,0 +1,266 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrHostInfo = errors.New("os info: not available")
+)
+
+// OSRelease is the distribution read from /etc/os-release.
+type OSRelease struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	VersionID  string `json:"version_id,omitempty"`
+	PrettyName string `json:"pretty_name,omitempty"`
+}
+
+// DiskUsage is the usage of the filesystem holding Path, in bytes.
+type DiskUsage struct {
+	Path  string `json:"path"`
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`  // 包括root保留的空间
+	Avail uint64 `json:"avail"` // 非特权用户可用的空间
+	Used  uint64 `json:"used"`
+}
+
+// NetInterface is a network interface with its hardware and IP addresses.
+type NetInterface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	MTU   int      `json:"mtu,omitempty"`
+	Flags string   `json:"flags,omitempty"`
+	IPs   []string `json:"ips,omitempty"` // CIDR形式 如 192.168.1.2/24
+}
+
+// BuildInfo is the Go build information of the running binary.
+type BuildInfo struct {
+	GoVersion   string    `json:"go_version,omitempty"`
+	Path        string    `json:"path,omitempty"`    // main包的路径
+	Module      string    `json:"module,omitempty"`  // main模块的路径
+	Version     string    `json:"version,omitempty"` // main模块的版本 本地构建为(devel)
+	VCS         string    `json:"vcs,omitempty"`
+	VCSRevision string    `json:"vcs_revision,omitempty"`
+	VCSTime     time.Time `json:"vcs_time,omitempty"`
+	VCSModified bool      `json:"vcs_modified,omitempty"` // 构建时工作区有未提交的修改
+}
+
+// hostReader reads the host information from the files of /proc and /etc under root.
+type hostReader struct {
+	root string
+}
+
+func (h hostReader) path(p string) string {
+	if len(h.root) == 0 {
+		return p
+	}
+	return filepath.Join(h.root, p)
+}
+
+func (h hostReader) readString(p string) (string, error) {
+	bs, err := os.ReadFile(h.path(p))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrHostInfo, err)
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+func (h hostReader) kernelVersion() (string, error) {
+	return h.readString("/proc/sys/kernel/osrelease")
+}
+
+// machineID reads /etc/machine-id, or the D-Bus one of older systems.
+func (h hostReader) machineID() (string, error) {
+	id, err := h.readString("/etc/machine-id")
+	if err != nil {
+		if id, derr := h.readString("/var/lib/dbus/machine-id"); derr == nil {
+			return id, nil
+		}
+	}
+	return id, err
+}
+
+// osRelease parses /etc/os-release, or /usr/lib/os-release where the former is missing.
+func (h hostReader) osRelease() (OSRelease, error) {
+	var rel OSRelease
+	s, err := h.readString("/etc/os-release")
+	if err != nil {
+		var lerr error
+		if s, lerr = h.readString("/usr/lib/os-release"); lerr != nil {
+			return rel, err
+		}
+	}
+	for _, line := range strings.Split(s, "\n") {
+		// KEY=value, the value may be quoted
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(k, "#") {
+			continue
+		}
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		} else {
+			v = strings.Trim(v, `'"`)
+		}
+		switch k {
+		case "ID":
+			rel.ID = v
+		case "NAME":
+			rel.Name = v
+		case "VERSION":
+			rel.Version = v
+		case "VERSION_ID":
+			rel.VersionID = v
+		case "PRETTY_NAME":
+			rel.PrettyName = v
+		}
+	}
+	return rel, nil
+}
+
+// bootTime reads the btime line of /proc/stat.
+func (h hostReader) bootTime() (time.Time, error) {
+	f, err := os.Open(h.path("/proc/stat"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrHostInfo, err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%w: btime %v", ErrHostInfo, err)
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: no btime in /proc/stat", ErrHostInfo)
+}
+
+// uptime reads the first field of /proc/uptime, in seconds.
+func (h hostReader) uptime() (time.Duration, error) {
+	s, err := h.readString("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%w: empty /proc/uptime", ErrHostInfo)
+	}
+	sec, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: uptime %v", ErrHostInfo, err)
+	}
+	return time.Duration(sec * float64(time.Second)).Truncate(time.Second), nil
+}
+
+// memInfo reads MemTotal and MemAvailable of /proc/meminfo, in bytes.
+func (h hostReader) memInfo() (total, avail uint64, err error) {
+	f, err := os.Open(h.path("/proc/meminfo"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrHostInfo, err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// MemTotal:       16303428 kB
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok || (k != "MemTotal" && k != "MemAvailable") {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[0], 10, 64)
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		if k == "MemTotal" {
+			total = n
+		} else {
+			avail = n
+		}
+	}
+	return total, avail, sc.Err()
+}
+
+// diskUsages returns the usage of the filesystems of paths, skipping the ones that can't be read.
+func diskUsages(paths []string) ([]DiskUsage, error) {
+	var (
+		disks []DiskUsage
+		errs  []error
+	)
+	for _, p := range paths {
+		du, err := diskUsage(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: disk usage of %s: %v", ErrHostInfo, p, err))
+			continue
+		}
+		disks = append(disks, du)
+	}
+	return disks, errors.Join(errs...)
+}
+
+// netInterfaces returns the interfaces that are up, the loopback excluded.
+func netInterfaces() ([]NetInterface, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHostInfo, err)
+	}
+	var nis []NetInterface
+	for _, ifc := range ifs {
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ni := NetInterface{
+			Name:  ifc.Name,
+			MAC:   ifc.HardwareAddr.String(),
+			MTU:   ifc.MTU,
+			Flags: ifc.Flags.String(),
+		}
+		if addrs, err := ifc.Addrs(); err == nil {
+			for _, a := range addrs {
+				ni.IPs = append(ni.IPs, a.String())
+			}
+		}
+		nis = append(nis, ni)
+	}
+	return nis, nil
+}
+
+func readBuildInfo() BuildInfo {
+	var b BuildInfo
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.GoVersion = bi.GoVersion
+	b.Path = bi.Path
+	b.Module = bi.Main.Path
+	b.Version = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs":
+			b.VCS = s.Value
+		case "vcs.revision":
+			b.VCSRevision = s.Value
+		case "vcs.time":
+			b.VCSTime, _ = time.Parse(time.RFC3339, s.Value)
+		case "vcs.modified":
+			b.VCSModified = s.Value == "true"
+		}
+	}
+	return b
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package common
+
+import (
+	"syscall"
+)
+
+func diskUsage(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	du := DiskUsage{
+		Path:  path,
+		Total: st.Blocks * bsize,
+		Free:  st.Bfree * bsize,
+		Avail: st.Bavail * bsize,
+	}
+	du.Used = du.Total - du.Free
+	return du, nil
+}
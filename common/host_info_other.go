@@ -0,0 +1,11 @@
+//go:build !linux
+
+package common
+
+import (
+	"errors"
+)
+
+func diskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.ErrUnsupported
+}
@@ -0,0 +1,263 @@
+package log
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"common/model/clock"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// message of the entry written after the async writer dropped entries
+	DroppedMessage = "log entries dropped by the async writer"
+	DroppedKey     = "dropped"
+
+	defaultAsyncSize          = 4096
+	defaultAsyncFlushInterval = time.Second
+)
+
+var (
+	ErrAsyncClosed = errors.New("log: async writer is closed")
+
+	//Verify Satisfies interfaces
+	_ zapcore.WriteSyncer = (*AsyncWriter)(nil)
+)
+
+// AsyncConf makes the log files written by a background goroutine,
+// so that a stalled storage does not stall the goroutines that log.
+type AsyncConf struct {
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable" desc:"buffer the writes of the log files"`
+	// 缓冲的日志条数 满了之后丢弃新的日志 并在之后输出丢弃的条数
+	Size int `mapstructure:"size" json:"size" yaml:"size" default:"4096" validate:"min=0" desc:"number of buffered entries"`
+	// 定期刷新的间隔
+	FlushInterval time.Duration `mapstructure:"flush-interval" json:"flush-interval" yaml:"flush-interval" default:"1s" validate:"min=0s" desc:"interval of the periodic flush"`
+}
+
+func (ac *AsyncConf) Validate() error {
+	if ac.Size < 0 || ac.FlushInterval < 0 {
+		return errors.New("log: async size flush-interval must not be negative")
+	}
+	return nil
+}
+
+// AsyncWriter buffers the entries in a bounded ring and writes them to the wrapped
+// WriteSyncer in batches from its own goroutine, every flush interval or when the ring is half full.
+// Write never blocks on the wrapped writer, the entries are dropped when the ring is full
+// and an entry with their number is written with the next batch.
+// Sync writes the buffered entries and syncs the wrapped writer before it returns.
+type AsyncWriter struct {
+	ws       zapcore.WriteSyncer
+	closer   func() error
+	interval time.Duration
+	clk      clock.Clock
+
+	mu     *sync.Mutex // guards the ring, enc and closed
+	ring   [][]byte
+	head   int
+	n      int
+	enc    zapcore.Encoder // encodes the dropped entry
+	closed bool
+	each   bool // 逐条写入 不合并成一批
+
+	wmu     *sync.Mutex // serializes the writes to ws
+	dropped atomic.Uint64
+	total   atomic.Uint64
+
+	wake chan struct{}
+	done chan struct{}
+	wg   *sync.WaitGroup
+}
+
+// NewAsyncWriter starts the writer of ws, closer is called by Close after the last flush and may be nil.
+func NewAsyncWriter(ws zapcore.WriteSyncer, closer func() error, conf AsyncConf, clk clock.Clock) *AsyncWriter {
+	size := conf.Size
+	if size <= 0 {
+		size = defaultAsyncSize
+	}
+	interval := conf.FlushInterval
+	if interval <= 0 {
+		interval = defaultAsyncFlushInterval
+	}
+
+	w := &AsyncWriter{
+		ws:       ws,
+		closer:   closer,
+		interval: interval,
+		clk:      clock.OrReal(clk),
+		mu:       &sync.Mutex{},
+		ring:     make([][]byte, size),
+		enc:      zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		wmu:      &sync.Mutex{},
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		wg:       &sync.WaitGroup{},
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+// SetEncoder sets the encoder of the dropped entry, so that it's in the format of the other entries.
+func (w *AsyncWriter) SetEncoder(enc zapcore.Encoder) *AsyncWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc = enc.Clone()
+	return w
+}
+
+// WriteEach writes the entries to the wrapped writer one by one instead of in a batch,
+// for the writers sending each write as a message, e.g. SyslogWriter.
+func (w *AsyncWriter) WriteEach() *AsyncWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.each = true
+	return w
+}
+
+// Dropped returns the number of entries dropped since the writer was created.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.total.Load()
+}
+
+// Buffered returns the number of entries waiting to be written.
+func (w *AsyncWriter) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Write copies p into the ring, p is dropped if the ring is full.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrAsyncClosed
+	}
+	if w.n == len(w.ring) {
+		w.mu.Unlock()
+		w.dropped.Add(1)
+		w.total.Add(1)
+		w.signal()
+		return len(p), nil
+	}
+	i := (w.head + w.n) % len(w.ring)
+	w.ring[i] = append(w.ring[i][:0], p...)
+	w.n++
+	half := w.n == len(w.ring)/2
+	w.mu.Unlock()
+
+	if half {
+		w.signal()
+	}
+	return len(p), nil
+}
+
+// Sync writes the buffered entries and syncs the wrapped writer.
+func (w *AsyncWriter) Sync() error {
+	w.wmu.Lock()
+	defer w.wmu.Unlock()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.ws.Sync()
+}
+
+// Close stops the goroutine, writes the buffered entries and closes the wrapped writer.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	err := w.Sync()
+	if w.closer != nil {
+		if cerr := w.closer(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (w *AsyncWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *AsyncWriter) loop() {
+	defer w.wg.Done()
+	ticker := w.clk.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		w.wmu.Lock()
+		_ = w.flush()
+		w.wmu.Unlock()
+	}
+}
+
+// flush drains the ring into one batch and writes it, or writes its entries one by one. must hold w.wmu
+func (w *AsyncWriter) flush() error {
+	w.mu.Lock()
+	size := 0
+	for k := 0; k < w.n; k++ {
+		size += len(w.ring[(w.head+k)%len(w.ring)])
+	}
+	batch := make([]byte, 0, size)
+	var ends []int // the end of each entry in batch
+	for ; w.n > 0; w.n-- {
+		batch = append(batch, w.ring[w.head]...)
+		ends = append(ends, len(batch))
+		w.head = (w.head + 1) % len(w.ring)
+	}
+	w.head = 0
+	enc, each := w.enc, w.each
+	w.mu.Unlock()
+
+	if n := w.dropped.Swap(0); n > 0 {
+		buf, err := enc.EncodeEntry(zapcore.Entry{
+			Level:   zapcore.WarnLevel,
+			Time:    w.clk.Now(),
+			Message: DroppedMessage,
+		}, []zapcore.Field{zap.Uint64(DroppedKey, n)})
+		if err == nil {
+			batch = append(batch, buf.Bytes()...)
+			ends = append(ends, len(batch))
+			buf.Free()
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if !each {
+		_, err := w.ws.Write(batch)
+		return err
+	}
+	var err error
+	start := 0
+	for _, end := range ends {
+		if _, werr := w.ws.Write(batch[start:end]); werr != nil && err == nil {
+			err = werr
+		}
+		start = end
+	}
+	return err
+}
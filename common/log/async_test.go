@@ -0,0 +1,114 @@
+package log_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"common/log"
+	"common/model/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// stallWriter blocks the writes until it's released, like a stalled flash.
+type stallWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *stallWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *stallWriter) Sync() error { return nil }
+
+func (w *stallWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriterDropOnFull(t *testing.T) {
+	sw := &stallWriter{release: make(chan struct{})}
+	aw := log.NewAsyncWriter(sw, nil, log.AsyncConf{Size: 4, FlushInterval: time.Hour}, nil)
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), aw, zap.DebugLevel))
+
+	// the writes don't block while the storage is stalled
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			logger.Info("entry", zap.Int("i", i))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on the stalled writer")
+	}
+	assert.Greater(t, aw.Dropped(), uint64(90))
+
+	close(sw.release)
+	require.NoError(t, aw.Close())
+	out := sw.String()
+	lines := strings.Count(out, `"msg":"entry"`)
+	assert.Equal(t, uint64(100-lines), aw.Dropped())
+	assert.Contains(t, out, `"msg":"`+log.DroppedMessage+`"`)
+	assert.Contains(t, out, `"i":0`)
+
+	_, err := aw.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, log.ErrAsyncClosed)
+}
+
+func TestAsyncWriterPeriodicFlush(t *testing.T) {
+	sw := &stallWriter{release: make(chan struct{})}
+	close(sw.release)
+	fc := clock.NewFake(time.Time{})
+	aw := log.NewAsyncWriter(sw, nil, log.AsyncConf{Size: 16, FlushInterval: time.Second}, fc)
+	defer aw.Close()
+
+	fc.BlockUntil(1)
+	_, err := aw.Write([]byte("one\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, aw.Buffered())
+	assert.Empty(t, sw.String())
+
+	fc.Advance(time.Second)
+	assert.Eventually(t, func() bool { return sw.String() == "one\n" }, time.Second, time.Millisecond)
+	assert.Zero(t, aw.Buffered())
+}
+
+func TestNewAsync(t *testing.T) {
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "info",
+		Director: dir,
+		Format:   "json",
+		Rotated:  log.RotatedConf{Filename: "async.log"},
+		Async:    log.AsyncConf{Enable: true, FlushInterval: time.Hour},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	logger.Info("buffered")
+	assert.NotContains(t, readFile(t, filepath.Join(dir, "async.log")), "buffered")
+	require.NoError(t, log.Sync())
+	assert.Contains(t, readFile(t, filepath.Join(dir, "async.log")), "buffered")
+
+	conf.Async.Size = -1
+	_, err = log.New(conf)
+	assert.ErrorContains(t, err, "async")
+}
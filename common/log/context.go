@@ -0,0 +1,58 @@
+package log
+
+import (
+	"context"
+
+	mdl "common/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// structured field keys of the trace carried by the context
+	TraceKey = "trace"
+	SpanKey  = "span"
+)
+
+// WithContext returns a copy of ctx carrying logger, see Ctx.
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return mdl.ContextWithLogger(ctx, logger)
+}
+
+// Ctx returns the logger carried by ctx, or mdl.Zap() if there is none,
+// with the trace fields of ctx.
+func Ctx(ctx context.Context) *zap.Logger {
+	l := mdl.LoggerFromContext(ctx)
+	if l == nil {
+		l = mdl.Zap()
+	}
+	if fs := TraceFields(ctx); len(fs) > 0 {
+		return l.With(fs...)
+	}
+	return l
+}
+
+// TraceFields returns the fields of the trace carried by ctx.
+func TraceFields(ctx context.Context) []zap.Field {
+	tr, ok := mdl.TraceFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return traceFields(tr)
+}
+
+func traceFields(tr mdl.Trace) []zap.Field {
+	fs := make([]zap.Field, 0, 2)
+	if len(tr.TraceID) > 0 {
+		fs = append(fs, zap.String(TraceKey, tr.TraceID))
+	}
+	if len(tr.SpanID) > 0 {
+		fs = append(fs, zap.String(SpanKey, tr.SpanID))
+	}
+	return fs
+}
+
+// WithTrace returns logger with the fields of tr.
+func WithTrace(logger *zap.Logger, tr mdl.Trace) *zap.Logger {
+	return logger.With(traceFields(tr)...)
+}
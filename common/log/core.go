@@ -0,0 +1,300 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	mdl "common/model"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ zapcore.Core        = (*levelCore)(nil)
+	_ zapcore.Core        = (*reloadCore)(nil)
+	_ zapcore.Core        = (*inflightCore)(nil)
+	_ zapcore.WriteSyncer = (*errorOutput)(nil)
+)
+
+// levelCore filters the entries by the Levels of their logger name,
+// the wrapped core must not be stricter than Levels.Floor().
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func newLevelCore(core zapcore.Core, levels *Levels) zapcore.Core {
+	return &levelCore{Core: core, levels: levels}
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.levels.Floor().Enabled(lvl) && c.Core.Enabled(lvl)
+}
+
+// Level implements the zapcore leveledEnabler, so that zap.Logger.Level() works.
+func (c *levelCore) Level() zapcore.Level {
+	return zapcore.LevelOf(c.levels.Floor())
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.Enabled(ent.LoggerName, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// coreHolder holds the current core built from LogConf,
+// all the reloadCore created from it switch to the new core after swap.
+type coreHolder struct {
+	mu       *sync.Mutex // guards swap close closed
+	cur      atomic.Pointer[coreGen]
+	closed   bool
+	retiring *sync.WaitGroup // 等待关闭的旧core
+}
+
+// coreGen is a core built from LogConf with the closers of its writers.
+// Its writers are closed once it is replaced and the entries checked on it are written.
+type coreGen struct {
+	core    zapcore.Core
+	closers []func() error
+	// 持有者的1个引用加上已Check未Write的条目数 为0时关闭drained
+	refs    atomic.Int64
+	drained chan struct{}
+}
+
+func newCoreGen(core zapcore.Core, closers []func() error) *coreGen {
+	g := &coreGen{core: core, closers: closers, drained: make(chan struct{})}
+	g.refs.Store(1)
+	return g
+}
+
+// acquire counts an entry in flight, false if the core is drained.
+func (g *coreGen) acquire() bool {
+	for {
+		n := g.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if g.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (g *coreGen) release() {
+	if g.refs.Add(-1) == 0 {
+		close(g.drained)
+	}
+}
+
+func newCoreHolder(core zapcore.Core, closers ...func() error) *coreHolder {
+	h := &coreHolder{mu: &sync.Mutex{}, retiring: &sync.WaitGroup{}}
+	h.cur.Store(newCoreGen(core, closers))
+	return h
+}
+
+func (h *coreHolder) load() zapcore.Core {
+	return h.cur.Load().core
+}
+
+// acquire returns the current core with an entry in flight counted,
+// false if the holder is closed and the entry is not counted.
+func (h *coreHolder) acquire() (*coreGen, bool) {
+	for {
+		g := h.cur.Load()
+		if g.acquire() {
+			return g, true
+		}
+		// 已被替换时重试新的core 否则已关闭
+		if g == h.cur.Load() {
+			return g, false
+		}
+	}
+}
+
+// swap replaces the core and syncs the old one. The writers of the old core are closed
+// once the entries checked on it before the swap are written.
+func (h *coreHolder) swap(core zapcore.Core, closers ...func() error) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return runClosers(closers)
+	}
+	old := h.cur.Swap(newCoreGen(core, closers))
+	h.retiring.Add(1)
+	h.mu.Unlock()
+
+	err := old.core.Sync()
+	old.release()
+	go h.retire(old)
+	return err
+}
+
+// retire closes the writers of an old core once its entries in flight are written.
+func (h *coreHolder) retire(g *coreGen) {
+	defer h.retiring.Done()
+	<-g.drained
+	// 同步替换后才写入的条目
+	err := g.core.Sync()
+	if cerr := runClosers(g.closers); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		mdl.Log().Warn("log close of the replaced writers failed", "err", err)
+	}
+}
+
+// close waits for the entries in flight, syncs the core and closes its writers,
+// then waits for the old cores to be closed. The entries checked afterwards are still
+// written to the closed writers.
+func (h *coreHolder) close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	g := h.cur.Load()
+	h.mu.Unlock()
+
+	g.release()
+	<-g.drained
+	err := g.core.Sync()
+	if cerr := runClosers(g.closers); cerr != nil && err == nil {
+		err = cerr
+	}
+	h.retiring.Wait()
+	return err
+}
+
+// runClosers calls all the closers and returns the first error.
+func runClosers(closers []func() error) (err error) {
+	for _, cl := range closers {
+		if cerr := cl(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// reloadCore delegates to the current core of the holder
+// and replays its fields onto it whenever the holder is swapped.
+// The entries it checks are counted in flight until written, so that the writers
+// of a core are not closed before.
+type reloadCore struct {
+	h      *coreHolder
+	fields []zapcore.Field
+
+	cached atomic.Pointer[derivedCore]
+}
+
+type derivedCore struct {
+	core zapcore.Core
+	g    *coreGen
+}
+
+func newReloadCore(h *coreHolder) *reloadCore {
+	return &reloadCore{h: h}
+}
+
+// derive returns the core of g with the fields.
+func (c *reloadCore) derive(g *coreGen) zapcore.Core {
+	if d := c.cached.Load(); d != nil && d.g == g {
+		return d.core
+	}
+	core := g.core
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	c.cached.Store(&derivedCore{core: core, g: g})
+	return core
+}
+
+func (c *reloadCore) current() zapcore.Core {
+	return c.derive(c.h.cur.Load())
+}
+
+func (c *reloadCore) Enabled(lvl zapcore.Level) bool {
+	return c.current().Enabled(lvl)
+}
+
+func (c *reloadCore) With(fields []zapcore.Field) zapcore.Core {
+	fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	fs = append(fs, c.fields...)
+	fs = append(fs, fields...)
+	return &reloadCore{h: c.h, fields: fs}
+}
+
+func (c *reloadCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	g, ok := c.h.acquire()
+	core := c.derive(g)
+	if !ok {
+		return core.Check(ent, ce)
+	}
+	wce := core.Check(ent, nil)
+	if wce == nil {
+		g.release()
+		return ce
+	}
+	return ce.AddCore(ent, &inflightCore{Core: core, ce: wce, g: g})
+}
+
+func (c *reloadCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	g, ok := c.h.acquire()
+	if ok {
+		defer g.release()
+	}
+	return c.derive(g).Write(ent, fields)
+}
+
+func (c *reloadCore) Sync() error {
+	return c.current().Sync()
+}
+
+// inflightCore writes an entry checked by a reloadCore on its core,
+// and releases the core afterwards.
+type inflightCore struct {
+	zapcore.Core
+	ce *zapcore.CheckedEntry
+	g  *coreGen
+}
+
+func (c *inflightCore) Write(_ zapcore.Entry, fields []zapcore.Field) error {
+	defer c.g.release()
+	return writeChecked(c.ce, fields)
+}
+
+// writeChecked writes the nested ce and returns the errors of its cores,
+// so that the CheckedEntry of the logger reports them.
+func writeChecked(ce *zapcore.CheckedEntry, fields []zapcore.Field) error {
+	out := &errorOutput{}
+	ce.ErrorOutput = out
+	ce.Write(fields...)
+	return out.err
+}
+
+// errorOutput keeps the errors written by a CheckedEntry.
+type errorOutput struct {
+	err error
+}
+
+func (o *errorOutput) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	// 去掉CheckedEntry添加的时间前缀
+	if _, m, ok := strings.Cut(msg, " write error: "); ok {
+		msg = m
+	}
+	o.err = errors.Join(o.err, errors.New(msg))
+	return len(p), nil
+}
+
+func (o *errorOutput) Sync() error {
+	return nil
+}
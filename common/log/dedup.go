@@ -0,0 +1,224 @@
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"common/model/clock"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// the deduplicator sweeps the expired keys beyond this size
+	maxDedupKeys = 1024
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ zapcore.Core = (*dedupCore)(nil)
+)
+
+// dedupCore collapses the repeats of a message into a summary entry.
+// The entries are the same message if their level, logger name, message and fields,
+// those added by With included, are the same.
+// The first entry of a message is written, the repeats within the window are counted
+// and summarized as "<message> (message repeated N times)" when the window is over,
+// by a timer armed while there are repeats, or earlier by the next entry of the message or Sync.
+// Sync stops the timer, so that a core replaced or closed is not written afterwards.
+type dedupCore struct {
+	zapcore.Core
+	dd  *deduper
+	enc zapcore.Encoder // 编码字段用于计算key 包含With的字段
+}
+
+type dedupKey struct {
+	level  zapcore.Level
+	name   string
+	msg    string
+	fields uint64 // 编码后字段的hash
+}
+
+type dedupEntry struct {
+	first  time.Time
+	last   zapcore.Entry
+	fields []zapcore.Field
+	repeat int
+	core   zapcore.Core // the core of the first entry, with its fields
+}
+
+type deduper struct {
+	window time.Duration
+	clk    clock.Clock
+
+	mu      *sync.Mutex // guards entries stop done
+	entries map[dedupKey]*dedupEntry
+	// 有定时器等待输出汇总时非nil 关闭stop停止等待的协程 协程退出时关闭done
+	stop, done chan struct{}
+}
+
+// NewDedupCore collapses the repeated messages of core within window.
+func NewDedupCore(core zapcore.Core, window time.Duration, clk clock.Clock) zapcore.Core {
+	return &dedupCore{
+		Core: core,
+		dd: &deduper{
+			window:  window,
+			clk:     clock.OrReal(clk),
+			mu:      &sync.Mutex{},
+			entries: make(map[dedupKey]*dedupEntry),
+		},
+		enc: zapcore.NewJSONEncoder(zapcore.EncoderConfig{}),
+	}
+}
+
+func (c *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &dedupCore{Core: c.Core.With(fields), dd: c.dd, enc: enc}
+}
+
+// Check adds the dedupCore, the fields of the entry are only known by Write.
+func (c *dedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *dedupCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	now := c.dd.clk.Now()
+	key := dedupKey{level: ent.Level, name: ent.LoggerName, msg: ent.Message, fields: c.hash(fields)}
+	var summaries []*dedupEntry
+
+	c.dd.mu.Lock()
+	if de, ok := c.dd.entries[key]; ok {
+		if now.Sub(de.first) < c.dd.window {
+			de.repeat++
+			de.last, de.fields = ent, fields
+			if c.dd.stop == nil {
+				c.dd.stop, c.dd.done = make(chan struct{}), make(chan struct{})
+				go c.dd.wait(c.dd.clk.NewTimer(de.first.Add(c.dd.window).Sub(now)), c.dd.stop, c.dd.done)
+			}
+			c.dd.mu.Unlock()
+			return nil
+		}
+		delete(c.dd.entries, key)
+		if de.repeat > 0 {
+			summaries = append(summaries, de)
+		}
+	}
+	if len(c.dd.entries) >= maxDedupKeys {
+		summaries = append(summaries, c.dd.expire(now, false)...)
+	}
+	c.dd.entries[key] = &dedupEntry{first: now, last: ent, fields: fields, core: c.Core}
+	c.dd.mu.Unlock()
+
+	writeSummaries(summaries)
+	// 经过下层core的Check 采样和限流仍然生效
+	if ce := c.Core.Check(ent, nil); ce != nil {
+		return writeChecked(ce, fields)
+	}
+	return nil
+}
+
+// hash returns the hash of the fields encoded with those added by With.
+func (c *dedupCore) hash(fields []zapcore.Field) uint64 {
+	buf, err := c.enc.EncodeEntry(zapcore.Entry{}, fields)
+	if err != nil {
+		return 0
+	}
+	defer buf.Free()
+	h := fnv.New64a()
+	_, _ = h.Write(buf.Bytes())
+	return h.Sum64()
+}
+
+// Sync writes the pending summaries and stops the timer, then syncs the core.
+func (c *dedupCore) Sync() error {
+	c.dd.mu.Lock()
+	summaries := c.dd.expire(c.dd.clk.Now(), true)
+	stop, done := c.dd.stop, c.dd.done
+	c.dd.stop, c.dd.done = nil, nil
+	c.dd.mu.Unlock()
+
+	if stop != nil {
+		// 等待协程退出 之后不再写入core
+		close(stop)
+		<-done
+	}
+	writeSummaries(summaries)
+	return c.Core.Sync()
+}
+
+// wait writes the summaries of the windows over when tm fires,
+// until there are no more repeats to summarize or stop is closed.
+func (dd *deduper) wait(tm *clock.Timer, stop, done chan struct{}) {
+	defer close(done)
+	for {
+		var now time.Time
+		select {
+		case now = <-tm.C:
+		case <-stop:
+			tm.Stop()
+			return
+		}
+		dd.mu.Lock()
+		if dd.stop != stop {
+			// Sync停止了等待 汇总由Sync输出
+			dd.mu.Unlock()
+			return
+		}
+		summaries := dd.expire(now, false)
+		dd.mu.Unlock()
+		writeSummaries(summaries)
+
+		dd.mu.Lock()
+		if dd.stop != stop {
+			dd.mu.Unlock()
+			return
+		}
+		// 下一个有重复的窗口结束时再次输出
+		var next time.Time
+		for _, de := range dd.entries {
+			if end := de.first.Add(dd.window); de.repeat > 0 && (next.IsZero() || end.Before(next)) {
+				next = end
+			}
+		}
+		if next.IsZero() {
+			dd.stop, dd.done = nil, nil
+			dd.mu.Unlock()
+			return
+		}
+		tm = dd.clk.NewTimer(next.Sub(now))
+		dd.mu.Unlock()
+	}
+}
+
+// expire removes the entries whose window is over, or all entries if all is true,
+// and returns those with repeats to summarize. must hold dd.mu
+func (dd *deduper) expire(now time.Time, all bool) (summaries []*dedupEntry) {
+	for k, de := range dd.entries {
+		if !all && now.Sub(de.first) < dd.window {
+			continue
+		}
+		delete(dd.entries, k)
+		if de.repeat > 0 {
+			summaries = append(summaries, de)
+		}
+	}
+	return summaries
+}
+
+func writeSummaries(summaries []*dedupEntry) {
+	for _, de := range summaries {
+		ent := de.last
+		ent.Message = fmt.Sprintf("%s (message repeated %d times)", ent.Message, de.repeat)
+		if ce := de.core.Check(ent, nil); ce != nil {
+			ce.Write(de.fields...)
+		}
+	}
+}
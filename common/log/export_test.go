@@ -0,0 +1,15 @@
+package log
+
+import "time"
+
+// SetMegabyte changes the size unit of RotatedConf for testing and returns the restore func.
+func SetMegabyte(n int64) func() {
+	old := megabyte
+	megabyte = n
+	return func() { megabyte = old }
+}
+
+// PeriodOf returns the rotation period of w containing t.
+func PeriodOf(w *RotateWriter, t time.Time) (start, end time.Time) {
+	return w.periodOf(t)
+}
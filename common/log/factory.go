@@ -0,0 +1,133 @@
+package log
+
+import (
+	"strings"
+
+	mdl "common/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// structured field keys of the component loggers
+	KindKey    = "kind"
+	IdKey      = "id"
+	ParentsKey = "parents"
+	CtrlKey    = "ctrl"
+)
+
+var (
+	gFactory = NewFactory(nil)
+)
+
+// Factory creates the component loggers.
+// The logger of a component is named by its kind, so that its level can be
+// changed with SetNamedLevel(kind, ...), and carries the kind and id fields.
+// A Factory is immutable, Child returns the Factory for the sub components of a composite.
+type Factory struct {
+	base    *zap.Logger // nil means mdl.Zap() at the time the logger is created
+	parents []string    // kind:id of the composites from the root
+	lineage bool        // add the CtrlSt lineage field
+}
+
+// NewFactory returns a Factory creating loggers from base, nil base uses mdl.Zap().
+func NewFactory(base *zap.Logger) *Factory {
+	return &Factory{base: base}
+}
+
+// DefaultFactory returns the Factory used by components that are not given one.
+func DefaultFactory() *Factory {
+	gmu.RLock()
+	defer gmu.RUnlock()
+	return gFactory
+}
+
+// SetDefaultFactory replaces the Factory used by components created afterwards.
+func SetDefaultFactory(f *Factory) {
+	gmu.Lock()
+	defer gmu.Unlock()
+	if f == nil {
+		f = NewFactory(nil)
+	}
+	gFactory = f
+}
+
+// WithCtrlLineage returns a copy of the Factory that adds the CtrlSt lineage field.
+func (f *Factory) WithCtrlLineage(enable bool) *Factory {
+	nf := f.clone()
+	nf.lineage = enable
+	return nf
+}
+
+// Child returns the Factory for the sub components of the composite kind:id.
+func (f *Factory) Child(kind, id string) *Factory {
+	nf := f.clone()
+	nf.parents = append(nf.parents, kind+":"+id)
+	return nf
+}
+
+// Base returns the logger without component fields.
+func (f *Factory) Base() *zap.Logger {
+	if f.base == nil {
+		return mdl.Zap()
+	}
+	return f.base
+}
+
+// Cpt returns the logger of a component, ctrl may be nil.
+// The trace fields of ctrl are not added, as the trace changes with the context of ctrl.
+func (f *Factory) Cpt(kind, id string, ctrl *mdl.CtrlSt, fields ...zap.Field) *zap.Logger {
+	fs := make([]zap.Field, 0, 4+len(fields))
+	fs = append(fs, zap.String(KindKey, kind), zap.String(IdKey, id))
+	if len(f.parents) > 0 {
+		fs = append(fs, zap.String(ParentsKey, strings.Join(f.parents, "/")))
+	}
+	if f.lineage && ctrl != nil {
+		fs = append(fs, zap.String(CtrlKey, ctrl.Lineage()))
+	}
+	fs = append(fs, fields...)
+
+	l := f.Base()
+	if f.base == nil && ctrl != nil {
+		// a logger carried by the context of ctrl replaces mdl.Zap()
+		if cl := mdl.LoggerFromContext(ctrl.Context()); cl != nil {
+			l = cl
+		}
+	}
+	if len(kind) > 0 {
+		l = l.Named(kind)
+	}
+	return l.With(fs...)
+}
+
+// CptLog returns the library Logger of a component, ctrl may be nil.
+// It is the logger of Cpt unless the Factory has no base and the library Logger
+// is not backed by zap, e.g. set by ReplaceSlogGlobals, which then carries the kind and id.
+func (f *Factory) CptLog(kind, id string, ctrl *mdl.CtrlSt) mdl.Logger {
+	if f.base == nil {
+		if lg := mdl.Log(); !isZap(lg) {
+			kv := []any{KindKey, kind, IdKey, id}
+			if len(f.parents) > 0 {
+				kv = append(kv, ParentsKey, strings.Join(f.parents, "/"))
+			}
+			if f.lineage && ctrl != nil {
+				kv = append(kv, CtrlKey, ctrl.Lineage())
+			}
+			return lg.With(kv...)
+		}
+	}
+	return mdl.NewZapLogger(f.Cpt(kind, id, ctrl))
+}
+
+func isZap(lg mdl.Logger) bool {
+	_, ok := mdl.ZapOf(lg)
+	return ok
+}
+
+func (f *Factory) clone() *Factory {
+	return &Factory{
+		base:    f.base,
+		parents: append([]string{}, f.parents...),
+		lineage: f.lineage,
+	}
+}
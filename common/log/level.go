@@ -0,0 +1,206 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// 全局的动态日志级别 所有InitLogger和Zap创建的logger共享
+	gLevels = NewLevels(zapcore.InfoLevel)
+)
+
+// ParseLevel parses the LogConf level names,
+// an empty string means info and "warning" is accepted as an alias of "warn".
+func ParseLevel(s string) (zapcore.Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		return zapcore.InfoLevel, nil
+	case "warning":
+		return zapcore.WarnLevel, nil
+	}
+
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return l, fmt.Errorf("log: unrecognized level %q", s)
+	}
+	return l, nil
+}
+
+// Levels holds the global level and the per logger name overrides.
+// The name of a logger is the one given by zap.Logger.Named,
+// an override of "a" also applies to "a.b" unless "a.b" has its own.
+type Levels struct {
+	global zap.AtomicLevel
+	// floor is the lowest level of global and all named levels,
+	// the underlying cores are enabled from it and the names are filtered by levelCore.
+	floor zap.AtomicLevel
+
+	rwm   *sync.RWMutex // guards named
+	named map[string]zap.AtomicLevel
+}
+
+func NewLevels(lvl zapcore.Level) *Levels {
+	return &Levels{
+		global: zap.NewAtomicLevelAt(lvl),
+		floor:  zap.NewAtomicLevelAt(lvl),
+		rwm:    &sync.RWMutex{},
+		named:  make(map[string]zap.AtomicLevel),
+	}
+}
+
+// Global returns the AtomicLevel of loggers without a named override,
+// it can be served over HTTP with its ServeHTTP method.
+func (ls *Levels) Global() zap.AtomicLevel {
+	return ls.global
+}
+
+func (ls *Levels) Level() zapcore.Level {
+	return ls.global.Level()
+}
+
+func (ls *Levels) SetLevel(lvl zapcore.Level) {
+	ls.rwm.Lock()
+	defer ls.rwm.Unlock()
+	ls.global.SetLevel(lvl)
+	ls.updateFloor()
+}
+
+// SetNamedLevel overrides the level of the named logger and its children.
+func (ls *Levels) SetNamedLevel(name string, lvl zapcore.Level) {
+	ls.rwm.Lock()
+	defer ls.rwm.Unlock()
+	if al, ok := ls.named[name]; ok {
+		al.SetLevel(lvl)
+	} else {
+		ls.named[name] = zap.NewAtomicLevelAt(lvl)
+	}
+	ls.updateFloor()
+}
+
+// UnsetNamedLevel removes the override, the named logger follows the global level again.
+func (ls *Levels) UnsetNamedLevel(name string) {
+	ls.rwm.Lock()
+	defer ls.rwm.Unlock()
+	delete(ls.named, name)
+	ls.updateFloor()
+}
+
+// NamedLevels returns a copy of the overrides.
+func (ls *Levels) NamedLevels() map[string]zapcore.Level {
+	ls.rwm.RLock()
+	defer ls.rwm.RUnlock()
+	m := make(map[string]zapcore.Level, len(ls.named))
+	for k, v := range ls.named {
+		m[k] = v.Level()
+	}
+	return m
+}
+
+// ReplaceNamedLevels replaces all overrides at once, used by config reloading.
+func (ls *Levels) ReplaceNamedLevels(m map[string]zapcore.Level) {
+	ls.rwm.Lock()
+	defer ls.rwm.Unlock()
+	ls.named = make(map[string]zap.AtomicLevel, len(m))
+	for k, v := range m {
+		ls.named[k] = zap.NewAtomicLevelAt(v)
+	}
+	ls.updateFloor()
+}
+
+// LevelOf resolves the effective level of a logger name.
+func (ls *Levels) LevelOf(name string) zapcore.Level {
+	ls.rwm.RLock()
+	defer ls.rwm.RUnlock()
+	if len(ls.named) == 0 {
+		return ls.global.Level()
+	}
+	for n := name; ; {
+		if al, ok := ls.named[n]; ok {
+			return al.Level()
+		}
+		i := strings.LastIndexByte(n, '.')
+		if i < 0 {
+			break
+		}
+		n = n[:i]
+	}
+	return ls.global.Level()
+}
+
+// Enabled reports whether lvl is enabled for the logger name.
+func (ls *Levels) Enabled(name string, lvl zapcore.Level) bool {
+	return ls.LevelOf(name).Enabled(lvl)
+}
+
+// Floor returns the LevelEnabler for the underlying cores.
+func (ls *Levels) Floor() zapcore.LevelEnabler {
+	return ls.floor
+}
+
+func (ls *Levels) String() string {
+	named := ls.NamedLevels()
+	keys := make([]string, 0, len(named))
+	for k := range named {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("(levels)[global:")
+	sb.WriteString(ls.Level().String())
+	for _, k := range keys {
+		sb.WriteString(",")
+		sb.WriteString(k)
+		sb.WriteString(":")
+		sb.WriteString(named[k].String())
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// must hold ls.rwm
+func (ls *Levels) updateFloor() {
+	floor := ls.global.Level()
+	for _, al := range ls.named {
+		if l := al.Level(); l < floor {
+			floor = l
+		}
+	}
+	ls.floor.SetLevel(floor)
+}
+
+// GetLevels returns the package levels shared by InitLogger and Zap.
+func GetLevels() *Levels {
+	return gLevels
+}
+
+// SetLevel changes the global level at runtime.
+func SetLevel(lvl string) error {
+	l, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	gLevels.SetLevel(l)
+	return nil
+}
+
+// SetNamedLevel changes the level of one named logger at runtime.
+func SetNamedLevel(name, lvl string) error {
+	l, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	gLevels.SetNamedLevel(name, l)
+	return nil
+}
+
+func UnsetNamedLevel(name string) {
+	gLevels.UnsetNamedLevel(name)
+}
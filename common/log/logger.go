@@ -0,0 +1,222 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"common"
+	mdl "common/model"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	ErrConfNotFound = errors.New("log: config key not found")
+	// ErrSlogBackend is returned by New for the slog Backend without WithReplaceGlobals,
+	// the Backend selects the library Logger which only WithReplaceGlobals replaces.
+	ErrSlogBackend = errors.New("log: backend slog needs WithReplaceGlobals, or NewSlog")
+)
+
+// Option configures New.
+type Option func(*options)
+
+type options struct {
+	replaceGlobals bool
+	levels         *Levels
+	zapOpts        []zap.Option
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithReplaceGlobals makes New replace mdl.Zap(), the zap globals
+// and the default Factory so that the rest of the library logs through the new logger.
+// The logger follows the package conf and levels, and is rebuilt by ReloadLogConf and WatchLogConfig.
+// The slog Backend also replaces the slog default and the library Logger with a slog.Logger on the new logger.
+func WithReplaceGlobals() Option {
+	return func(o *options) {
+		o.replaceGlobals = true
+	}
+}
+
+// WithLevels makes the logger of New follow ls, set from the levels of LogConf,
+// so that its levels can be changed at runtime. It is ignored with WithReplaceGlobals.
+func WithLevels(ls *Levels) Option {
+	return func(o *options) {
+		o.levels = ls
+	}
+}
+
+// WithZapOptions adds zap options to the logger created by New.
+func WithZapOptions(opts ...zap.Option) Option {
+	return func(o *options) {
+		o.zapOpts = append(o.zapOpts, opts...)
+	}
+}
+
+// Validate checks LogConf and returns all the violations at once.
+func (conf *LogConf) Validate() (err error) {
+	if _, perr := ParseLevel(conf.Level); perr != nil {
+		err = multierror.Append(err, perr)
+	}
+	for name, lvl := range conf.NamedLevels {
+		if _, perr := ParseLevel(lvl); perr != nil {
+			err = multierror.Append(err, fmt.Errorf("log: named level %s: %w", name, perr))
+		}
+	}
+	switch conf.Backend {
+	case "", BackendZap, BackendSlog:
+	default:
+		err = multierror.Append(err, fmt.Errorf("log: unrecognized backend %q", conf.Backend))
+	}
+	switch conf.Format {
+	case "", "console", "json":
+	default:
+		err = multierror.Append(err, fmt.Errorf("log: unrecognized format %q", conf.Format))
+	}
+	switch conf.EncodeLevel {
+	case "", "LowercaseLevelEncoder", "LowercaseColorLevelEncoder", "CapitalLevelEncoder", "CapitalColorLevelEncoder":
+	default:
+		err = multierror.Append(err, fmt.Errorf("log: unrecognized encode-level %q", conf.EncodeLevel))
+	}
+	if !conf.LevelFiles && len(conf.Rotated.Filename) == 0 {
+		err = multierror.Append(err, errors.New("log: rotated-property.filename is empty"))
+	}
+	if conf.Rotated.MaxSize < 0 || conf.Rotated.MaxAge < 0 || conf.Rotated.MaxBackups < 0 {
+		err = multierror.Append(err, errors.New("log: rotated-property maxsize maxage maxbackups must not be negative"))
+	}
+	if rerr := conf.Rotated.Validate(); rerr != nil {
+		err = multierror.Append(err, rerr)
+	}
+	if serr := conf.Sampling.Validate(); serr != nil {
+		err = multierror.Append(err, serr)
+	}
+	if aerr := conf.Async.Validate(); aerr != nil {
+		err = multierror.Append(err, aerr)
+	}
+	if serr := conf.Sinks.Validate(); serr != nil {
+		err = multierror.Append(err, serr)
+	}
+	if rerr := conf.Redact.Validate(); rerr != nil {
+		err = multierror.Append(err, rerr)
+	}
+	return err
+}
+
+// New validates conf and creates the logger it describes, with its own levels from conf
+// unless WithReplaceGlobals is given. The package state is left unchanged otherwise.
+// LevelFiles selects the per level files of Zap, otherwise the single file of InitLogger.
+// The slog Backend is rejected with ErrSlogBackend without WithReplaceGlobals.
+func New(conf LogConf, opts ...Option) (*zap.Logger, error) {
+	o := newOptions(opts)
+	if conf.Backend == BackendSlog && !o.replaceGlobals {
+		return nil, ErrSlogBackend
+	}
+	return newLogger(conf, o)
+}
+
+// newLogger creates the logger of conf, the Backend only applies with replaceGlobals.
+func newLogger(conf LogConf, o *options) (*zap.Logger, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	conf.Director = common.DealWithExecutingCurrentFilePath(conf.Director)
+	if err := common.CreatePathDir(conf.Director); err != nil {
+		return nil, fmt.Errorf("log: create directory %s: %w", conf.Director, err)
+	}
+
+	build := buildLoggerCore
+	if conf.LevelFiles {
+		build = buildZapCore
+	}
+	var logger *zap.Logger
+	if o.replaceGlobals {
+		gmu.Lock()
+		glogconf = conf
+		applyLevels(gLevels, conf)
+		gmu.Unlock()
+		logger = newReloadableLogger(build)
+	} else {
+		levels := o.levels
+		if levels == nil {
+			levels = NewLevels(zapcore.InfoLevel)
+		}
+		applyLevels(levels, conf)
+		logger = newConfLogger(build, conf, levels)
+	}
+	if conf.CallerEnable || conf.ShowLine {
+		logger = logger.WithOptions(zap.AddCaller())
+	}
+	if len(o.zapOpts) > 0 {
+		logger = logger.WithOptions(o.zapOpts...)
+	}
+
+	if o.replaceGlobals {
+		ReplaceGlobals(logger)
+		if conf.Backend == BackendSlog {
+			ReplaceSlogGlobals(slog.New(NewZapHandler(logger.Core())))
+		}
+	}
+	return logger, nil
+}
+
+// FromViper reads LogConf under key of v and creates its logger with New,
+// an empty key uses "log_property". With WithReplaceGlobals, WatchLogConfig and InitLogConfig
+// read the key afterwards.
+func FromViper(v *viper.Viper, key string, opts ...Option) (*zap.Logger, error) {
+	if v == nil {
+		v = viper.GetViper()
+	}
+	if len(key) == 0 {
+		key = glogConfigTag
+	}
+	if !v.IsSet(key) {
+		return nil, fmt.Errorf("%w: %s", ErrConfNotFound, key)
+	}
+
+	var conf LogConf
+	if err := v.UnmarshalKey(key, &conf); err != nil {
+		return nil, fmt.Errorf("log: read config %s: %w", key, err)
+	}
+
+	logger, err := New(conf, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if newOptions(opts).replaceGlobals {
+		gmu.Lock()
+		gViper = v
+		glogConfigTag = key
+		gmu.Unlock()
+	}
+	return logger, nil
+}
+
+// ReplaceGlobals makes logger the library logger mdl.Zap() and the zap global logger,
+// the default Factory creates the component loggers from it afterwards.
+// The library Logger mdl.Log() is reset to the one of logger.
+func ReplaceGlobals(logger *zap.Logger) {
+	mdl.SetZap(logger)
+	zap.ReplaceGlobals(logger)
+	mdl.SetLog(nil)
+	SetDefaultFactory(NewFactory(nil))
+}
+
+// ReplaceSlogGlobals makes logger the slog default and the library Logger mdl.Log(),
+// the components created afterwards by the default Factory log through it.
+// mdl.Zap() and the Logger() of the components are left unchanged.
+func ReplaceSlogGlobals(logger *slog.Logger) {
+	slog.SetDefault(logger)
+	mdl.SetLog(mdl.NewSlogLogger(logger))
+}
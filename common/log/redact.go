@@ -0,0 +1,506 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	mdl "common/model"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultRedactMask = "******"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ zapcore.Encoder       = (*redactEncoder)(nil)
+	_ zapcore.ObjectEncoder = (*redactObjectEncoder)(nil)
+	_ zapcore.ArrayEncoder  = (*redactArrayEncoder)(nil)
+)
+
+// RedactConf masks the sensitive values before they are encoded.
+type RedactConf struct {
+	// 字段名 不区分大小写 该字段的值被替换 消息和字符串中的"key:value" "key=value"同样被替换
+	Keys []string `mapstructure:"keys" json:"keys" yaml:"keys" desc:"case-insensitive keys of the fields masked"`
+	// 正则表达式 有分组时替换分组 否则替换整个匹配
+	Patterns []string `mapstructure:"patterns" json:"patterns" yaml:"patterns" desc:"regexps masked in the messages and strings"`
+	// 替换的内容 默认为"******"
+	Mask string `mapstructure:"mask" json:"mask" yaml:"mask" desc:"replacement of the values masked, ****** by default"`
+}
+
+func (rc *RedactConf) Validate() (err error) {
+	for _, p := range rc.Patterns {
+		if _, perr := regexp.Compile(p); perr != nil {
+			err = multierror.Append(err, fmt.Errorf("log: redact pattern %q: %w", p, perr))
+		}
+	}
+	return err
+}
+
+// Redactor masks the configured keys and patterns in messages and fields.
+type Redactor struct {
+	mask     string
+	keys     map[string]struct{}
+	keyText  *regexp.Regexp // key:value and key=value in free text
+	patterns []*regexp.Regexp
+	all      bool // 配置无效时替换所有的值和消息 不泄露未脱敏的内容
+}
+
+// NewRedactor compiles conf, it returns nil if conf masks nothing.
+func NewRedactor(conf RedactConf) (*Redactor, error) {
+	if len(conf.Keys) == 0 && len(conf.Patterns) == 0 {
+		return nil, nil
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Redactor{mask: conf.Mask, keys: make(map[string]struct{}, len(conf.Keys))}
+	if len(r.mask) == 0 {
+		r.mask = defaultRedactMask
+	}
+	quoted := make([]string, 0, len(conf.Keys))
+	for _, k := range conf.Keys {
+		r.keys[strings.ToLower(k)] = struct{}{}
+		quoted = append(quoted, regexp.QuoteMeta(k))
+	}
+	if len(quoted) > 0 {
+		r.keyText = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") +
+			`)"?\s*[:=]\s*("[^"]*"|[^\s,;&"}\])]+)`)
+	}
+	for _, p := range conf.Patterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(p))
+	}
+	return r, nil
+}
+
+// Key reports whether the values of key are masked.
+func (r *Redactor) Key(key string) bool {
+	if r.all {
+		return true
+	}
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+// String masks the keys and the patterns found in s.
+func (r *Redactor) String(s string) string {
+	if r.all {
+		return r.mask
+	}
+	if r.keyText != nil {
+		s = r.replace(r.keyText, s)
+	}
+	for _, re := range r.patterns {
+		s = r.replace(re, s)
+	}
+	return s
+}
+
+// replace masks the groups of the matches of re, or the whole matches if re has no group.
+func (r *Redactor) replace(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		spans := m[2:]
+		if len(spans) == 0 {
+			spans = m[:2]
+		}
+		for i := 0; i+1 < len(spans); i += 2 {
+			start, end := spans[i], spans[i+1]
+			if start < last || start < 0 {
+				continue
+			}
+			sb.WriteString(s[last:start])
+			if end > start && s[start] == '"' && s[end-1] == '"' {
+				sb.WriteString(`"` + r.mask + `"`)
+			} else {
+				sb.WriteString(r.mask)
+			}
+			last = end
+		}
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// Fields returns fields with their sensitive values masked, fields is not modified.
+func (r *Redactor) Fields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		rf, changed := r.field(f)
+		if changed && out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		if out != nil {
+			out[i] = rf
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+func (r *Redactor) field(f zapcore.Field) (zapcore.Field, bool) {
+	if f.Type == zapcore.SkipType || f.Type == zapcore.NamespaceType {
+		return f, false
+	}
+	if r.Key(f.Key) {
+		return zap.String(f.Key, r.mask), true
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		if s := r.String(f.String); s != f.String {
+			return zap.String(f.Key, s), true
+		}
+	case zapcore.ByteStringType:
+		if s := r.String(string(f.Interface.([]byte))); s != string(f.Interface.([]byte)) {
+			return zap.ByteString(f.Key, []byte(s)), true
+		}
+	case zapcore.StringerType:
+		if st, ok := f.Interface.(fmt.Stringer); ok {
+			if raw, s := st.String(), r.String(st.String()); s != raw {
+				return zap.String(f.Key, s), true
+			}
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			if raw, s := err.Error(), r.String(err.Error()); s != raw {
+				return zap.String(f.Key, s), true
+			}
+		}
+	case zapcore.ReflectType:
+		return zap.Reflect(f.Key, r.value(f.Interface)), true
+	case zapcore.ObjectMarshalerType:
+		return zap.Object(f.Key, redactObject{m: f.Interface.(zapcore.ObjectMarshaler), r: r}), true
+	case zapcore.ArrayMarshalerType:
+		return zap.Array(f.Key, redactArray{m: f.Interface.(zapcore.ArrayMarshaler), r: r}), true
+	}
+	return f, false
+}
+
+// value masks a value of zap.Any through its JSON form, the value is kept if it's not JSON.
+func (r *Redactor) value(v any) any {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var generic any
+	if err = json.Unmarshal(bs, &generic); err != nil {
+		return v
+	}
+	return r.walk(generic)
+}
+
+func (r *Redactor) walk(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			if r.Key(k) {
+				t[k] = r.mask
+			} else {
+				t[k] = r.walk(e)
+			}
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = r.walk(e)
+		}
+	case string:
+		return r.String(t)
+	}
+	return v
+}
+
+// Encoder wraps enc so that it masks the entries and the fields added by With.
+func (r *Redactor) Encoder(enc zapcore.Encoder) zapcore.Encoder {
+	if r == nil {
+		return enc
+	}
+	return &redactEncoder{Encoder: enc, r: r}
+}
+
+// redactEncoder masks the message and the fields before the wrapped encoder encodes them.
+type redactEncoder struct {
+	zapcore.Encoder
+	r *Redactor
+}
+
+func (e *redactEncoder) obj() *redactObjectEncoder {
+	return &redactObjectEncoder{ObjectEncoder: e.Encoder, r: e.r}
+}
+
+func (e *redactEncoder) Clone() zapcore.Encoder {
+	return &redactEncoder{Encoder: e.Encoder.Clone(), r: e.r}
+}
+
+func (e *redactEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	ent.Message = e.r.String(ent.Message)
+	return e.Encoder.EncodeEntry(ent, e.r.Fields(fields))
+}
+
+// the fields added by With are encoded through these methods
+
+func (e *redactEncoder) AddString(k, v string)                 { e.obj().AddString(k, v) }
+func (e *redactEncoder) AddByteString(k string, v []byte)      { e.obj().AddByteString(k, v) }
+func (e *redactEncoder) AddBinary(k string, v []byte)          { e.obj().AddBinary(k, v) }
+func (e *redactEncoder) AddBool(k string, v bool)              { e.obj().AddBool(k, v) }
+func (e *redactEncoder) AddComplex128(k string, v complex128)  { e.obj().AddComplex128(k, v) }
+func (e *redactEncoder) AddComplex64(k string, v complex64)    { e.obj().AddComplex64(k, v) }
+func (e *redactEncoder) AddDuration(k string, v time.Duration) { e.obj().AddDuration(k, v) }
+func (e *redactEncoder) AddFloat64(k string, v float64)        { e.obj().AddFloat64(k, v) }
+func (e *redactEncoder) AddFloat32(k string, v float32)        { e.obj().AddFloat32(k, v) }
+func (e *redactEncoder) AddInt(k string, v int)                { e.obj().AddInt(k, v) }
+func (e *redactEncoder) AddInt64(k string, v int64)            { e.obj().AddInt64(k, v) }
+func (e *redactEncoder) AddInt32(k string, v int32)            { e.obj().AddInt32(k, v) }
+func (e *redactEncoder) AddInt16(k string, v int16)            { e.obj().AddInt16(k, v) }
+func (e *redactEncoder) AddInt8(k string, v int8)              { e.obj().AddInt8(k, v) }
+func (e *redactEncoder) AddTime(k string, v time.Time)         { e.obj().AddTime(k, v) }
+func (e *redactEncoder) AddUint(k string, v uint)              { e.obj().AddUint(k, v) }
+func (e *redactEncoder) AddUint64(k string, v uint64)          { e.obj().AddUint64(k, v) }
+func (e *redactEncoder) AddUint32(k string, v uint32)          { e.obj().AddUint32(k, v) }
+func (e *redactEncoder) AddUint16(k string, v uint16)          { e.obj().AddUint16(k, v) }
+func (e *redactEncoder) AddUint8(k string, v uint8)            { e.obj().AddUint8(k, v) }
+func (e *redactEncoder) AddUintptr(k string, v uintptr)        { e.obj().AddUintptr(k, v) }
+func (e *redactEncoder) AddReflected(k string, v any) error    { return e.obj().AddReflected(k, v) }
+func (e *redactEncoder) AddObject(k string, v zapcore.ObjectMarshaler) error {
+	return e.obj().AddObject(k, v)
+}
+func (e *redactEncoder) AddArray(k string, v zapcore.ArrayMarshaler) error {
+	return e.obj().AddArray(k, v)
+}
+
+// redactObjectEncoder masks the values added to a nested object.
+type redactObjectEncoder struct {
+	zapcore.ObjectEncoder
+	r *Redactor
+}
+
+// masked adds the mask as the value of k if k is a masked key.
+func (e *redactObjectEncoder) masked(k string) bool {
+	if !e.r.Key(k) {
+		return false
+	}
+	e.ObjectEncoder.AddString(k, e.r.mask)
+	return true
+}
+
+func (e *redactObjectEncoder) AddString(k, v string) {
+	if e.r.Key(k) {
+		v = e.r.mask
+	}
+	e.ObjectEncoder.AddString(k, e.r.String(v))
+}
+
+func (e *redactObjectEncoder) AddByteString(k string, v []byte) {
+	e.AddString(k, string(v))
+}
+
+func (e *redactObjectEncoder) AddBinary(k string, v []byte) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddBinary(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddBool(k string, v bool) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddBool(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddComplex128(k string, v complex128) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddComplex128(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddComplex64(k string, v complex64) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddComplex64(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddDuration(k string, v time.Duration) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddDuration(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddFloat64(k string, v float64) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddFloat64(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddFloat32(k string, v float32) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddFloat32(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt(k string, v int) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddInt(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt64(k string, v int64) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddInt64(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt32(k string, v int32) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddInt32(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt16(k string, v int16) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddInt16(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt8(k string, v int8) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddInt8(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddTime(k string, v time.Time) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddTime(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint(k string, v uint) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUint(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint64(k string, v uint64) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUint64(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint32(k string, v uint32) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUint32(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint16(k string, v uint16) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUint16(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint8(k string, v uint8) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUint8(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUintptr(k string, v uintptr) {
+	if !e.masked(k) {
+		e.ObjectEncoder.AddUintptr(k, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddReflected(k string, v any) error {
+	if e.masked(k) {
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(k, e.r.value(v))
+}
+
+func (e *redactObjectEncoder) AddObject(k string, v zapcore.ObjectMarshaler) error {
+	if e.masked(k) {
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(k, redactObject{m: v, r: e.r})
+}
+
+func (e *redactObjectEncoder) AddArray(k string, v zapcore.ArrayMarshaler) error {
+	if e.masked(k) {
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(k, redactArray{m: v, r: e.r})
+}
+
+// redactArrayEncoder masks the strings and the objects appended to a nested array.
+type redactArrayEncoder struct {
+	zapcore.ArrayEncoder
+	r *Redactor
+}
+
+func (e *redactArrayEncoder) AppendString(v string) {
+	e.ArrayEncoder.AppendString(e.r.String(v))
+}
+
+func (e *redactArrayEncoder) AppendByteString(v []byte) {
+	e.ArrayEncoder.AppendString(e.r.String(string(v)))
+}
+
+func (e *redactArrayEncoder) AppendReflected(v any) error {
+	return e.ArrayEncoder.AppendReflected(e.r.value(v))
+}
+
+func (e *redactArrayEncoder) AppendObject(v zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(redactObject{m: v, r: e.r})
+}
+
+func (e *redactArrayEncoder) AppendArray(v zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(redactArray{m: v, r: e.r})
+}
+
+type redactObject struct {
+	m zapcore.ObjectMarshaler
+	r *Redactor
+}
+
+func (o redactObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.m.MarshalLogObject(&redactObjectEncoder{ObjectEncoder: enc, r: o.r})
+}
+
+type redactArray struct {
+	m zapcore.ArrayMarshaler
+	r *Redactor
+}
+
+func (a redactArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return a.m.MarshalLogArray(&redactArrayEncoder{ArrayEncoder: enc, r: a.r})
+}
+
+// redactEncoderOf wraps enc with the Redactor of conf. New and ReloadLogConf reject an invalid
+// RedactConf, the loggers of an unvalidated one (InitLogger Zap) mask all the messages and values.
+func redactEncoderOf(conf *LogConf, enc zapcore.Encoder) zapcore.Encoder {
+	r, err := NewRedactor(conf.Redact)
+	if err != nil {
+		mdl.Log().Warn("log redact invalid, all the values masked", "err", err)
+		mask := conf.Redact.Mask
+		if len(mask) == 0 {
+			mask = defaultRedactMask
+		}
+		r = &Redactor{mask: mask, all: true}
+	}
+	return r.Encoder(enc)
+}
@@ -0,0 +1,147 @@
+package log_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"common/log"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type credential struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func (c credential) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("user", c.User)
+	enc.AddString("password", c.Password)
+	return nil
+}
+
+// pin is an object with the numeric and the time fields of a device.
+type pin struct{}
+
+func (pin) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt32("pin", 4321)
+	enc.AddUint16("port", 8080)
+	enc.AddFloat64("lat", 31.2304)
+	enc.AddBool("enabled", true)
+	enc.AddTime("expires", time.Unix(1700000000, 0))
+	return nil
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := log.NewRedactor(log.RedactConf{
+		Keys:     []string{"password", "token"},
+		Patterns: []string{`\b\d{4}-\d{4}-\d{4}-(\d{4})\b`, `secret-[a-z]+`},
+	})
+	require.NoError(t, err)
+
+	for _, enc := range []zapcore.Encoder{
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+	} {
+		buf := &bytes.Buffer{}
+		logger := zap.New(zapcore.NewCore(r.Encoder(enc), zapcore.AddSync(buf), zap.DebugLevel)).
+			With(zap.String("Token", "abc123"))
+
+		logger.Info(fmt.Sprintf("device %+v", credential{User: "dev1", Password: "hunter2"}),
+			zap.String("card", "1111-2222-3333-4444"),
+			zap.Object("cred", credential{User: "dev2", Password: "pw2"}),
+			zap.Any("creds", []credential{{User: "dev3", Password: "pw3"}}),
+			zap.Strings("notes", []string{"key secret-abc"}),
+			zap.Int64("password", 1234),
+		)
+
+		out := buf.String()
+		for _, leaked := range []string{"abc123", "hunter2", "4444", "pw2", "pw3", "secret-abc", "1234"} {
+			assert.NotContains(t, out, leaked)
+		}
+		for _, kept := range []string{"dev1", "dev2", "dev3", "1111-2222-3333-", "Password:******"} {
+			assert.Contains(t, out, kept)
+		}
+	}
+
+	// the keys of any type are masked, in the fields added by With and in the objects
+	r, err = log.NewRedactor(log.RedactConf{Keys: []string{"pin", "lat", "enabled", "expires", "timeout"}})
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = ""
+	logger := zap.New(zapcore.NewCore(r.Encoder(zapcore.NewJSONEncoder(enc)), zapcore.AddSync(buf), zap.DebugLevel)).
+		With(zap.Int32("pin", 1111), zap.Float64("lat", 48.8566), zap.Bool("enabled", false),
+			zap.Duration("timeout", 7*time.Second), zap.Uint8("level", 3))
+	logger.Info("paired", zap.Object("dev", pin{}))
+	out := buf.String()
+	for _, leaked := range []string{"1111", "48.8566", "false", "7", "4321", "31.2304", "true", "1700000000", "2023"} {
+		assert.NotContains(t, out, leaked)
+	}
+	assert.Contains(t, out, `"pin":"******","lat":"******","enabled":"******","timeout":"******","level":3`)
+	assert.Contains(t, out, `"dev":{"pin":"******","port":8080,"lat":"******","enabled":"******","expires":"******"}`)
+
+	_, err = log.NewRedactor(log.RedactConf{Patterns: []string{"("}})
+	assert.Error(t, err)
+	r, err = log.NewRedactor(log.RedactConf{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestNewRedact(t *testing.T) {
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "info",
+		Director: dir,
+		Format:   "json",
+		Rotated:  log.RotatedConf{Filename: "redact.log"},
+		Redact:   log.RedactConf{Keys: []string{"token"}, Mask: "[redacted]"},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	logger.Info("connect token=s3cr3t", zap.String("token", "s3cr3t"))
+	require.NoError(t, logger.Sync())
+	out := readFile(t, filepath.Join(dir, "redact.log"))
+	assert.NotContains(t, out, "s3cr3t")
+	assert.Contains(t, out, `"token":"[redacted]"`)
+	assert.Contains(t, out, `connect token=[redacted]`)
+
+	conf.Redact.Patterns = []string{"[z-a]"}
+	_, err = log.New(conf)
+	assert.ErrorContains(t, err, "redact pattern")
+	assert.ErrorContains(t, log.ReloadLogConf(conf), "redact pattern")
+}
+
+func TestRedactInvalidMasksAll(t *testing.T) {
+	// the deprecated loggers don't validate their conf, an invalid redaction masks everything
+	dir := t.TempDir()
+	require.NoError(t, log.ReloadLogConf(log.LogConf{Level: "info", Director: dir, Rotated: log.RotatedConf{Filename: "all.log"}}))
+	viper.Set("log_property", map[string]any{
+		"level": "info", "director": dir, "format": "json",
+		"rotated-property": map[string]any{"filename": "all.log"},
+		"redact":           map[string]any{"keys": []string{"token"}, "patterns": []string{"("}},
+	})
+	defer viper.Reset()
+	log.SetViper(viper.GetViper())
+	defer log.SetViper(nil)
+	log.InitLogConfig()
+	logger := log.InitLogger()
+	defer log.CloseLoggers()
+
+	logger.Info("connect s3cr3t", zap.String("user", "dev1"), zap.Int("pin", 4321))
+	require.NoError(t, logger.Sync())
+	out := readFile(t, filepath.Join(dir, "all.log"))
+	for _, leaked := range []string{"s3cr3t", "dev1", "4321"} {
+		assert.NotContains(t, out, leaked)
+	}
+	assert.Contains(t, out, `"user":"******","pin":"******"`)
+}
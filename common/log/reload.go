@@ -0,0 +1,109 @@
+package log
+
+import (
+	"reflect"
+
+	"common"
+	mdl "common/model"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/viper"
+)
+
+// ReloadLogConf applies conf to the loggers created by InitLogger, Zap and New with WithReplaceGlobals.
+// Level changes take effect immediately without touching the cores,
+// any other change rebuilds the cores and closes the old files.
+// Options of the created loggers (such as CallerEnable) are not changed.
+func ReloadLogConf(conf LogConf) (err error) {
+	if err = conf.Validate(); err != nil {
+		return err
+	}
+
+	conf.Director = common.DealWithExecutingCurrentFilePath(conf.Director)
+	if err = common.CreatePathDir(conf.Director); err != nil {
+		return err
+	}
+
+	gmu.Lock()
+	old := glogconf
+	glogconf = conf
+	rs := append([]reloadable{}, greloadables...)
+	applyLevels(gLevels, conf)
+	gmu.Unlock()
+
+	if onlyLevelsChanged(old, conf) {
+		return nil
+	}
+
+	for _, r := range rs {
+		if !r.global {
+			continue
+		}
+		core, closers := r.build(conf, gLevels)
+		if serr := r.h.swap(core, closers...); serr != nil {
+			err = multierror.Append(err, serr)
+		}
+	}
+	return err
+}
+
+func onlyLevelsChanged(old, cur LogConf) bool {
+	old.Level, old.NamedLevels = "", nil
+	cur.Level, cur.NamedLevels = "", nil
+	return reflect.DeepEqual(old, cur)
+}
+
+// WatchLogConfig watches the config file of v and reloads LogConf on every change.
+// v must have its config file set.
+func WatchLogConfig(v *viper.Viper) {
+	gmu.Lock()
+	gViper = v
+	key := glogConfigTag
+	gmu.Unlock()
+
+	v.OnConfigChange(func(e fsnotify.Event) {
+		var conf LogConf
+		if err := v.UnmarshalKey(key, &conf); err != nil {
+			mdl.Log().Warn("log config reload read failed", "file", e.Name, "err", err)
+			return
+		}
+		if err := ReloadLogConf(conf); err != nil {
+			mdl.Log().Warn("log config reload failed", "file", e.Name, "err", err)
+			return
+		}
+		mdl.Log().Info("log config reloaded", "file", e.Name, "levels", gLevels.String())
+	})
+	v.WatchConfig()
+}
+
+// Sync flushes the buffered entries of the loggers created by InitLogger, Zap and New
+// and syncs their files, it should be called before the process exits.
+func Sync() (err error) {
+	gmu.RLock()
+	rs := append([]reloadable{}, greloadables...)
+	gmu.RUnlock()
+
+	for _, r := range rs {
+		core := r.h.load()
+		if serr := core.Sync(); serr != nil {
+			err = multierror.Append(err, serr)
+		}
+	}
+	return err
+}
+
+// CloseLoggers syncs and closes the files of the loggers created by InitLogger, Zap and New.
+func CloseLoggers() (err error) {
+	gmu.Lock()
+	rs := greloadables
+	greloadables = nil
+	gmu.Unlock()
+
+	for _, r := range rs {
+		if cerr := r.h.close(); cerr != nil {
+			err = multierror.Append(err, cerr)
+		}
+	}
+	return err
+}
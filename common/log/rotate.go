@@ -0,0 +1,514 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mdl "common/model"
+	"common/model/clock"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+	// the MaxSize of a zero RotatedConf, as lumberjack
+	defaultMaxSize = 100
+)
+
+var (
+	// megabyte is a var for testing
+	megabyte int64 = 1024 * 1024
+
+	ErrRotateEvery = errors.New("log: rotated-property.every must be hourly, daily or a duration")
+
+	gRotateHook atomic.Pointer[func(closed string)]
+
+	//Verify Satisfies interfaces
+	_ io.WriteCloser = (*RotateWriter)(nil)
+)
+
+// SetRotateHook sets the hook called with the name of every file closed by rotation
+// of the loggers created afterwards, e.g. to ship the file. The hook runs in its own goroutine
+// after the retention and compression of the file.
+func SetRotateHook(fn func(closed string)) {
+	if fn == nil {
+		gRotateHook.Store(nil)
+		return
+	}
+	gRotateHook.Store(&fn)
+}
+
+func rotateHook() func(string) {
+	if fn := gRotateHook.Load(); fn != nil {
+		return *fn
+	}
+	return nil
+}
+
+// useRotateWriter reports whether the RotatedConf needs RotateWriter, lumberjack is used otherwise.
+func (rc *RotatedConf) useRotateWriter() bool {
+	return len(rc.Every) > 0 || rc.RotateOnStart || rc.MaxTotalSize > 0 ||
+		strings.Contains(rc.Filename, "{") || rotateHook() != nil
+}
+
+func (rc *RotatedConf) Validate() error {
+	if _, err := parseEvery(rc.Every); err != nil {
+		return err
+	}
+	if rc.MaxTotalSize < 0 {
+		return errors.New("log: rotated-property.max-total-size must not be negative")
+	}
+	if strings.Count(rc.Filename, "{") != strings.Count(rc.Filename, "}") {
+		return fmt.Errorf("log: rotated-property.filename %q has unbalanced braces", rc.Filename)
+	}
+	return nil
+}
+
+// parseEvery parses the rotation interval, 0 means no time based rotation
+// and -1 -2 mean hourly and daily aligned to the clock.
+func parseEvery(every string) (time.Duration, error) {
+	switch strings.ToLower(strings.TrimSpace(every)) {
+	case "":
+		return 0, nil
+	case "hourly":
+		return -1, nil
+	case "daily":
+		return -2, nil
+	}
+	d, err := time.ParseDuration(every)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrRotateEvery, every)
+	}
+	return d, nil
+}
+
+// RotateWriter is a file writer rotating by size and by time.
+// A filename with a time layout in braces, e.g. "app-{2006-01-02}.log", names each file
+// by the start of its period, otherwise the rotated file is renamed with its rotation time
+// like lumberjack, e.g. "app-2006-01-02T15-04-05.000.log".
+type RotateWriter struct {
+	conf  RotatedConf
+	every time.Duration
+	clk   clock.Clock
+	hook  func(string)
+
+	mu        *sync.Mutex // guards the fields below
+	file      *os.File
+	name      string // the path of the active file
+	size      int64
+	periodEnd time.Time
+	started   bool
+
+	millMu *sync.Mutex     // serializes retention and compression
+	millWg *sync.WaitGroup // waits for them on Close
+}
+
+// NewRotateWriter returns the writer of filename, the Filename of conf is ignored.
+// A MaxSize of 0 rotates at 100 megabytes, as lumberjack does. The file is opened on the first write.
+func NewRotateWriter(filename string, conf RotatedConf, clk clock.Clock) (*RotateWriter, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	every, _ := parseEvery(conf.Every)
+	conf.Filename = filename
+	if conf.MaxSize == 0 {
+		conf.MaxSize = defaultMaxSize
+	}
+	return &RotateWriter{
+		conf:   conf,
+		every:  every,
+		clk:    clock.OrReal(clk),
+		mu:     &sync.Mutex{},
+		millMu: &sync.Mutex{},
+		millWg: &sync.WaitGroup{},
+	}, nil
+}
+
+// OnRotate sets the hook called with the name of every closed file.
+func (w *RotateWriter) OnRotate(fn func(closed string)) *RotateWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hook = fn
+	return w
+}
+
+// Filename returns the path of the active file.
+func (w *RotateWriter) Filename() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.name
+}
+
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	if w.file == nil {
+		if err = w.open(now); err != nil {
+			return 0, err
+		}
+	}
+
+	if !w.periodEnd.IsZero() && !now.Before(w.periodEnd) {
+		if err = w.rotate(now); err != nil {
+			return 0, err
+		}
+	} else if max := int64(w.conf.MaxSize) * megabyte; max > 0 && w.size > 0 && w.size+int64(len(p)) > max {
+		if err = w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync commits the active file to the storage.
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Rotate closes the active file and opens a new one.
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	if w.file == nil {
+		return w.open(now)
+	}
+	return w.rotate(now)
+}
+
+// Close closes the active file and waits for the pending retention work.
+func (w *RotateWriter) Close() (err error) {
+	w.mu.Lock()
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.millWg.Wait()
+	return err
+}
+
+func (w *RotateWriter) now() time.Time {
+	if w.conf.LocalTime {
+		return w.clk.Now().Local()
+	}
+	return w.clk.Now().UTC()
+}
+
+func (w *RotateWriter) pattern() bool {
+	return strings.Contains(w.conf.Filename, "{")
+}
+
+// periodOf returns the period containing t, aligned on the wall clock of the location of t,
+// the intervals are counted from the midnight of the day of t.
+func (w *RotateWriter) periodOf(t time.Time) (start, end time.Time) {
+	switch {
+	case w.every == -1:
+		start = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		return start, start.Add(time.Hour)
+	case w.every == -2:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 1)
+	case w.every > 0:
+		// 从当天零点起算 时区偏移不是整小时时也对齐本地时间
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		start = day.Add(t.Sub(day).Truncate(w.every))
+		return start, start.Add(w.every)
+	}
+	return t, time.Time{}
+}
+
+// must hold w.mu
+func (w *RotateWriter) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(w.conf.Filename), 0o755); err != nil {
+		return err
+	}
+
+	start, end := w.periodOf(now)
+	name := w.conf.Filename
+	if w.pattern() {
+		name = expandPattern(w.conf.Filename, start)
+	}
+
+	// rotate the file left by the last process once
+	if !w.started {
+		w.started = true
+		if info, err := os.Stat(name); err == nil && info.Size() > 0 {
+			stale := !w.pattern() && !end.IsZero() && info.ModTime().Before(start)
+			if w.conf.RotateOnStart || stale {
+				w.name = name
+				if err := w.closeActive(now); err != nil {
+					return err
+				}
+				if w.pattern() {
+					name = w.nextIndexName(name)
+				}
+			}
+		}
+	}
+
+	if max := int64(w.conf.MaxSize) * megabyte; max > 0 && w.pattern() {
+		if info, err := os.Stat(name); err == nil && info.Size() >= max {
+			name = w.nextIndexName(name)
+		}
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.name, w.size, w.periodEnd = f, name, info.Size(), end
+	return nil
+}
+
+// must hold w.mu
+func (w *RotateWriter) rotate(now time.Time) error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	if err := w.closeActive(now); err != nil {
+		return err
+	}
+
+	start, _ := w.periodOf(now)
+	if w.pattern() && expandPattern(w.conf.Filename, start) == w.name {
+		// size rotation within the same period
+		name := w.nextIndexName(w.name)
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		_, end := w.periodOf(now)
+		w.file, w.name, w.size, w.periodEnd = f, name, 0, end
+		return nil
+	}
+	return w.open(now)
+}
+
+// closeActive moves the closed active file to its backup name
+// and starts the retention work. must hold w.mu
+func (w *RotateWriter) closeActive(now time.Time) error {
+	closed := w.name
+	if !w.pattern() {
+		closed = backupName(w.conf.Filename, now)
+		if err := os.Rename(w.name, closed); err != nil {
+			return err
+		}
+	}
+
+	hook := w.hook
+	if hook == nil {
+		hook = rotateHook()
+	}
+	w.millWg.Add(1)
+	go w.mill(closed, hook)
+	return nil
+}
+
+// nextIndexName returns name with the first unused index before its extension.
+func (w *RotateWriter) nextIndexName(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		n := base + "." + strconv.Itoa(i) + ext
+		if _, err := os.Stat(n); os.IsNotExist(err) {
+			if _, err := os.Stat(n + compressSuffix); os.IsNotExist(err) {
+				return n
+			}
+		}
+	}
+}
+
+// mill compresses the closed file, removes the backups beyond the retention
+// and calls the hook.
+func (w *RotateWriter) mill(closed string, hook func(string)) {
+	defer w.millWg.Done()
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	if w.conf.Compress {
+		if err := compressFile(closed); err != nil {
+			mdl.Log().Warn("log rotate compress failed", "file", closed, "err", err)
+		} else {
+			closed += compressSuffix
+		}
+	}
+	if err := w.removeBackups(); err != nil {
+		mdl.Log().Warn("log rotate retention failed", "err", err)
+	}
+	if hook != nil {
+		hook(closed)
+	}
+}
+
+type backupFile struct {
+	path string
+	info os.FileInfo
+}
+
+// removeBackups applies MaxBackups MaxAge and MaxTotalSize to the backups.
+func (w *RotateWriter) removeBackups() error {
+	if w.conf.MaxBackups == 0 && w.conf.MaxAge == 0 && w.conf.MaxTotalSize == 0 {
+		return nil
+	}
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Time{}
+	if w.conf.MaxAge > 0 {
+		cutoff = w.clk.Now().Add(-time.Duration(w.conf.MaxAge) * 24 * time.Hour)
+	}
+	maxTotal := int64(w.conf.MaxTotalSize) * megabyte
+
+	var total int64
+	var errs []error
+	for i, b := range backups {
+		total += b.info.Size()
+		remove := (w.conf.MaxBackups > 0 && i >= w.conf.MaxBackups) ||
+			(!cutoff.IsZero() && b.info.ModTime().Before(cutoff)) ||
+			(maxTotal > 0 && total > maxTotal)
+		if remove {
+			total -= b.info.Size()
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backups returns the backup files of the writer, newest first.
+func (w *RotateWriter) backups() ([]backupFile, error) {
+	dir := filepath.Dir(w.conf.Filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	re := backupRegexp(filepath.Base(w.conf.Filename), w.pattern())
+	w.mu.Lock()
+	active := w.name
+	w.mu.Unlock()
+
+	var backups []backupFile
+	for _, e := range entries {
+		if e.IsDir() || !re.MatchString(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if path == active {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: path, info: info})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].info.ModTime().After(backups[j].info.ModTime())
+	})
+	return backups, nil
+}
+
+// expandPattern replaces every {layout} of the pattern with t formatted by the layout.
+func expandPattern(pattern string, t time.Time) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(pattern, '{')
+		j := strings.IndexByte(pattern, '}')
+		if i < 0 || j < i {
+			sb.WriteString(pattern)
+			return sb.String()
+		}
+		sb.WriteString(pattern[:i])
+		sb.WriteString(t.Format(pattern[i+1 : j]))
+		pattern = pattern[j+1:]
+	}
+}
+
+func backupName(name string, t time.Time) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// backupRegexp matches the backup base names of the base filename.
+func backupRegexp(base string, pattern bool) *regexp.Regexp {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	var expr string
+	if pattern {
+		var sb strings.Builder
+		for {
+			i := strings.IndexByte(stem, '{')
+			j := strings.IndexByte(stem, '}')
+			if i < 0 || j < i {
+				sb.WriteString(regexp.QuoteMeta(stem))
+				break
+			}
+			sb.WriteString(regexp.QuoteMeta(stem[:i]))
+			sb.WriteString(".+?")
+			stem = stem[j+1:]
+		}
+		expr = sb.String() + `(\.\d+)?`
+	} else {
+		expr = regexp.QuoteMeta(stem) + `-\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3}`
+	}
+	return regexp.MustCompile("^" + expr + regexp.QuoteMeta(ext) + `(` + regexp.QuoteMeta(compressSuffix) + `)?$`)
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + compressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,184 @@
+package log_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"common/log"
+	"common/model/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	es, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(es))
+	for _, e := range es {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateDailyPattern(t *testing.T) {
+	dir := t.TempDir()
+	fc := clock.NewFake(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	w, err := log.NewRotateWriter(filepath.Join(dir, "app-{2006-01-02}.log"), log.RotatedConf{Every: "daily"}, fc)
+	require.NoError(t, err)
+
+	closed := make(chan string, 4)
+	w.OnRotate(func(name string) { closed <- name })
+
+	_, err = w.Write([]byte("day1\n"))
+	require.NoError(t, err)
+	fc.Advance(13 * time.Hour)
+	_, err = w.Write([]byte("day1-late\n"))
+	require.NoError(t, err)
+	assert.Empty(t, closed)
+
+	fc.Advance(time.Hour)
+	_, err = w.Write([]byte("day2\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, filepath.Join(dir, "app-2024-01-01.log"), <-closed)
+	assert.Equal(t, []string{"app-2024-01-01.log", "app-2024-01-02.log"}, listDir(t, dir))
+	day1, _ := os.ReadFile(filepath.Join(dir, "app-2024-01-01.log"))
+	assert.Equal(t, "day1\nday1-late\n", string(day1))
+}
+
+func TestRotateSizeRetention(t *testing.T) {
+	defer log.SetMegabyte(10)()
+	dir := t.TempDir()
+	fc := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	w, err := log.NewRotateWriter(filepath.Join(dir, "app.log"),
+		log.RotatedConf{MaxSize: 1, MaxBackups: 3, MaxTotalSize: 2}, fc)
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, err = w.Write([]byte("12345678"))
+		require.NoError(t, err)
+		fc.Advance(time.Second)
+		// let the retention see distinct modification times
+		require.NoError(t, w.Sync())
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, w.Close())
+
+	names := listDir(t, dir)
+	require.Contains(t, names, "app.log")
+	backups := 0
+	for _, n := range names {
+		if n != "app.log" {
+			assert.True(t, strings.HasPrefix(n, "app-2024-01-01T"), n)
+			backups++
+		}
+	}
+	// MaxTotalSize of 20 bytes keeps two backups of 8 bytes
+	assert.Equal(t, 2, backups, names)
+}
+
+func TestRotateDefaultMaxSize(t *testing.T) {
+	// a zero MaxSize rotates at 100 megabytes like lumberjack, not never
+	defer log.SetMegabyte(1)()
+	dir := t.TempDir()
+	w, err := log.NewRotateWriter(filepath.Join(dir, "app.log"), log.RotatedConf{}, nil)
+	require.NoError(t, err)
+	closed := make(chan string, 1)
+	w.OnRotate(func(name string) { closed <- name })
+
+	_, err = w.Write(make([]byte, 60))
+	require.NoError(t, err)
+	assert.Empty(t, closed)
+	_, err = w.Write(make([]byte, 60))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Len(t, listDir(t, dir), 2)
+	assert.Len(t, closed, 1)
+}
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	w, err := log.NewRotateWriter(filepath.Join(dir, "app.log"), log.RotatedConf{Compress: true}, nil)
+	require.NoError(t, err)
+	closed := make(chan string, 1)
+	w.OnRotate(func(name string) { closed <- name })
+
+	_, err = w.Write([]byte("compressed\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Close())
+
+	name := <-closed
+	assert.True(t, strings.HasSuffix(name, ".log.gz"), name)
+	assert.FileExists(t, name)
+	assert.Len(t, listDir(t, dir), 2)
+}
+
+func TestRotateOnStart(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(name, []byte("last run\n"), 0o644))
+
+	w, err := log.NewRotateWriter(name, log.RotatedConf{RotateOnStart: true}, clock.NewFake(time.Time{}))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("this run\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	names := listDir(t, dir)
+	require.Len(t, names, 2)
+	cur, _ := os.ReadFile(name)
+	assert.Equal(t, "this run\n", string(cur))
+
+	_, err = log.NewRotateWriter(name, log.RotatedConf{Every: "weekly"}, nil)
+	assert.ErrorIs(t, err, log.ErrRotateEvery)
+}
+
+func TestNewDailyFile(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.New(log.LogConf{
+		Director: dir,
+		Rotated:  log.RotatedConf{Filename: "app-{20060102}.log", Every: "daily"},
+	})
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	logger.Info("daily-file")
+	require.NoError(t, logger.Sync())
+	name := filepath.Join(dir, "app-"+time.Now().UTC().Format("20060102")+".log")
+	assert.Contains(t, readFile(t, name), "daily-file")
+
+	_, err = log.New(log.LogConf{Director: dir, Rotated: log.RotatedConf{Filename: "a.log", Every: "monthly"}})
+	assert.ErrorIs(t, err, log.ErrRotateEvery)
+}
+
+func TestRotatePeriodLocal(t *testing.T) {
+	// +05:30, the periods are aligned on the local hours, not on the UTC ones
+	ist := time.FixedZone("IST", 5*3600+1800)
+	at := time.Date(2024, 1, 1, 10, 20, 0, 0, ist)
+	name := filepath.Join(t.TempDir(), "app.log")
+	for _, tc := range []struct {
+		every      string
+		start, end time.Time
+	}{
+		{"hourly", time.Date(2024, 1, 1, 10, 0, 0, 0, ist), time.Date(2024, 1, 1, 11, 0, 0, 0, ist)},
+		{"daily", time.Date(2024, 1, 1, 0, 0, 0, 0, ist), time.Date(2024, 1, 2, 0, 0, 0, 0, ist)},
+		{"6h", time.Date(2024, 1, 1, 6, 0, 0, 0, ist), time.Date(2024, 1, 1, 12, 0, 0, 0, ist)},
+		{"15m", time.Date(2024, 1, 1, 10, 15, 0, 0, ist), time.Date(2024, 1, 1, 10, 30, 0, 0, ist)},
+	} {
+		w, err := log.NewRotateWriter(name, log.RotatedConf{Every: tc.every}, nil)
+		require.NoError(t, err)
+		start, end := log.PeriodOf(w, at)
+		assert.True(t, tc.start.Equal(start), "%s: start %s", tc.every, start)
+		assert.True(t, tc.end.Equal(end), "%s: end %s", tc.every, end)
+		require.NoError(t, w.Close())
+	}
+}
@@ -0,0 +1,202 @@
+package log
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"common/model/clock"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// field added to the first entry let through after some were rate limited
+	RateLimitedKey = "rate-limited"
+
+	// the rate limiter forgets idle keys beyond this size
+	maxRateLimitKeys = 4096
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ zapcore.Core = (*rateLimitCore)(nil)
+)
+
+// SamplingConf throttles the flapping messages, all stages are disabled by their zero values.
+type SamplingConf struct {
+	// zap sampler: 每Tick内 同级别同消息的前First条输出 之后每Thereafter条输出一条
+	Tick       time.Duration `mapstructure:"tick" json:"tick" yaml:"tick" desc:"window of the zap sampler, 0 disables it"`
+	First      int           `mapstructure:"first" json:"first" yaml:"first" desc:"entries logged by level and message in a tick"`
+	Thereafter int           `mapstructure:"thereafter" json:"thereafter" yaml:"thereafter" desc:"then one entry logged every thereafter in the tick"`
+
+	// 按消息的速率限制(条/秒) 0为不限制 RateLimits按消息覆盖RateLimit
+	RateLimit  float64            `mapstructure:"rate-limit" json:"rate-limit" yaml:"rate-limit" desc:"entries per second by message, 0 is unlimited"`
+	Burst      int                `mapstructure:"burst" json:"burst" yaml:"burst" desc:"entries logged at once above the rate-limit"`
+	RateLimits map[string]float64 `mapstructure:"rate-limits" json:"rate-limits" yaml:"rate-limits" desc:"rate-limit by message, overriding rate-limit"`
+
+	// 重复消息合并的时间窗口 窗口内的重复消息汇总为"message repeated N times"
+	DedupWindow time.Duration `mapstructure:"dedup-window" json:"dedup-window" yaml:"dedup-window" desc:"window summarizing the repeated messages, 0 disables it"`
+}
+
+func (sc *SamplingConf) Validate() (err error) {
+	if sc.Tick < 0 || sc.First < 0 || sc.Thereafter < 0 {
+		err = multierror.Append(err, errors.New("log: sampling tick first thereafter must not be negative"))
+	}
+	if sc.RateLimit < 0 || sc.Burst < 0 {
+		err = multierror.Append(err, errors.New("log: sampling rate-limit burst must not be negative"))
+	}
+	for _, v := range sc.RateLimits {
+		if v < 0 {
+			err = multierror.Append(err, errors.New("log: sampling rate-limits must not be negative"))
+			break
+		}
+	}
+	if sc.DedupWindow < 0 {
+		err = multierror.Append(err, errors.New("log: sampling dedup-window must not be negative"))
+	}
+	return err
+}
+
+// wrapSampling wraps core with the enabled stages of sc:
+// dedup first so that the repeats are counted, then rate limit, then the zap sampler.
+func wrapSampling(core zapcore.Core, sc SamplingConf) zapcore.Core {
+	if sc.First > 0 {
+		tick := sc.Tick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		core = zapcore.NewSamplerWithOptions(core, tick, sc.First, sc.Thereafter)
+	}
+	if sc.RateLimit > 0 || len(sc.RateLimits) > 0 {
+		core = NewRateLimitCore(core, sc.RateLimit, sc.Burst, sc.RateLimits, clock.Real())
+	}
+	if sc.DedupWindow > 0 {
+		core = NewDedupCore(core, sc.DedupWindow, clock.Real())
+	}
+	return core
+}
+
+// rateLimitCore limits the entries per message with token buckets.
+type rateLimitCore struct {
+	zapcore.Core
+	rl *rateLimiter
+}
+
+type rateLimiter struct {
+	limit  float64
+	burst  int
+	limits map[string]float64
+	clk    clock.Clock
+
+	mu      *sync.Mutex // guards buckets
+	buckets map[string]*bucket
+	dropped atomic.Uint64
+}
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	dropped int
+}
+
+// NewRateLimitCore limits the entries of each message to limit per second
+// with burst, limits overrides limit by message, 0 means not limited.
+// The number of entries dropped is added to the next entry let through.
+func NewRateLimitCore(core zapcore.Core, limit float64, burst int, limits map[string]float64, clk clock.Clock) zapcore.Core {
+	ls := make(map[string]float64, len(limits))
+	for k, v := range limits {
+		ls[k] = v
+	}
+	return &rateLimitCore{
+		Core: core,
+		rl: &rateLimiter{
+			limit:   limit,
+			burst:   burst,
+			limits:  ls,
+			clk:     clock.OrReal(clk),
+			mu:      &sync.Mutex{},
+			buckets: make(map[string]*bucket),
+		},
+	}
+}
+
+func (c *rateLimitCore) With(fields []zapcore.Field) zapcore.Core {
+	return &rateLimitCore{Core: c.Core.With(fields), rl: c.rl}
+}
+
+func (c *rateLimitCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Core.Enabled(ent.Level) {
+		return ce
+	}
+	ok, dropped := c.rl.allow(ent.Message)
+	if !ok {
+		return ce
+	}
+	if dropped > 0 {
+		return c.Core.With([]zapcore.Field{zap.Int(RateLimitedKey, dropped)}).Check(ent, ce)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// RateLimitDropped returns the number of entries dropped by a core of NewRateLimitCore.
+func RateLimitDropped(core zapcore.Core) uint64 {
+	if c, ok := core.(*rateLimitCore); ok {
+		return c.rl.dropped.Load()
+	}
+	return 0
+}
+
+func (rl *rateLimiter) allow(key string) (ok bool, dropped int) {
+	limit, has := rl.limits[key]
+	if !has {
+		limit = rl.limit
+	}
+	if limit <= 0 {
+		return true, 0
+	}
+	burst := float64(rl.burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit))
+	}
+
+	now := rl.clk.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	b, has := rl.buckets[key]
+	if !has {
+		if len(rl.buckets) >= maxRateLimitKeys {
+			rl.forgetIdle(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit)
+	b.last = now
+	if b.tokens < 1 {
+		b.dropped++
+		rl.dropped.Add(1)
+		return false, 0
+	}
+	b.tokens--
+	dropped, b.dropped = b.dropped, 0
+	return true, dropped
+}
+
+// must hold rl.mu
+func (rl *rateLimiter) forgetIdle(now time.Time) {
+	for k, b := range rl.buckets {
+		if b.dropped == 0 && now.Sub(b.last) > time.Second {
+			delete(rl.buckets, k)
+		}
+	}
+	// all keys are busy, start over rather than growing without bound
+	if len(rl.buckets) >= maxRateLimitKeys {
+		rl.buckets = make(map[string]*bucket)
+	}
+}
@@ -0,0 +1,143 @@
+package log_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"common/log"
+	"common/model/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newBufferCore(buf *bytes.Buffer) zapcore.Core {
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = ""
+	return zapcore.NewCore(zapcore.NewJSONEncoder(enc), zapcore.AddSync(buf), zap.DebugLevel)
+}
+
+func TestRateLimitCore(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fc := clock.NewFake(time.Time{})
+	core := log.NewRateLimitCore(newBufferCore(buf), 2, 2, map[string]float64{"quiet": 0}, fc)
+	logger := zap.New(core)
+
+	for i := 0; i < 10; i++ {
+		logger.Warn("flapping")
+		logger.Info("quiet")
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), `"msg":"flapping"`))
+	assert.Equal(t, 10, strings.Count(buf.String(), `"msg":"quiet"`))
+	assert.Equal(t, uint64(8), log.RateLimitDropped(core))
+
+	// one token is refilled after half a second
+	buf.Reset()
+	fc.Advance(500 * time.Millisecond)
+	logger.Warn("flapping")
+	logger.Warn("flapping")
+	assert.Equal(t, 1, strings.Count(buf.String(), `"msg":"flapping"`))
+	assert.Contains(t, buf.String(), `"rate-limited":8`)
+}
+
+func TestDedupCore(t *testing.T) {
+	sw := &stallWriter{release: make(chan struct{})}
+	close(sw.release)
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = ""
+	fc := clock.NewFake(time.Time{})
+	logger := zap.New(log.NewDedupCore(zapcore.NewCore(zapcore.NewJSONEncoder(enc), sw, zap.DebugLevel), time.Second, fc)).Named("dev")
+
+	for i := 0; i < 1000; i++ {
+		logger.Warn("sensor timeout", zap.String("device", "t1"))
+	}
+	logger.Info("other")
+	assert.Equal(t, 1, strings.Count(sw.String(), `"msg":"sensor timeout"`))
+
+	// the summaries are written when the window is over, without another entry
+	fc.Advance(500 * time.Millisecond)
+	logger.Warn("link down")
+	logger.Warn("link down")
+	fc.Advance(500 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(sw.String(), `"msg":"sensor timeout (message repeated 999 times)"`)
+	}, time.Second, 5*time.Millisecond)
+	assert.Contains(t, sw.String(), `"msg":"sensor timeout (message repeated 999 times)","device":"t1"`)
+	assert.NotContains(t, sw.String(), "link down (message")
+
+	fc.Advance(500 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(sw.String(), `"msg":"link down (message repeated 1 times)"`)
+	}, time.Second, 5*time.Millisecond)
+
+	// the next entry after the window is written, Sync flushes the pending summaries
+	logger.Warn("sensor timeout")
+	assert.Equal(t, 2, strings.Count(sw.String(), `"msg":"sensor timeout"`))
+	logger.Warn("sensor timeout")
+	require.NoError(t, logger.Sync())
+	assert.Contains(t, sw.String(), `"msg":"sensor timeout (message repeated 1 times)"`)
+	assert.Contains(t, sw.String(), `"logger":"dev"`)
+}
+
+func TestDedupCoreFields(t *testing.T) {
+	sw := &stallWriter{release: make(chan struct{})}
+	close(sw.release)
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = ""
+	fc := clock.NewFake(time.Time{})
+	logger := zap.New(log.NewDedupCore(zapcore.NewCore(zapcore.NewJSONEncoder(enc), sw, zap.DebugLevel), time.Second, fc))
+
+	// the devices are told apart by the fields of the entries and those added by With
+	for i := 0; i < 3; i++ {
+		logger.Warn("sensor timeout", zap.String("device", "t1"))
+		logger.Warn("sensor timeout", zap.String("device", "t2"))
+		logger.With(zap.String("device", "t3")).Warn("sensor timeout")
+	}
+	for _, dev := range []string{"t1", "t2", "t3"} {
+		assert.Equal(t, 1, strings.Count(sw.String(), `"msg":"sensor timeout","device":"`+dev+`"`))
+	}
+	require.NoError(t, logger.Sync())
+	for _, dev := range []string{"t1", "t2", "t3"} {
+		assert.Contains(t, sw.String(), `"msg":"sensor timeout (message repeated 2 times)","device":"`+dev+`"`)
+	}
+
+	// Sync stops the timer, the core is not written afterwards
+	logger.Warn("link down")
+	logger.Warn("link down")
+	assert.Eventually(t, func() bool { return fc.Waiters() == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, logger.Sync())
+	assert.Equal(t, 0, fc.Waiters())
+	n := len(sw.String())
+	fc.Advance(time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, len(sw.String()))
+}
+
+func TestNewSampling(t *testing.T) {
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "info",
+		Director: dir,
+		Format:   "json",
+		Rotated:  log.RotatedConf{Filename: "sampled.log"},
+		Sampling: log.SamplingConf{Tick: time.Minute, First: 3, Thereafter: 100},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	for i := 0; i < 50; i++ {
+		logger.Warn("sampled")
+	}
+	require.NoError(t, logger.Sync())
+	assert.Equal(t, 3, strings.Count(readFile(t, filepath.Join(dir, "sampled.log")), `"sampled"`))
+
+	conf.Sampling.DedupWindow = -time.Second
+	_, err = log.New(conf)
+	assert.ErrorContains(t, err, "dedup-window")
+}
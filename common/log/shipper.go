@@ -0,0 +1,260 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"common/model/clock"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	spoolSuffix = ".json"
+
+	defaultShipperBatchSize    = 500
+	defaultShipperTimeout      = 10 * time.Second
+	defaultShipperRetryBackoff = time.Second
+	defaultSpoolMaxSize        = 100
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ zapcore.WriteSyncer = (*HTTPWriter)(nil)
+)
+
+// HTTPWriter posts the JSON lines written to it as JSON arrays of at most BatchSize entries.
+// A batch failing all its retries is saved in SpoolDir, the saved batches are posted
+// oldest first after the next batch succeeds. It is meant to be wrapped in an AsyncWriter
+// so that the retries don't block the loggers.
+// Past the deadline set by SetDeadline the batches are spooled without being posted.
+type HTTPWriter struct {
+	conf   HTTPConf
+	client *http.Client
+	clk    clock.Clock
+
+	mu  *sync.Mutex // serializes the posts and the spool
+	seq int
+
+	dmu      *sync.Mutex // guards deadline
+	deadline time.Time
+}
+
+// NewHTTPWriter returns the writer of conf, the conf should be validated.
+func NewHTTPWriter(conf HTTPConf, clk clock.Clock) *HTTPWriter {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = defaultShipperBatchSize
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultShipperTimeout
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = defaultShipperRetryBackoff
+	}
+	if conf.SpoolMaxSize <= 0 {
+		conf.SpoolMaxSize = defaultSpoolMaxSize
+	}
+	return &HTTPWriter{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		clk:    clock.OrReal(clk),
+		mu:     &sync.Mutex{},
+		dmu:    &sync.Mutex{},
+	}
+}
+
+// Timeout returns the timeout of a post.
+func (w *HTTPWriter) Timeout() time.Duration {
+	return w.conf.Timeout
+}
+
+// SetDeadline bounds the posts and the retries of the writes by t, the zero time removes the bound.
+// The batches not posted by t are spooled.
+func (w *HTTPWriter) SetDeadline(t time.Time) {
+	w.dmu.Lock()
+	defer w.dmu.Unlock()
+	w.deadline = t
+}
+
+// clearDeadline removes the deadline if it's still t.
+func (w *HTTPWriter) clearDeadline(t time.Time) {
+	w.dmu.Lock()
+	defer w.dmu.Unlock()
+	if w.deadline.Equal(t) {
+		w.deadline = time.Time{}
+	}
+}
+
+// remaining returns the time left before the deadline, ok is false once it has passed.
+func (w *HTTPWriter) remaining() (left time.Duration, ok bool) {
+	w.dmu.Lock()
+	defer w.dmu.Unlock()
+	if w.deadline.IsZero() {
+		return w.conf.Timeout, true
+	}
+	left = w.deadline.Sub(w.clk.Now())
+	return min(left, w.conf.Timeout), left > 0
+}
+
+// Write posts the lines of p in batches, p is always consumed:
+// a batch that can't be posted is spooled or dropped and the error returned.
+func (w *HTTPWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var lines [][]byte
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	var err error
+	for len(lines) > 0 {
+		n := min(len(lines), w.conf.BatchSize)
+		body := jsonArray(lines[:n])
+		lines = lines[n:]
+
+		if perr := w.postRetry(body); perr != nil {
+			err = perr
+			w.spool(body)
+			continue
+		}
+		w.drainSpool()
+	}
+	return len(p), err
+}
+
+// Sync does nothing, the batches are posted by Write.
+func (w *HTTPWriter) Sync() error {
+	return nil
+}
+
+// Close does nothing, the spooled batches are kept for the next process.
+func (w *HTTPWriter) Close() error {
+	return nil
+}
+
+// Spooled returns the files of the spooled batches, oldest first.
+func (w *HTTPWriter) Spooled() []string {
+	if len(w.conf.SpoolDir) == 0 {
+		return nil
+	}
+	names, _ := filepath.Glob(filepath.Join(w.conf.SpoolDir, "*"+spoolSuffix))
+	sort.Strings(names)
+	return names
+}
+
+// postRetry posts body with MaxRetries retries, the backoff doubles after each retry.
+// It stops at the deadline.
+func (w *HTTPWriter) postRetry(body []byte) (err error) {
+	backoff := w.conf.RetryBackoff
+	for i := 0; ; i++ {
+		if err = w.post(body); err == nil || i >= w.conf.MaxRetries {
+			return err
+		}
+		left, ok := w.remaining()
+		if !ok {
+			return err
+		}
+		w.clk.Sleep(min(backoff, left))
+		backoff *= 2
+	}
+}
+
+func (w *HTTPWriter) post(body []byte) error {
+	timeout, ok := w.remaining()
+	if !ok {
+		return fmt.Errorf("log: post %s: %w", w.conf.URL, os.ErrDeadlineExceeded)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("log: post %s: %s", w.conf.URL, resp.Status)
+	}
+	return nil
+}
+
+// spool saves a batch and removes the oldest beyond SpoolMaxSize. must hold w.mu
+func (w *HTTPWriter) spool(body []byte) {
+	if len(w.conf.SpoolDir) == 0 {
+		return
+	}
+	if err := os.MkdirAll(w.conf.SpoolDir, 0o755); err != nil {
+		return
+	}
+	// the sequence keeps the order of the batches spooled within the same nanosecond
+	w.seq++
+	name := fmt.Sprintf("%020d-%06d%s", w.clk.Now().UnixNano(), w.seq%1000000, spoolSuffix)
+	if err := os.WriteFile(filepath.Join(w.conf.SpoolDir, name), body, 0o644); err != nil {
+		return
+	}
+
+	names := w.Spooled()
+	var total int64
+	sizes := make([]int64, len(names))
+	for i, n := range names {
+		if info, err := os.Stat(n); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(names)-1 && total > int64(w.conf.SpoolMaxSize)*megabyte; i++ {
+		if os.Remove(names[i]) == nil {
+			total -= sizes[i]
+		}
+	}
+}
+
+// drainSpool posts the spooled batches until one fails. must hold w.mu
+func (w *HTTPWriter) drainSpool() {
+	for _, name := range w.Spooled() {
+		body, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if w.post(body) != nil {
+			return
+		}
+		os.Remove(name)
+	}
+}
+
+func jsonArray(lines [][]byte) []byte {
+	size := 2
+	for _, l := range lines {
+		size += len(l) + 1
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	buf.WriteByte('[')
+	for i, l := range lines {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(l)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
@@ -0,0 +1,189 @@
+package log
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"common/model/clock"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"go.uber.org/zap/zapcore"
+)
+
+// SinksConf configures the remote outputs teed next to the log files.
+type SinksConf struct {
+	Syslog []SyslogConf `mapstructure:"syslog" json:"syslog" yaml:"syslog" desc:"syslog servers"`
+	HTTP   []HTTPConf   `mapstructure:"http" json:"http" yaml:"http" desc:"HTTP endpoints"`
+}
+
+// SyslogConf sends the entries to a syslog server in the RFC 5424 format.
+type SyslogConf struct {
+	// udp tcp unix unixgram udp4 udp6 tcp4 tcp6 流式的tcp* unix按octet counting分帧(RFC 6587)
+	Network string `mapstructure:"network" json:"network" yaml:"network" desc:"udp tcp unix unixgram, or udp4 udp6 tcp4 tcp6"`
+	Address string `mapstructure:"address" json:"address" yaml:"address" desc:"address of the server"`
+	// 最低输出级别 为空时同日志级别
+	Level string `mapstructure:"level" json:"level" yaml:"level" desc:"minimum level, the log level when empty"`
+	// kern user daemon auth syslog local0..local7 等 默认user
+	Facility string `mapstructure:"facility" json:"facility" yaml:"facility" desc:"syslog facility, user by default"`
+	// APP-NAME 默认为进程名
+	AppName  string `mapstructure:"app-name" json:"app-name" yaml:"app-name" desc:"APP-NAME of the messages, the executable name by default"`
+	Hostname string `mapstructure:"hostname" json:"hostname" yaml:"hostname" desc:"HOSTNAME of the messages, the host name by default"`
+	// MSG的格式 json或console
+	Format  string        `mapstructure:"format" json:"format" yaml:"format" desc:"encoding of the MSG, console or json"`
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout" desc:"timeout of the connections and writes"`
+}
+
+// HTTPConf posts the entries in batches as a JSON array to URL.
+type HTTPConf struct {
+	URL     string            `mapstructure:"url" json:"url" yaml:"url" desc:"URL the batches are posted to"`
+	Headers map[string]string `mapstructure:"headers" json:"headers" yaml:"headers" desc:"headers of the requests"`
+	// 最低输出级别 为空时同日志级别
+	Level string `mapstructure:"level" json:"level" yaml:"level" desc:"minimum level, the log level when empty"`
+	// 每次请求的最大条数 缓冲的条数和刷新间隔
+	BatchSize     int           `mapstructure:"batch-size" json:"batch-size" yaml:"batch-size" desc:"entries per request at most"`
+	BufferSize    int           `mapstructure:"buffer-size" json:"buffer-size" yaml:"buffer-size" desc:"entries buffered at most"`
+	FlushInterval time.Duration `mapstructure:"flush-interval" json:"flush-interval" yaml:"flush-interval" desc:"interval the buffered entries are posted at"`
+	Timeout       time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout" desc:"timeout of the connections and writes"`
+	// 失败重试的次数和间隔 间隔每次翻倍
+	MaxRetries   int           `mapstructure:"max-retries" json:"max-retries" yaml:"max-retries" desc:"retries of a failed request"`
+	RetryBackoff time.Duration `mapstructure:"retry-backoff" json:"retry-backoff" yaml:"retry-backoff" desc:"wait before the first retry, doubled at each retry"`
+	// 重试失败的批次保存在SpoolDir 发送成功后补发 为空时丢弃
+	SpoolDir string `mapstructure:"spool-dir" json:"spool-dir" yaml:"spool-dir" desc:"directory keeping the failed batches, dropped when empty"`
+	// SpoolDir的最大大小(MB) 超过时删除最旧的批次 默认100
+	SpoolMaxSize int `mapstructure:"spool-max-size" json:"spool-max-size" yaml:"spool-max-size" desc:"size of spool-dir in MB at most, 100 by default"`
+}
+
+func (sc *SinksConf) Validate() (err error) {
+	for i := range sc.Syslog {
+		if serr := sc.Syslog[i].Validate(); serr != nil {
+			err = multierror.Append(err, fmt.Errorf("log: sinks.syslog[%d]: %w", i, serr))
+		}
+	}
+	for i := range sc.HTTP {
+		if herr := sc.HTTP[i].Validate(); herr != nil {
+			err = multierror.Append(err, fmt.Errorf("log: sinks.http[%d]: %w", i, herr))
+		}
+	}
+	return err
+}
+
+func (sc *SyslogConf) Validate() error {
+	switch sc.Network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return fmt.Errorf("unrecognized network %q", sc.Network)
+	}
+	if len(sc.Address) == 0 {
+		return fmt.Errorf("address is empty")
+	}
+	if _, ok := syslogFacilities[sc.Facility]; !ok && len(sc.Facility) > 0 {
+		return fmt.Errorf("unrecognized facility %q", sc.Facility)
+	}
+	if _, err := ParseLevel(sc.Level); err != nil {
+		return err
+	}
+	switch sc.Format {
+	case "", "console", "json":
+	default:
+		return fmt.Errorf("unrecognized format %q", sc.Format)
+	}
+	if sc.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+func (hc *HTTPConf) Validate() error {
+	u, err := url.Parse(hc.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must be http or https", hc.URL)
+	}
+	if _, err := ParseLevel(hc.Level); err != nil {
+		return err
+	}
+	if hc.BatchSize < 0 || hc.BufferSize < 0 || hc.FlushInterval < 0 || hc.Timeout < 0 ||
+		hc.MaxRetries < 0 || hc.RetryBackoff < 0 || hc.SpoolMaxSize < 0 {
+		return fmt.Errorf("sizes intervals and retries must not be negative")
+	}
+	return nil
+}
+
+// sinkLevel returns the level of a sink, an empty level follows the levels of the logger.
+func sinkLevel(level string, levels *Levels) zapcore.LevelEnabler {
+	if len(level) == 0 {
+		return levels.Floor()
+	}
+	l, _ := ParseLevel(level)
+	return l
+}
+
+// buildSinkCores builds the cores of the remote outputs of conf.
+// The connections are made on the first entry, so that a server down does not fail the logger.
+func buildSinkCores(conf LogConf, levels *Levels) ([]zapcore.Core, []func() error) {
+	var cores []zapcore.Core
+	var closers []func() error
+	for _, sc := range conf.Sinks.Syslog {
+		// 连接和发送在AsyncWriter的协程中 服务器不可达时不阻塞记录日志的协程
+		w := NewSyslogWriter(sc)
+		enc := w.Encoder(syslogEncoder(&conf, sc.Format))
+		aw := NewAsyncWriter(w, w.Close, AsyncConf{}, clock.Real()).WriteEach()
+		aw.SetEncoder(enc)
+		cores = append(cores, zapcore.NewCore(enc, aw, sinkLevel(sc.Level, levels)))
+		closers = append(closers, aw.Close)
+	}
+	for _, hc := range conf.Sinks.HTTP {
+		hw := NewHTTPWriter(hc, clock.Real())
+		aw := NewAsyncWriter(hw, hw.Close, AsyncConf{Size: hc.BufferSize, FlushInterval: hc.FlushInterval}, clock.Real())
+		enc := shipperEncoder(&conf)
+		aw.SetEncoder(enc)
+		sw := &httpSinkWriter{AsyncWriter: aw, hw: hw}
+		cores = append(cores, zapcore.NewCore(enc, sw, sinkLevel(hc.Level, levels)))
+		closers = append(closers, sw.Close)
+	}
+	return cores, closers
+}
+
+// httpSinkWriter bounds the flushes of Sync and Close by the timeout of a post,
+// so that a server down doesn't block them through the retries. The batches left are spooled.
+type httpSinkWriter struct {
+	*AsyncWriter
+	hw *HTTPWriter
+}
+
+func (s *httpSinkWriter) Sync() error {
+	dl := s.hw.clk.Now().Add(s.hw.Timeout())
+	s.hw.SetDeadline(dl)
+	defer s.hw.clearDeadline(dl)
+	return s.AsyncWriter.Sync()
+}
+
+// Close keeps the deadline, the writer is not used after.
+func (s *httpSinkWriter) Close() error {
+	s.hw.SetDeadline(s.hw.clk.Now().Add(s.hw.Timeout()))
+	return s.AsyncWriter.Close()
+}
+
+// syslogEncoder encodes the MSG part, the time and level are in the syslog header.
+func syslogEncoder(conf *LogConf, format string) zapcore.Encoder {
+	config := getEncoderConfig(conf)
+	config.TimeKey = ""
+	config.EncodeLevel = zapcore.LowercaseLevelEncoder
+	config.LineEnding = "\n"
+	if format == "json" {
+		return redactEncoderOf(conf, zapcore.NewJSONEncoder(config))
+	}
+	return redactEncoderOf(conf, zapcore.NewConsoleEncoder(config))
+}
+
+// shipperEncoder encodes one JSON object per line with an RFC 3339 time.
+func shipperEncoder(conf *LogConf) zapcore.Encoder {
+	config := getEncoderConfig(conf)
+	config.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	config.EncodeLevel = zapcore.LowercaseLevelEncoder
+	config.LineEnding = "\n"
+	return redactEncoderOf(conf, zapcore.NewJSONEncoder(config))
+}
@@ -0,0 +1,283 @@
+package log_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"common/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newSyslogLogger(conf log.SyslogConf) (*zap.Logger, *log.SyslogWriter) {
+	w := log.NewSyslogWriter(conf)
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	return zap.New(log.NewSyslogCore(w, enc, zap.DebugLevel)), w
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	conf := log.LogConf{
+		Director: t.TempDir(),
+		Rotated:  log.RotatedConf{Filename: "syslog.log"},
+		Sinks: log.SinksConf{Syslog: []log.SyslogConf{{
+			Network: "udp", Address: pc.LocalAddr().String(), Level: "warn",
+			AppName: "gateway", Hostname: "gw 01", Format: "json",
+		}}},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	logger.Info("not sent")
+	logger.Named("sensor").Warn("too hot", zap.Int("temp", 90))
+
+	buf := make([]byte, 2048)
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	assert.Regexp(t, regexp.MustCompile(`^<12>1 \d{4}-\d\d-\d\dT\S+ gw01 gateway \d+ sensor - \{`), msg)
+	assert.Contains(t, msg, `"message":"too hot"`)
+	assert.Contains(t, msg, `"temp":90`)
+	assert.NotContains(t, msg, "not sent")
+}
+
+// readFrames sends the octet counted frames of the first connection to ln.
+func readFrames(ln net.Listener) <-chan string {
+	frames := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			l, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(l))
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+			frames <- string(frame)
+		}
+	}()
+	return frames
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	frames := readFrames(ln)
+
+	logger, w := newSyslogLogger(log.SyslogConf{Network: "tcp", Address: ln.Addr().String(), Facility: "local0", AppName: "app"})
+	defer w.Close()
+	logger.Error("first")
+	logger.Debug("second")
+
+	assert.Regexp(t, `^<131>1 .* app \d+ - - \{"msg":"first"\}$`, <-frames)
+	assert.Regexp(t, `^<135>1 .* - - \{"msg":"second"\}$`, <-frames)
+}
+
+func TestSyslogStreams(t *testing.T) {
+	dir, err := os.MkdirTemp("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct{ network, address string }{
+		{"tcp4", "127.0.0.1:0"},
+		{"unix", filepath.Join(dir, "log.sock")},
+	} {
+		ln, err := net.Listen(tc.network, tc.address)
+		require.NoError(t, err)
+		frames := readFrames(ln)
+
+		conf := log.SyslogConf{Network: tc.network, Address: ln.Addr().String()}
+		require.NoError(t, conf.Validate())
+		logger, w := newSyslogLogger(conf)
+		logger.Info("framed")
+		logger.Info("too")
+		assert.Regexp(t, `\{"msg":"framed"\}$`, <-frames, tc.network)
+		assert.Regexp(t, `\{"msg":"too"\}$`, <-frames, tc.network)
+		w.Close()
+		ln.Close()
+	}
+}
+
+func TestSyslogUnreachable(t *testing.T) {
+	// 192.0.2.0/24 is reserved for the documentation, the connections hang or fail
+	conf := log.LogConf{
+		Director: t.TempDir(),
+		Rotated:  log.RotatedConf{Filename: "syslog.log"},
+		Sinks: log.SinksConf{Syslog: []log.SyslogConf{{
+			Network: "tcp", Address: "192.0.2.1:514", Timeout: 2 * time.Second,
+		}}},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+
+	begin := time.Now()
+	for i := 0; i < 100; i++ {
+		logger.Warn("server down", zap.Int("i", i))
+	}
+	assert.Less(t, time.Since(begin), 500*time.Millisecond)
+	log.CloseLoggers()
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger, w := newSyslogLogger(log.SyslogConf{Network: "unixgram", Address: addr})
+	defer w.Close()
+	logger.Info("local")
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Regexp(t, `^<14>1 .* - - \{"msg":"local"\}$`, string(buf[:n]))
+}
+
+type shipServer struct {
+	fail   atomic.Bool
+	mu     sync.Mutex
+	events []string
+	header string
+}
+
+func (s *shipServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if s.fail.Load() {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var batch []map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = r.Header.Get("X-Token")
+	for _, e := range batch {
+		s.events = append(s.events, e["message"].(string))
+	}
+}
+
+func (s *shipServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.events...)
+}
+
+func TestHTTPWriterSpool(t *testing.T) {
+	s := &shipServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	spool := t.TempDir()
+	w := log.NewHTTPWriter(log.HTTPConf{
+		URL: srv.URL, BatchSize: 2, MaxRetries: 1, RetryBackoff: time.Millisecond, SpoolDir: spool,
+	}, nil)
+
+	s.fail.Store(true)
+	_, err := w.Write([]byte(`{"message":"a"}` + "\n" + `{"message":"b"}` + "\n" + `{"message":"c"}` + "\n"))
+	assert.Error(t, err)
+	assert.Len(t, w.Spooled(), 2)
+	assert.Empty(t, s.received())
+
+	s.fail.Store(false)
+	_, err = w.Write([]byte(`{"message":"d"}` + "\n"))
+	require.NoError(t, err)
+	assert.Empty(t, w.Spooled())
+	assert.Equal(t, []string{"d", "a", "b", "c"}, s.received())
+}
+
+func TestNewHTTPSink(t *testing.T) {
+	s := &shipServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	conf := log.LogConf{
+		Level:    "info",
+		Director: t.TempDir(),
+		Rotated:  log.RotatedConf{Filename: "ship.log"},
+		Sinks: log.SinksConf{HTTP: []log.HTTPConf{{
+			URL: srv.URL, Headers: map[string]string{"X-Token": "t0k"}, FlushInterval: time.Hour,
+		}}},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	logger.Info("shipped")
+	logger.Debug("filtered")
+	require.NoError(t, log.Sync())
+	assert.Equal(t, []string{"shipped"}, s.received())
+	assert.Equal(t, "t0k", s.header)
+
+	conf.Sinks.HTTP[0].URL = "ftp://example"
+	_, err = log.New(conf)
+	assert.ErrorContains(t, err, "sinks.http[0]")
+}
+
+func TestHTTPSinkCloseBounded(t *testing.T) {
+	s := &shipServer{}
+	s.fail.Store(true)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	spool := t.TempDir()
+	conf := log.LogConf{
+		Director: t.TempDir(),
+		Rotated:  log.RotatedConf{Filename: "ship.log"},
+		Sinks: log.SinksConf{HTTP: []log.HTTPConf{{
+			URL: srv.URL, FlushInterval: time.Hour, Timeout: 200 * time.Millisecond,
+			MaxRetries: 10, RetryBackoff: time.Second, SpoolDir: spool,
+		}}},
+	}
+	logger, err := log.New(conf)
+	require.NoError(t, err)
+	logger.Info("kept")
+
+	// the retries would take over 17 minutes, the flush stops at the timeout and spools the batch
+	begin := time.Now()
+	assert.Error(t, log.Sync())
+	logger.Info("kept too")
+	log.CloseLoggers()
+	assert.Less(t, time.Since(begin), 2*time.Second)
+
+	names, err := filepath.Glob(filepath.Join(spool, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, names, 2)
+	assert.Empty(t, s.received())
+}
@@ -0,0 +1,159 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	BackendZap  = "zap"
+	BackendSlog = "slog"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ slog.Handler = (*ZapHandler)(nil)
+)
+
+// ZapHandler is a slog.Handler writing to a zap core, so that a slog.Logger
+// shares the files, levels, sampling and redaction of the zap loggers.
+// The trace carried by the context of a record is added as fields.
+type ZapHandler struct {
+	core zapcore.Core
+	name string
+}
+
+// NewZapHandler returns the handler writing to core.
+func NewZapHandler(core zapcore.Core) *ZapHandler {
+	return &ZapHandler{core: core}
+}
+
+// Named returns a copy of the handler writing the records under the logger name.
+func (h *ZapHandler) Named(name string) *ZapHandler {
+	return &ZapHandler{core: h.core, name: name}
+}
+
+func (h *ZapHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return h.core.Enabled(zapLevel(lvl))
+}
+
+func (h *ZapHandler) Handle(ctx context.Context, rec slog.Record) error {
+	ent := zapcore.Entry{
+		Level:      zapLevel(rec.Level),
+		Time:       rec.Time,
+		LoggerName: h.name,
+		Message:    rec.Message,
+	}
+	ce := h.core.Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+	if rec.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{rec.PC}).Next()
+		ce.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		ce.Caller.Function = frame.Function
+	}
+
+	fields := TraceFields(ctx)
+	rec.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, a)
+		return true
+	})
+	ce.Write(fields...)
+	return nil
+}
+
+func (h *ZapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]zapcore.Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendAttr(fields, a)
+	}
+	return &ZapHandler{core: h.core.With(fields), name: h.name}
+}
+
+// WithGroup nests the fields added afterwards in the namespace name.
+func (h *ZapHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	return &ZapHandler{core: h.core.With([]zapcore.Field{zap.Namespace(name)}), name: h.name}
+}
+
+// zapLevel maps the slog levels to the zap levels, the levels between round down.
+func zapLevel(lvl slog.Level) zapcore.Level {
+	switch {
+	case lvl < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case lvl < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case lvl < slog.LevelError:
+		return zapcore.WarnLevel
+	}
+	return zapcore.ErrorLevel
+}
+
+func appendAttr(fields []zapcore.Field, a slog.Attr) []zapcore.Field {
+	v := a.Value.Resolve()
+	if a.Key == "" && v.Kind() != slog.KindGroup {
+		// empty attrs are ignored as in slog
+		return fields
+	}
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, zap.String(a.Key, v.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(a.Key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(a.Key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(a.Key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(a.Key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(a.Key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(a.Key, v.Time()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key == "" {
+			// inline the attrs of a group without key
+			for _, ga := range attrs {
+				fields = appendAttr(fields, ga)
+			}
+			return fields
+		}
+		return append(fields, zap.Object(a.Key, groupMarshaler(attrs)))
+	}
+	if err, ok := v.Any().(error); ok {
+		return append(fields, zap.NamedError(a.Key, err))
+	}
+	return append(fields, zap.Any(a.Key, v.Any()))
+}
+
+type groupMarshaler []slog.Attr
+
+func (g groupMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, a := range g {
+		for _, f := range appendAttr(nil, a) {
+			f.AddTo(enc)
+		}
+	}
+	return nil
+}
+
+// NewSlog validates conf and creates the slog.Logger writing to the logger of New,
+// whatever the Backend of conf.
+func NewSlog(conf LogConf, opts ...Option) (*slog.Logger, error) {
+	logger, err := newLogger(conf, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(NewZapHandler(logger.Core())), nil
+}
@@ -0,0 +1,78 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"common/log"
+	mdl "common/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestZapHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey, enc.CallerKey = "", ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(enc), zapcore.AddSync(buf), zap.InfoLevel)
+	logger := slog.New(log.NewZapHandler(core).Named("gw")).With("a", 1).WithGroup("g")
+
+	ctx := mdl.ContextWithTrace(context.Background(), "t1", "s1")
+	logger.InfoContext(ctx, "hello", "b", 2, slog.Group("sub", "c", "x"))
+	logger.Debug("filtered")
+	logger.Warn("warned")
+
+	out := buf.String()
+	assert.Contains(t, out, `"level":"info","logger":"gw","msg":"hello","a":1,"g":{"trace":"t1","span":"s1","b":2,"sub":{"c":"x"}}`)
+	assert.Contains(t, out, `"level":"warn"`)
+	assert.NotContains(t, out, "filtered")
+}
+
+func TestSlogBackend(t *testing.T) {
+	prevL, prevSlog := mdl.Zap(), slog.Default()
+	defer func() {
+		log.ReplaceGlobals(prevL)
+		slog.SetDefault(prevSlog)
+	}()
+
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "info",
+		Backend:  log.BackendSlog,
+		Director: dir,
+		Format:   "json",
+		Rotated:  log.RotatedConf{Filename: "slog.log"},
+	}
+	_, err := log.New(conf, log.WithReplaceGlobals())
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+
+	_, isZap := mdl.ZapOf(mdl.Log())
+	assert.False(t, isZap)
+	slog.Info("from slog", "n", 1)
+	mdl.Log().With("kind", "lib").Warn("from library")
+	require.NoError(t, log.Sync())
+
+	out := readFile(t, filepath.Join(dir, "slog.log"))
+	assert.Contains(t, out, `"msg":"from slog","n":1`)
+	assert.Contains(t, out, `"msg":"from library","kind":"lib"`)
+
+	// the slog Backend only selects the library Logger
+	_, err = log.New(conf)
+	assert.ErrorIs(t, err, log.ErrSlogBackend)
+	sl, err := log.NewSlog(conf)
+	require.NoError(t, err)
+	sl.Info("own slog")
+	require.NoError(t, log.Sync())
+	assert.Contains(t, readFile(t, filepath.Join(dir, "slog.log")), `"msg":"own slog"`)
+
+	conf.Backend = "logrus"
+	_, err = log.NewSlog(conf)
+	assert.ErrorContains(t, err, "backend")
+}
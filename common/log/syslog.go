@@ -0,0 +1,236 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	syslogTimeFormat     = "2006-01-02T15:04:05.000000Z07:00"
+	defaultSyslogTimeout = 5 * time.Second
+)
+
+var (
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+		"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+		"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+
+	//Verify Satisfies interfaces
+	_ zapcore.WriteSyncer = (*SyslogWriter)(nil)
+	_ zapcore.Encoder     = (*syslogEntryEncoder)(nil)
+)
+
+// syslogSeverity maps the zap levels to the RFC 5424 severities.
+func syslogSeverity(lvl zapcore.Level) int {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // informational
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // error
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return 2 // critical
+	default:
+		return 1 // alert
+	}
+}
+
+// SyslogWriter sends RFC 5424 messages to a syslog server, a message per Write.
+// On the stream networks, tcp tcp4 tcp6 and unix, the messages are framed by octet counting (RFC 6587).
+// The connection is made on the first message and remade once when a write fails.
+// The writes block up to twice the timeout on a server down, the loggers write through an AsyncWriter.
+// After a failed connection the messages fail at once for the timeout, not to block a flush per message.
+type SyslogWriter struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	timeout  time.Duration
+
+	mu        *sync.Mutex // guards conn downUntil
+	conn      net.Conn
+	downUntil time.Time // 连接失败后在此之前不再重连
+}
+
+// NewSyslogWriter returns the writer of conf, the conf should be validated.
+func NewSyslogWriter(conf SyslogConf) *SyslogWriter {
+	facility, ok := syslogFacilities[conf.Facility]
+	if !ok {
+		facility = syslogFacilities["user"]
+	}
+	hostname := conf.Hostname
+	if len(hostname) == 0 {
+		hostname, _ = os.Hostname()
+	}
+	appName := conf.AppName
+	if len(appName) == 0 {
+		appName = filepath.Base(os.Args[0])
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultSyslogTimeout
+	}
+	return &SyslogWriter{
+		network:  conf.Network,
+		address:  conf.Address,
+		facility: facility,
+		hostname: syslogField(hostname, 255),
+		appName:  syslogField(appName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+		timeout:  timeout,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Format returns the RFC 5424 message of an entry,
+// the logger name is the MSGID and there is no structured data.
+func (w *SyslogWriter) Format(lvl zapcore.Level, t time.Time, name string, msg []byte) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<%d>1 %s %s %s %s %s - ",
+		w.facility*8+syslogSeverity(lvl),
+		t.Format(syslogTimeFormat),
+		w.hostname, w.appName, w.procID, syslogField(name, 32))
+	buf.Write(msg)
+	return buf.Bytes()
+}
+
+// WriteEntry sends the message of an entry.
+func (w *SyslogWriter) WriteEntry(lvl zapcore.Level, t time.Time, name string, msg []byte) error {
+	_, err := w.Write(w.Format(lvl, t, name, msg))
+	return err
+}
+
+// Write sends p, a message formatted by Format.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	frame := p
+	if isStream(w.network) {
+		frame = append([]byte(strconv.Itoa(len(p))+" "), p...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.send(frame)
+	if err != nil {
+		// the server may have restarted, try a new connection once
+		w.closeConn()
+		err = w.send(frame)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// isStream reports whether the messages sent on network need a frame, those of the datagrams don't.
+func isStream(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+// Sync does nothing, the messages are sent by Write.
+func (w *SyslogWriter) Sync() error {
+	return nil
+}
+
+// must hold w.mu
+func (w *SyslogWriter) send(frame []byte) error {
+	if w.conn == nil {
+		if time.Now().Before(w.downUntil) {
+			return fmt.Errorf("log: syslog %s %s is down", w.network, w.address)
+		}
+		conn, err := net.DialTimeout(w.network, w.address, w.timeout)
+		if err != nil {
+			w.downUntil = time.Now().Add(w.timeout)
+			return err
+		}
+		w.conn = conn
+	}
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	_, err := w.conn.Write(frame)
+	return err
+}
+
+// must hold w.mu
+func (w *SyslogWriter) closeConn() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogField returns s as a header field: printable ascii without spaces, at most max long, "-" if empty.
+func syslogField(s string, max int) string {
+	bs := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(bs) < max; i++ {
+		if c := s[i]; c > ' ' && c < 127 {
+			bs = append(bs, c)
+		}
+	}
+	if len(bs) == 0 {
+		return "-"
+	}
+	return string(bs)
+}
+
+// Encoder returns the encoder of the RFC 5424 messages of w, enc encodes their MSG part.
+func (w *SyslogWriter) Encoder(enc zapcore.Encoder) zapcore.Encoder {
+	return &syslogEntryEncoder{Encoder: enc, w: w}
+}
+
+// syslogEntryEncoder encodes an entry with its Encoder and adds the syslog header.
+type syslogEntryEncoder struct {
+	zapcore.Encoder
+	w *SyslogWriter
+}
+
+func (e *syslogEntryEncoder) Clone() zapcore.Encoder {
+	return &syslogEntryEncoder{Encoder: e.Encoder.Clone(), w: e.w}
+}
+
+func (e *syslogEntryEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	msg := e.w.Format(ent.Level, ent.Time, ent.LoggerName, bytes.TrimRight(buf.Bytes(), "\n"))
+	buf.Reset()
+	buf.Write(msg)
+	return buf, nil
+}
+
+// NewSyslogCore returns the core sending the entries enabled by level to w, on the logging goroutine.
+func NewSyslogCore(w *SyslogWriter, enc zapcore.Encoder, level zapcore.LevelEnabler) zapcore.Core {
+	return zapcore.NewCore(w.Encoder(enc), w, level)
+}
@@ -3,9 +3,11 @@ package log
 import (
 	"common"
 	"os"
+	"sync"
 	"time"
 
 	mdl "common/model"
+	"common/model/clock"
 
 	"github.com/natefinch/lumberjack"
 	"github.com/spf13/viper"
@@ -17,135 +19,292 @@ var (
 	glogconf      LogConf
 	glogConfigTag = "log_property"
 	gViper        *viper.Viper
-	L             = mdl.L
+	// L is the initial library zap logger.
+	//
+	// Deprecated: use mdl.Zap which returns the logger set by ReplaceGlobals.
+	L = mdl.L
+
+	gmu          = &sync.RWMutex{} // guards glogconf gViper greloadables
+	greloadables []reloadable
 )
 
 type LogConf struct {
-	Level         string      `mapstructure:"level" json:"level" yaml:"level"`                                  // 级别
-	Format        string      `mapstructure:"format" json:"format" yaml:"format"`                               // 输出
-	Prefix        string      `mapstructure:"prefix" json:"prefix" yaml:"prefix"`                               // 日志前缀
-	Director      string      `mapstructure:"director" json:"director"  yaml:"director"`                        // 日志文件夹
-	ShowLine      bool        `mapstructure:"show-line" json:"show-line" yaml:"show-line"`                      // 显示行
-	EncodeLevel   string      `mapstructure:"encode-level" json:"encode-level" yaml:"encode-level"`             // 编码级
-	StacktraceKey string      `mapstructure:"stacktrace-key" json:"stacktrace-key" yaml:"stacktrace-key"`       // 栈名
-	LogInConsole  bool        `mapstructure:"log-in-console" json:"log-in-console" yaml:"log-in-console"`       // 输出控制台
-	CallerEnable  bool        `mapstructure:"caller-enable" json:"caller-enable" yaml:"caller-enable"`          // 显示调用函数
-	Rotated       RotatedConf `mapstructure:"rotated-property" json:"rotated-property" yaml:"rotated-property"` // 日志循环覆盖
+	// 级别
+	Level string `mapstructure:"level" json:"level" yaml:"level" default:"info" desc:"minimum level" validate:"omitempty,oneof=debug info warn warning error dpanic panic fatal"`
+	// 库日志接口的后端 zap或slog 只在New使用WithReplaceGlobals时生效
+	Backend string `mapstructure:"backend" json:"backend" yaml:"backend" default:"zap" validate:"omitempty,oneof=zap slog" desc:"backend of the library Logger"`
+	// 按logger名称的级别
+	NamedLevels map[string]string `mapstructure:"named-levels" json:"named-levels" yaml:"named-levels" desc:"levels by logger name"`
+	// 输出
+	Format string `mapstructure:"format" json:"format" yaml:"format" default:"console" validate:"omitempty,oneof=console json" desc:"encoding of the entries"`
+	// 日志前缀
+	Prefix string `mapstructure:"prefix" json:"prefix" yaml:"prefix" desc:"prefix of the messages"`
+	// 日志文件夹
+	Director string `mapstructure:"director" json:"director"  yaml:"director" desc:"directory of the log files, relative to the executable"`
+	// 显示行
+	ShowLine bool `mapstructure:"show-line" json:"show-line" yaml:"show-line" desc:"add the file and line of the logging call to the entries of New"`
+	// 编码级
+	EncodeLevel string `mapstructure:"encode-level" json:"encode-level" yaml:"encode-level" default:"LowercaseLevelEncoder" desc:"encoding of the level" validate:"omitempty,oneof=LowercaseLevelEncoder LowercaseColorLevelEncoder CapitalLevelEncoder CapitalColorLevelEncoder"`
+	// 栈名
+	StacktraceKey string `mapstructure:"stacktrace-key" json:"stacktrace-key" yaml:"stacktrace-key" desc:"key of the stacktraces, empty omits them"`
+	// 输出控制台
+	LogInConsole bool `mapstructure:"log-in-console" json:"log-in-console" yaml:"log-in-console" desc:"also write to stdout"`
+	// 按级别分文件输出
+	LevelFiles bool `mapstructure:"level-files" json:"level-files" yaml:"level-files" desc:"write a file by level"`
+	// 显示调用函数
+	CallerEnable bool `mapstructure:"caller-enable" json:"caller-enable" yaml:"caller-enable" desc:"add the file and line of the logging call to the entries of New and Zap"`
+	// 日志循环覆盖
+	Rotated RotatedConf `mapstructure:"rotated-property" json:"rotated-property" yaml:"rotated-property" desc:"rotation of the log files"`
+	// 采样 限流 重复合并
+	Sampling SamplingConf `mapstructure:"sampling" json:"sampling" yaml:"sampling" desc:"sampling, rate limiting and deduplication"`
+	// 异步缓冲写入
+	Async AsyncConf `mapstructure:"async" json:"async" yaml:"async" desc:"buffered asynchronous writes"`
+	// 远程输出 syslog http
+	Sinks SinksConf `mapstructure:"sinks" json:"sinks" yaml:"sinks" desc:"remote syslog and HTTP outputs"`
+	// 敏感字段脱敏
+	Redact RedactConf `mapstructure:"redact" json:"redact" yaml:"redact" desc:"masking of the sensitive fields"`
 }
 
 type RotatedConf struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
 	// os.TempDir() if empty.
-	Filename string `mapstructure:"filename" json:"filename" yaml:"filename"`
+	Filename string `mapstructure:"filename" json:"filename" yaml:"filename" desc:"log file, relative to director"`
 
 	// MaxSize is the maximum size in megabytes of the log file before it gets
-	// rotated. It defaults to 100 megabytes.
-	MaxSize int `mapstructure:"maxsize" json:"maxsize" yaml:"maxsize"`
+	// rotated. It defaults to 100 megabytes, 0 is the default too.
+	MaxSize int `mapstructure:"maxsize" json:"maxsize" yaml:"maxsize" default:"100" validate:"min=0" desc:"maximum size in megabytes of a log file, 0 is 100"`
 
 	// MaxAge is the maximum number of days to retain old log files based on the
 	// timestamp encoded in their filename.  Note that a day is defined as 24
 	// hours and may not exactly correspond to calendar days due to daylight
 	// savings, leap seconds, etc. The default is not to remove old log files
 	// based on age.
-	MaxAge int `mapstructure:"maxage" json:"maxage" yaml:"maxage"`
+	MaxAge int `mapstructure:"maxage" json:"maxage" yaml:"maxage" validate:"min=0" desc:"maximum days to retain the old log files, 0 retains them"`
 
 	// MaxBackups is the maximum number of old log files to retain.  The default
 	// is to retain all old log files (though MaxAge may still cause them to get
 	// deleted.)
-	MaxBackups int `mapstructure:"maxbackups" json:"maxbackups" yaml:"maxbackups"`
+	MaxBackups int `mapstructure:"maxbackups" json:"maxbackups" yaml:"maxbackups" validate:"min=0" desc:"maximum number of old log files, 0 retains them"`
 
 	// LocalTime determines if the time used for formatting the timestamps in
 	// backup files is the computer's local time.  The default is to use UTC
 	// time.
-	LocalTime bool `mapstructure:"localtime" json:"localtime" yaml:"localtime"`
+	LocalTime bool `mapstructure:"localtime" json:"localtime" yaml:"localtime" desc:"name the backups in local time instead of UTC"`
 
 	// Compress determines if the rotated log files should be compressed
 	// using gzip. The default is not to perform compression.
-	Compress bool `mapstructure:"compress" json:"compress" yaml:"compress"`
+	Compress bool `mapstructure:"compress" json:"compress" yaml:"compress" desc:"gzip the old log files"`
+
+	// Every rotates the log file by time, "hourly" "daily" or a duration such as "30m".
+	// The default is not to rotate by time. A Filename with a time layout in braces,
+	// e.g. "app-{2006-01-02}.log", names each file by the start of its period.
+	Every string `mapstructure:"every" json:"every" yaml:"every" desc:"rotation by time: hourly, daily or a duration"`
+
+	// RotateOnStart rotates the existing log file when the process starts.
+	RotateOnStart bool `mapstructure:"rotate-on-start" json:"rotate-on-start" yaml:"rotate-on-start" desc:"rotate the existing log file on start"`
+
+	// MaxTotalSize is the maximum total size in megabytes of the old log files,
+	// the oldest are removed beyond it. The default is no limit.
+	MaxTotalSize int `mapstructure:"max-total-size" json:"max-total-size" yaml:"max-total-size" validate:"min=0" desc:"total size in MB of the old log files at most, 0 is no limit"`
+}
+
+// coreBuilder builds the cores of a LogConf enabled from levels and returns the closers of their writers.
+type coreBuilder func(conf LogConf, levels *Levels) (zapcore.Core, []func() error)
+
+// reloadable is a logger core that is synced and closed with the package loggers,
+// and rebuilt when glogconf changes if global.
+type reloadable struct {
+	h     *coreHolder
+	build coreBuilder
+	// global 跟随glogconf和gLevels 由ReloadLogConf重建 否则使用New时自己的配置和级别
+	global bool
 }
 
+// InitLogConfig reads glogconf from the viper set by SetViper or the viper global.
+//
+// Deprecated: use FromViper which returns the errors.
 func InitLogConfig() {
+	gmu.Lock()
+	defer gmu.Unlock()
+	if gViper == nil {
+		gViper = viper.GetViper()
+	}
 	if err := gViper.UnmarshalKey(glogConfigTag, &glogconf); err != nil {
-		L.Sugar().Fatalf("Read Config to struct err:%v\n", err)
+		mdl.Zap().Sugar().Fatalf("Read Config to struct err:%v\n", err)
 	} else {
-		L.Sugar().Infof("log config init : %+v\n", glogconf)
+		applyLevels(gLevels, glogconf)
+		mdl.Zap().Sugar().Infof("log config init : %+v\n", glogconf)
 	}
 }
 
-func createWriteSyncer(filename string) zapcore.WriteSyncer {
+// SetViper sets the viper InitLogConfig reads from.
+func SetViper(v *viper.Viper) {
+	gmu.Lock()
+	defer gmu.Unlock()
+	gViper = v
+}
+
+// applyLevels sets levels from conf, unknown levels are logged and fall back to info.
+func applyLevels(levels *Levels, conf LogConf) {
+	level, err := ParseLevel(conf.Level)
+	if err != nil {
+		mdl.Log().Warn("log config level invalid, use info", "err", err)
+	}
+	levels.SetLevel(level)
+
+	named := make(map[string]zapcore.Level, len(conf.NamedLevels))
+	for name, lvl := range conf.NamedLevels {
+		l, err := ParseLevel(lvl)
+		if err != nil {
+			mdl.Log().Warn("log config named level invalid, ignored", "name", name, "err", err)
+			continue
+		}
+		named[name] = l
+	}
+	levels.ReplaceNamedLevels(named)
+}
+
+// createWriteSyncer creates the writer of filename, wrapped in an AsyncWriter if Async is enabled,
+// enc encodes the dropped entry of the AsyncWriter.
+func createWriteSyncer(conf *LogConf, filename string, enc zapcore.Encoder) (zapcore.WriteSyncer, func() error) {
+	ws, closer := createFileSyncer(conf, filename)
+	if !conf.Async.Enable {
+		return ws, closer
+	}
+	aw := NewAsyncWriter(ws, closer, conf.Async, clock.Real()).SetEncoder(enc)
+	return aw, aw.Close
+}
+
+func createFileSyncer(conf *LogConf, filename string) (zapcore.WriteSyncer, func() error) {
 	if len(filename) == 0 {
-		filename = common.PathJoin(glogconf.Director, glogconf.Rotated.Filename)
+		filename = common.PathJoin(conf.Director, conf.Rotated.Filename)
 		//filename = glogconf.Director + "//" + glogconf.Rotated.Filename
 	}
 
+	if conf.Rotated.useRotateWriter() {
+		rw, err := NewRotateWriter(filename, conf.Rotated, clock.Real())
+		if err == nil {
+			if conf.LogInConsole {
+				return zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), rw), rw.Close
+			}
+			return rw, rw.Close
+		}
+		mdl.Log().Warn("log rotated-property invalid, use size rotation only", "err", err)
+	}
+
 	ljLogger := &lumberjack.Logger{
 		Filename:   filename,
-		MaxSize:    glogconf.Rotated.MaxSize,
-		MaxBackups: glogconf.Rotated.MaxBackups,
-		MaxAge:     glogconf.Rotated.MaxAge,
-		LocalTime:  glogconf.Rotated.LocalTime,
-		Compress:   glogconf.Rotated.Compress,
+		MaxSize:    conf.Rotated.MaxSize,
+		MaxBackups: conf.Rotated.MaxBackups,
+		MaxAge:     conf.Rotated.MaxAge,
+		LocalTime:  conf.Rotated.LocalTime,
+		Compress:   conf.Rotated.Compress,
 	}
 
-	if glogconf.LogInConsole {
-		return zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), zapcore.AddSync(ljLogger))
+	if conf.LogInConsole {
+		return zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), zapcore.AddSync(ljLogger)), ljLogger.Close
 	} else {
-		return zapcore.AddSync(ljLogger)
+		return zapcore.AddSync(ljLogger), ljLogger.Close
+	}
+}
+
+// decorate applies the LogConf stages shared by all the builders to the built core.
+func decorate(build coreBuilder) coreBuilder {
+	return func(conf LogConf, levels *Levels) (zapcore.Core, []func() error) {
+		core, closers := build(conf, levels)
+		if sinks, sinkClosers := buildSinkCores(conf, levels); len(sinks) > 0 {
+			core = zapcore.NewTee(append([]zapcore.Core{core}, sinks...)...)
+			closers = append(closers, sinkClosers...)
+		}
+		core = wrapSampling(core, conf.Sampling)
+		return core, closers
 	}
 }
 
+// newReloadableLogger registers the cores built from glogconf for reloading
+// and returns a logger whose level follows the package levels.
+func newReloadableLogger(build coreBuilder) *zap.Logger {
+	build = decorate(build)
+	gmu.Lock()
+	core, closers := build(glogconf, gLevels)
+	h := newCoreHolder(core, closers...)
+	greloadables = append(greloadables, reloadable{h: h, build: build, global: true})
+	gmu.Unlock()
+
+	return zap.New(newLevelCore(newReloadCore(h), gLevels))
+}
+
+// newConfLogger returns a logger built from conf whose level follows levels,
+// its cores are synced and closed with the package loggers but not rebuilt by ReloadLogConf.
+func newConfLogger(build coreBuilder, conf LogConf, levels *Levels) *zap.Logger {
+	build = decorate(build)
+	core, closers := build(conf, levels)
+	h := newCoreHolder(core, closers...)
+	gmu.Lock()
+	greloadables = append(greloadables, reloadable{h: h, build: build})
+	gmu.Unlock()
+
+	return zap.New(newLevelCore(newReloadCore(h), levels))
+}
+
+// InitLogger creates the single file logger from glogconf.
+//
+// Deprecated: use New which validates LogConf and returns the errors.
 func InitLogger() *zap.Logger {
+	gmu.Lock()
 	glogconf.Director = common.DealWithExecutingCurrentFilePath(glogconf.Director)
 	// 判断是否有Director文件夹
 	if ok, err := common.PathExists(glogconf.Director); !ok {
-		L.Sugar().Infof("Path Not Found: %v", err)
-		L.Sugar().Infof("Create directory: %+v", glogconf.Director)
+		mdl.Zap().Sugar().Infof("Path Not Found: %v", err)
+		mdl.Zap().Sugar().Infof("Create directory: %+v", glogconf.Director)
 		err = os.Mkdir(glogconf.Director, os.ModePerm)
 		if err != nil {
-			L.Sugar().Fatalf("Create directory err: %#v", err)
+			mdl.Zap().Sugar().Fatalf("Create directory err: %#v", err)
 		}
 	}
+	callerEnable := glogconf.CallerEnable
+	applyLevels(gLevels, glogconf)
+	gmu.Unlock()
 
-	w := createWriteSyncer("")
-
-	var level zapcore.Level
-	switch glogconf.Level {
-	case "debug":
-		level = zap.DebugLevel
-	case "info":
-		level = zap.InfoLevel
-	case "error":
-		level = zap.ErrorLevel
-	default:
-		level = zap.InfoLevel
+	logger := newReloadableLogger(buildLoggerCore)
+	if callerEnable {
+		logger = logger.WithOptions(zap.AddCaller())
 	}
+	return logger
+}
+
+// buildLoggerCore builds the single file core of InitLogger.
+func buildLoggerCore(conf LogConf, levels *Levels) (zapcore.Core, []func() error) {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	var core zapcore.Core
-
-	if glogconf.Format == "json" {
-		core = zapcore.NewCore(
-			zapcore.NewJSONEncoder(encoderConfig),
-			w,
-			level,
-		)
+	var enc zapcore.Encoder
+	if conf.Format == "json" {
+		enc = zapcore.NewJSONEncoder(encoderConfig)
 	} else {
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(encoderConfig),
-			w,
-			level,
-		)
-	}
-	logger := zap.New(core)
-	if glogconf.CallerEnable {
-		logger = logger.WithOptions(zap.AddCaller())
+		enc = zapcore.NewConsoleEncoder(encoderConfig)
 	}
-	return logger
+	enc = redactEncoderOf(&conf, enc)
+
+	w, closer := createWriteSyncer(&conf, "", enc)
+	core := zapcore.NewCore(enc, w, levels.Floor())
+	return core, []func() error{closer}
 }
 
 func Zap() (logger *zap.Logger) {
+	gmu.RLock()
+	applyLevels(gLevels, glogconf)
+	gmu.RUnlock()
+
+	logger = newReloadableLogger(buildZapCore)
+	logger = logger.WithOptions(zap.AddCaller())
+
+	return logger
+}
+
+// buildZapCore builds the cores of Zap which split files by level.
+func buildZapCore(conf LogConf, _ *Levels) (zapcore.Core, []func() error) {
 
 	// 调试级别
 	debugPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
@@ -164,36 +323,46 @@ func Zap() (logger *zap.Logger) {
 		return lev >= zap.ErrorLevel
 	})
 
-	cores := [...]zapcore.Core{
-
-		getEncoderCore(common.PathJoin(glogconf.Director, "debug.log"), debugPriority),
-		getEncoderCore(common.PathJoin(glogconf.Director, "info.log"), infoPriority),
-		getEncoderCore(common.PathJoin(glogconf.Director, "warn.log"), warnPriority),
-		getEncoderCore(common.PathJoin(glogconf.Director, "error.log"), errorPriority),
+	files := [...]struct {
+		name  string
+		level zapcore.LevelEnabler
+	}{
+		{"debug.log", debugPriority},
+		{"info.log", infoPriority},
+		{"warn.log", warnPriority},
+		{"error.log", errorPriority},
 	}
-	logger = zap.New(zapcore.NewTee(cores[:]...), zap.AddCaller())
-	logger = logger.WithOptions(zap.AddCaller())
 
-	return logger
+	cores := make([]zapcore.Core, 0, len(files))
+	closers := make([]func() error, 0, len(files))
+	for _, f := range files {
+		core, closer := getEncoderCore(&conf, common.PathJoin(conf.Director, f.name), f.level)
+		cores = append(cores, core)
+		closers = append(closers, closer)
+	}
+	return zapcore.NewTee(cores...), closers
 }
 
 // getEncoderConfig 获取zapcore.EncoderConfig
-func getEncoderConfig() (config zapcore.EncoderConfig) {
+func getEncoderConfig(conf *LogConf) (config zapcore.EncoderConfig) {
+	prefix := conf.Prefix
 	config = zapcore.EncoderConfig{
-		MessageKey:     "message",
-		LevelKey:       "level",
-		TimeKey:        "time",
-		NameKey:        "logger",
-		CallerKey:      "caller",
-		StacktraceKey:  glogconf.StacktraceKey,
-		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    zapcore.LowercaseLevelEncoder,
-		EncodeTime:     CustomTimeEncoder,
+		MessageKey:    "message",
+		LevelKey:      "level",
+		TimeKey:       "time",
+		NameKey:       "logger",
+		CallerKey:     "caller",
+		StacktraceKey: conf.StacktraceKey,
+		LineEnding:    zapcore.DefaultLineEnding,
+		EncodeLevel:   zapcore.LowercaseLevelEncoder,
+		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(t.Format(prefix + "2006/01/02 - 15:04:05.000"))
+		},
 		EncodeDuration: zapcore.SecondsDurationEncoder,
 		EncodeCaller:   zapcore.FullCallerEncoder,
 	}
 
-	switch glogconf.EncodeLevel {
+	switch conf.EncodeLevel {
 	case "LowercaseLevelEncoder": // 小写编码器(默认)
 		config.EncodeLevel = zapcore.LowercaseLevelEncoder
 	case "LowercaseColorLevelEncoder": // 小写编码器带颜色
@@ -209,21 +378,25 @@ func getEncoderConfig() (config zapcore.EncoderConfig) {
 }
 
 // getEncoder 获取zapcore.Encoder
-func getEncoder() zapcore.Encoder {
-	if glogconf.Format == "json" {
-		return zapcore.NewJSONEncoder(getEncoderConfig())
+func getEncoder(conf *LogConf) zapcore.Encoder {
+	if conf.Format == "json" {
+		return redactEncoderOf(conf, zapcore.NewJSONEncoder(getEncoderConfig(conf)))
 	}
-	return zapcore.NewConsoleEncoder(getEncoderConfig())
+	return redactEncoderOf(conf, zapcore.NewConsoleEncoder(getEncoderConfig(conf)))
 }
 
 // getEncoderCore 获取Encoder的zapcore.Core
-func getEncoderCore(fileName string, level zapcore.LevelEnabler) (core zapcore.Core) {
-	writer := createWriteSyncer(fileName) // 使用file-rotatelogs进行日志分割
-	return zapcore.NewCore(getEncoder(), writer, level)
+func getEncoderCore(conf *LogConf, fileName string, level zapcore.LevelEnabler) (core zapcore.Core, closer func() error) {
+	enc := getEncoder(conf)
+	writer, closer := createWriteSyncer(conf, fileName, enc) // 使用file-rotatelogs进行日志分割
+	return zapcore.NewCore(enc, writer, level), closer
 }
 
 // 自定义日志输出时间格式
 func CustomTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-	enc.AppendString(t.Format(glogconf.Prefix + "2006/01/02 - 15:04:05.000"))
+	gmu.RLock()
+	prefix := glogconf.Prefix
+	gmu.RUnlock()
+	enc.AppendString(t.Format(prefix + "2006/01/02 - 15:04:05.000"))
 	//enc.AppendString(t.Format("2006/01/02 - 15:04:05.000"))
 }
@@ -0,0 +1,272 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"common/log"
+	mdl "common/model"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	bs, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(bs)
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]zapcore.Level{
+		"":        zapcore.InfoLevel,
+		"debug":   zapcore.DebugLevel,
+		"warn":    zapcore.WarnLevel,
+		"WARNING": zapcore.WarnLevel,
+		"error":   zapcore.ErrorLevel,
+	}
+	for s, want := range cases {
+		l, err := log.ParseLevel(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, l, s)
+	}
+	_, err := log.ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLevelsNamed(t *testing.T) {
+	ls := log.NewLevels(zapcore.InfoLevel)
+	ls.SetNamedLevel("cmpt", zapcore.DebugLevel)
+	ls.SetNamedLevel("cmpt.noisy", zapcore.ErrorLevel)
+
+	assert.Equal(t, zapcore.DebugLevel, ls.LevelOf("cmpt.sensor"))
+	assert.Equal(t, zapcore.ErrorLevel, ls.LevelOf("cmpt.noisy.x"))
+	assert.Equal(t, zapcore.InfoLevel, ls.LevelOf("other"))
+	assert.True(t, ls.Floor().Enabled(zapcore.DebugLevel))
+
+	ls.UnsetNamedLevel("cmpt")
+	assert.False(t, ls.Floor().Enabled(zapcore.DebugLevel))
+}
+
+func TestDynamicLevelAndReload(t *testing.T) {
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "warn",
+		Director: dir,
+		Format:   "console",
+		Rotated:  log.RotatedConf{Filename: "app.log"},
+	}
+	require.NoError(t, log.ReloadLogConf(conf))
+	logger := log.InitLogger()
+	defer log.CloseLoggers()
+
+	logger.Info("info-dropped")
+	logger.Warn("warn-written")
+	logger.Named("cmpt").Debug("debug-dropped")
+
+	require.NoError(t, log.SetNamedLevel("cmpt", "debug"))
+	logger.Named("cmpt").Debug("debug-written")
+	logger.Named("other").Debug("other-dropped")
+	log.UnsetNamedLevel("cmpt")
+
+	require.NoError(t, log.SetLevel("info"))
+	logger.Info("info-written")
+	require.NoError(t, logger.Sync())
+
+	out := readFile(t, filepath.Join(dir, "app.log"))
+	assert.Contains(t, out, "warn-written")
+	assert.Contains(t, out, "debug-written")
+	assert.Contains(t, out, "info-written")
+	assert.NotContains(t, out, "info-dropped")
+	assert.NotContains(t, out, "debug-dropped")
+	assert.NotContains(t, out, "other-dropped")
+
+	// a file change rebuilds the cores of the existing logger
+	conf.Format = "json"
+	conf.Rotated.Filename = "app2.log"
+	require.NoError(t, log.ReloadLogConf(conf))
+	logger.With(zapcore.Field{Key: "k", Type: zapcore.StringType, String: "v"}).Warn("after-reload")
+	require.NoError(t, logger.Sync())
+
+	out2 := readFile(t, filepath.Join(dir, "app2.log"))
+	assert.Contains(t, out2, `"msg":"after-reload"`)
+	assert.Contains(t, out2, `"k":"v"`)
+	assert.NotContains(t, readFile(t, filepath.Join(dir, "app.log")), "after-reload")
+	assert.Equal(t, zapcore.WarnLevel, log.GetLevels().Level())
+
+	assert.Error(t, log.ReloadLogConf(log.LogConf{Level: "loud"}))
+}
+
+func TestReloadInFlight(t *testing.T) {
+	dir := t.TempDir()
+	conf := log.LogConf{
+		Level:    "info",
+		Director: dir,
+		Rotated:  log.RotatedConf{Filename: "app.log"},
+		Async:    log.AsyncConf{Enable: true, FlushInterval: time.Hour},
+	}
+	require.NoError(t, log.ReloadLogConf(conf))
+	logger := log.InitLogger()
+	defer log.CloseLoggers()
+
+	// an entry checked before the swap is written after it, to the old writers still open
+	ce := logger.Check(zapcore.InfoLevel, "in-flight")
+	require.NotNil(t, ce)
+	conf.Rotated.Filename = "app2.log"
+	require.NoError(t, log.ReloadLogConf(conf))
+	// however late it is written
+	time.Sleep(100 * time.Millisecond)
+	ce.Write()
+	logger.Info("after-reload")
+	require.NoError(t, log.Sync())
+
+	// the old writers are closed once the entry is written, flushing it
+	assert.Eventually(t, func() bool {
+		return strings.Contains(readFile(t, filepath.Join(dir, "app.log")), "in-flight")
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, readFile(t, filepath.Join(dir, "app2.log")), "after-reload")
+	assert.NotContains(t, readFile(t, filepath.Join(dir, "app.log")), "after-reload")
+}
+
+func TestWatchLogConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "config.yaml")
+	write := func(level string) {
+		yaml := "log_property:\n  level: " + level + "\n  director: " + dir + "\n  rotated-property:\n    filename: watch.log\n"
+		require.NoError(t, os.WriteFile(cfg, []byte(yaml), 0o644))
+	}
+	write("error")
+
+	v := viper.New()
+	v.SetConfigFile(cfg)
+	require.NoError(t, v.ReadInConfig())
+	prev := mdl.Zap()
+	defer log.ReplaceGlobals(prev)
+	_, err := log.FromViper(v, "log_property", log.WithReplaceGlobals())
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+	log.WatchLogConfig(v)
+
+	write("debug")
+	deadline := time.Now().Add(5 * time.Second)
+	for log.GetLevels().Level() != zapcore.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("level not reloaded: %s", log.GetLevels())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, strings.Contains(log.GetLevels().String(), "global:debug"))
+}
+
+func TestNew(t *testing.T) {
+	_, err := log.New(log.LogConf{Level: "loud", Format: "xml", Rotated: log.RotatedConf{MaxSize: -1}})
+	require.Error(t, err)
+	// every violation is reported
+	assert.Contains(t, err.Error(), "loud")
+	assert.Contains(t, err.Error(), "xml")
+	assert.Contains(t, err.Error(), "filename")
+	assert.Contains(t, err.Error(), "maxsize")
+
+	dir := t.TempDir()
+	logger, err := log.New(log.LogConf{Level: "info", Director: dir, LevelFiles: true})
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+	logger.Warn("warn-line")
+	logger.Error("error-line")
+	require.NoError(t, logger.Sync())
+	assert.Contains(t, readFile(t, filepath.Join(dir, "warn.log")), "warn-line")
+	assert.NotContains(t, readFile(t, filepath.Join(dir, "warn.log")), "error-line")
+	assert.Contains(t, readFile(t, filepath.Join(dir, "error.log")), "error-line")
+}
+
+func TestNewOwnLevels(t *testing.T) {
+	dir := t.TempDir()
+	ls := log.NewLevels(zapcore.InfoLevel)
+	first, err := log.New(log.LogConf{Level: "error", Director: dir, Rotated: log.RotatedConf{Filename: "first.log"}}, log.WithLevels(ls))
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+	assert.Equal(t, zapcore.ErrorLevel, ls.Level())
+	global := log.GetLevels().Level()
+
+	// a second New changes neither the first logger nor the package levels
+	second, err := log.New(log.LogConf{Level: "debug", Director: dir, Rotated: log.RotatedConf{Filename: "second.log"}})
+	require.NoError(t, err)
+	assert.Equal(t, global, log.GetLevels().Level())
+	// nor does reloading the package conf
+	defer log.SetLevel(global.String())
+	require.NoError(t, log.ReloadLogConf(log.LogConf{Level: "debug", Director: dir, Rotated: log.RotatedConf{Filename: "reloaded.log"}}))
+	first.Warn("first-warn")
+	first.Error("first-error")
+	second.Debug("second-debug")
+	require.NoError(t, log.Sync())
+	out := readFile(t, filepath.Join(dir, "first.log"))
+	assert.NotContains(t, out, "first-warn")
+	assert.Contains(t, out, "first-error")
+	assert.NotContains(t, out, "second-debug")
+	assert.Contains(t, readFile(t, filepath.Join(dir, "second.log")), "second-debug")
+
+	// the levels given by WithLevels change the logger at runtime
+	ls.SetLevel(zapcore.WarnLevel)
+	first.Warn("first-warn-again")
+	require.NoError(t, first.Sync())
+	assert.Contains(t, readFile(t, filepath.Join(dir, "first.log")), "first-warn-again")
+}
+
+func TestFromViper(t *testing.T) {
+	dir := t.TempDir()
+	v := viper.New()
+	_, err := log.FromViper(v, "logging")
+	require.ErrorIs(t, err, log.ErrConfNotFound)
+
+	v.Set("logging", map[string]any{
+		"level":            "debug",
+		"director":         dir,
+		"format":           "json",
+		"rotated-property": map[string]any{"filename": "viper.log"},
+	})
+	prev := mdl.Zap()
+	defer log.ReplaceGlobals(prev)
+
+	// the library logger is read while ReplaceGlobals replaces it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mdl.Zap().Debug("concurrent")
+	}()
+	logger, err := log.FromViper(v, "logging", log.WithReplaceGlobals())
+	require.NoError(t, err)
+	defer log.CloseLoggers()
+	<-done
+	assert.Same(t, logger, mdl.Zap())
+	assert.NotSame(t, logger, mdl.L)
+
+	mdl.Zap().Debug("through-mdl")
+	require.NoError(t, logger.Sync())
+	assert.Contains(t, readFile(t, filepath.Join(dir, "viper.log")), "through-mdl")
+}
+
+func TestCtx(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := zap.New(newBufferCore(buf))
+
+	ctx := log.WithContext(context.Background(), logger)
+	ctx = mdl.ContextWithTrace(ctx, "t1", "s1")
+	log.Ctx(ctx).Info("traced")
+	assert.Contains(t, buf.String(), `"trace":"t1","span":"s1"`)
+
+	assert.Same(t, mdl.Zap(), log.Ctx(context.Background()))
+	assert.Len(t, mdl.NewTraceID(), 32)
+	assert.Len(t, mdl.NewSpanID(), 16)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	TextContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var (
+	helpEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	omHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	valueEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// WriteText writes the metrics of r in the Prometheus text format 0.0.4.
+func (r *Registry) WriteText(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes the metrics of r in the OpenMetrics 1.0 text format.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+// Handler serves the metrics of r, in OpenMetrics when the client accepts it
+// and in the Prometheus text format otherwise.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		om := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		var buf bytes.Buffer
+		if err := r.write(&buf, om); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if om {
+			rw.Header().Set("Content-Type", OpenMetricsContentType)
+		} else {
+			rw.Header().Set("Content-Type", TextContentType)
+		}
+		_, _ = rw.Write(buf.Bytes())
+	})
+}
+
+func (r *Registry) write(w io.Writer, om bool) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families() {
+		ss := f.sorted()
+		name := f.name
+		if om && f.typ == CounterType {
+			// OpenMetrics names the counter family without the _total suffix of its sample
+			name = strings.TrimSuffix(name, "_total")
+		}
+		if len(f.help) > 0 {
+			bw.WriteString("# HELP " + name + " ")
+			if om {
+				omHelpEscaper.WriteString(bw, f.help)
+			} else {
+				helpEscaper.WriteString(bw, f.help)
+			}
+			bw.WriteByte('\n')
+		}
+		bw.WriteString("# TYPE " + name + " " + string(f.typ) + "\n")
+		for _, s := range ss {
+			switch f.typ {
+			case CounterType:
+				sample := f.name
+				if om {
+					sample = name + "_total"
+				}
+				writeSample(bw, sample, f.labels, s.values, "", 0, s.load())
+			case GaugeType:
+				writeSample(bw, f.name, f.labels, s.values, "", 0, s.load())
+			case HistogramType:
+				cum, sum, count := s.snapshot()
+				for i, b := range f.buckets {
+					writeSample(bw, f.name+"_bucket", f.labels, s.values, "le", b, float64(cum[i]))
+				}
+				writeSample(bw, f.name+"_bucket", f.labels, s.values, "le", math.Inf(1), float64(count))
+				writeSample(bw, f.name+"_sum", f.labels, s.values, "", 0, sum)
+				writeSample(bw, f.name+"_count", f.labels, s.values, "", 0, float64(count))
+			}
+		}
+	}
+	if om {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// writeSample writes a sample line, with the label le of a bucket when it's not empty.
+func writeSample(bw *bufio.Writer, name string, labels, values []string, le string, bound, v float64) {
+	bw.WriteString(name)
+	if len(labels) > 0 || len(le) > 0 {
+		bw.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteString(l + `="`)
+			valueEscaper.WriteString(bw, values[i])
+			bw.WriteByte('"')
+		}
+		if len(le) > 0 {
+			if len(labels) > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteString(le + `="` + formatFloat(bound) + `"`)
+		}
+		bw.WriteByte('}')
+	}
+	bw.WriteByte(' ')
+	bw.WriteString(formatFloat(v))
+	bw.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,420 @@
+// Package metrics records counters, gauges and histograms with labels and exposes them
+// in the Prometheus text and OpenMetrics formats. It depends on the standard library only.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type is the type of a metric family.
+type Type string
+
+const (
+	CounterType   Type = "counter"
+	GaugeType     Type = "gauge"
+	HistogramType Type = "histogram"
+)
+
+var (
+	// Default is the Registry of the process, served by the admin server.
+	Default = NewRegistry()
+
+	// DefBuckets are the default histogram buckets, in seconds for the durations.
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	nameRe  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// LinearBuckets returns count buckets from start, width apart.
+func LinearBuckets(start, width float64, count int) []float64 {
+	bs := make([]float64, count)
+	for i := range bs {
+		bs[i] = start + float64(i)*width
+	}
+	return bs
+}
+
+// ExponentialBuckets returns count buckets from start, each factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bs := make([]float64, count)
+	for i := range bs {
+		bs[i] = start
+		start *= factor
+	}
+	return bs
+}
+
+// Registry holds the metric families. A Registry returned by With shares the families
+// of its parent and adds its constant labels to the metrics registered through it.
+type Registry struct {
+	fams   *families
+	names  []string // 常量标签名
+	values []string // 常量标签值
+}
+
+type families struct {
+	mu     *sync.RWMutex // guards byName
+	byName map[string]*family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{fams: &families{mu: &sync.RWMutex{}, byName: make(map[string]*family)}}
+}
+
+// With returns a Registry sharing the families of r which adds the constant labels kv,
+// given as name, value pairs, to the metrics registered through it.
+func (r *Registry) With(kv ...string) *Registry {
+	if len(kv)%2 != 0 {
+		panic(fmt.Sprintf("metrics: odd label pairs %q", kv))
+	}
+	sub := &Registry{
+		fams:   r.fams,
+		names:  slices.Clone(r.names),
+		values: slices.Clone(r.values),
+	}
+	for i := 0; i < len(kv); i += 2 {
+		sub.names = append(sub.names, kv[i])
+		sub.values = append(sub.values, kv[i+1])
+	}
+	return sub
+}
+
+// Component returns the Registry of the component kind:id, see With.
+func (r *Registry) Component(kind, id string) *Registry {
+	return r.With("kind", kind, "id", id)
+}
+
+// Counter registers the counter name with the label names, or returns it if it's registered
+// with the same labels. It panics if name is registered otherwise.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, CounterType, nil, labels)}
+}
+
+// Gauge registers the gauge name, see Counter.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, GaugeType, nil, labels)}
+}
+
+// Histogram registers the histogram name with the bucket upper bounds, DefBuckets if nil,
+// see Counter.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	if math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	return &Histogram{r.register(name, help, HistogramType, buckets, labels)}
+}
+
+// Unregister removes the family name with all its series.
+func (r *Registry) Unregister(name string) bool {
+	r.fams.mu.Lock()
+	defer r.fams.mu.Unlock()
+	_, ok := r.fams.byName[name]
+	delete(r.fams.byName, name)
+	return ok
+}
+
+// DeleteSeries removes the series of every family having the constant labels of r, e.g. the
+// ones of a Component registry when the component is removed. It returns the number removed,
+// a Registry without constant labels removes none.
+func (r *Registry) DeleteSeries() int {
+	if len(r.names) == 0 {
+		return 0
+	}
+	n := 0
+	for _, f := range r.families() {
+		n += f.deleteMatching(r.names, r.values)
+	}
+	return n
+}
+
+func (r *Registry) register(name, help string, typ Type, buckets []float64, labels []string) handle {
+	if !nameRe.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	names := append(slices.Clone(r.names), labels...)
+	for i, l := range names {
+		if !labelRe.MatchString(l) || strings.HasPrefix(l, "__") || (typ == HistogramType && l == "le") {
+			panic(fmt.Sprintf("metrics: %s: invalid label name %q", name, l))
+		}
+		if slices.Contains(names[:i], l) {
+			panic(fmt.Sprintf("metrics: %s: duplicate label %q", name, l))
+		}
+	}
+
+	r.fams.mu.Lock()
+	defer r.fams.mu.Unlock()
+	f, ok := r.fams.byName[name]
+	if !ok {
+		f = &family{
+			name:    name,
+			help:    help,
+			typ:     typ,
+			labels:  names,
+			buckets: buckets,
+			mu:      &sync.RWMutex{},
+			series:  make(map[string]*series),
+		}
+		r.fams.byName[name] = f
+	} else if f.typ != typ || !slices.Equal(f.labels, names) || !slices.Equal(f.buckets, buckets) {
+		panic(fmt.Sprintf("metrics: %s already registered as %s%v", name, f.typ, f.labels))
+	}
+	return handle{fam: f}.with(r.values)
+}
+
+// families returns the families sorted by name.
+func (r *Registry) families() []*family {
+	r.fams.mu.RLock()
+	fs := make([]*family, 0, len(r.fams.byName))
+	for _, f := range r.fams.byName {
+		fs = append(fs, f)
+	}
+	r.fams.mu.RUnlock()
+	sort.Slice(fs, func(i, j int) bool { return fs[i].name < fs[j].name })
+	return fs
+}
+
+// family is a metric and its series by label values.
+type family struct {
+	name    string
+	help    string
+	typ     Type
+	labels  []string
+	buckets []float64
+
+	mu     *sync.RWMutex // guards series
+	series map[string]*series
+}
+
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{values: slices.Clone(values)}
+	if f.typ == HistogramType {
+		s.hmu = &sync.Mutex{}
+		s.counts = make([]uint64, len(f.buckets)+1)
+	}
+	f.series[key] = s
+	return s
+}
+
+// sorted returns the series sorted by label values.
+func (f *family) sorted() []*series {
+	f.mu.RLock()
+	ss := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		ss = append(ss, s)
+	}
+	f.mu.RUnlock()
+	sort.Slice(ss, func(i, j int) bool { return slices.Compare(ss[i].values, ss[j].values) < 0 })
+	return ss
+}
+
+func (f *family) deleteMatching(names, values []string) int {
+	idx := make([]int, len(names))
+	for i, n := range names {
+		if idx[i] = slices.Index(f.labels, n); idx[i] < 0 {
+			return 0
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for key, s := range f.series {
+		match := true
+		for i, j := range idx {
+			if s.values[j] != values[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			delete(f.series, key)
+			n++
+		}
+	}
+	return n
+}
+
+// series is a sample of a family: a value, or the buckets of a histogram.
+type series struct {
+	values []string
+	bits   atomic.Uint64 // the float64 value of a counter or gauge
+
+	hmu    *sync.Mutex // guards counts sum
+	counts []uint64    // 每个桶的计数 非累计 最后一个为+Inf
+	sum    float64
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(s.bits.Load())
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := s.bits.Load()
+		if s.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// snapshot returns the cumulative bucket counts, the sum and the count of a histogram.
+func (s *series) snapshot() (cum []uint64, sum float64, count uint64) {
+	s.hmu.Lock()
+	defer s.hmu.Unlock()
+	cum = make([]uint64, len(s.counts))
+	for i, c := range s.counts {
+		count += c
+		cum[i] = count
+	}
+	return cum, s.sum, count
+}
+
+// handle is a family with the label values given so far, bound to its series once complete.
+type handle struct {
+	fam    *family
+	values []string
+	s      *series
+}
+
+func (h handle) with(values []string) handle {
+	h.values = append(slices.Clip(h.values), values...)
+	if len(h.values) > len(h.fam.labels) {
+		panic(fmt.Sprintf("metrics: %s: %d label values for %v", h.fam.name, len(h.values), h.fam.labels))
+	}
+	if len(h.values) == len(h.fam.labels) {
+		h.s = h.fam.get(h.values)
+	}
+	return h
+}
+
+func (h handle) series() *series {
+	if h.s == nil {
+		panic(fmt.Sprintf("metrics: %s: %d label values for %v", h.fam.name, len(h.values), h.fam.labels))
+	}
+	return h.s
+}
+
+// Counter is a value that only goes up. With binds the values of its labels,
+// the other methods panic until they're all bound.
+type Counter struct {
+	h handle
+}
+
+// With returns the Counter with the next label values bound.
+func (c *Counter) With(values ...string) *Counter {
+	return &Counter{c.h.with(values)}
+}
+
+func (c *Counter) Inc() {
+	c.h.series().add(1)
+}
+
+// Add adds v, a negative v is ignored.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.h.series().add(v)
+}
+
+func (c *Counter) Value() float64 {
+	return c.h.series().load()
+}
+
+// Gauge is a value that goes up and down, see Counter for its labels.
+type Gauge struct {
+	h handle
+}
+
+// With returns the Gauge with the next label values bound.
+func (g *Gauge) With(values ...string) *Gauge {
+	return &Gauge{g.h.with(values)}
+}
+
+func (g *Gauge) Set(v float64) {
+	g.h.series().bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64) {
+	g.h.series().add(v)
+}
+
+func (g *Gauge) Sub(v float64) {
+	g.h.series().add(-v)
+}
+
+func (g *Gauge) Inc() {
+	g.h.series().add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.h.series().add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.h.series().load()
+}
+
+// Histogram counts the observations in buckets, see Counter for its labels.
+type Histogram struct {
+	h handle
+}
+
+// With returns the Histogram with the next label values bound.
+func (hg *Histogram) With(values ...string) *Histogram {
+	return &Histogram{hg.h.with(values)}
+}
+
+func (hg *Histogram) Observe(v float64) {
+	s := hg.h.series()
+	// 第一个上界不小于v的桶 没有则为+Inf桶
+	i := sort.SearchFloat64s(hg.h.fam.buckets, v)
+	s.hmu.Lock()
+	s.counts[i]++
+	s.sum += v
+	s.hmu.Unlock()
+}
+
+// ObserveDuration observes d in seconds.
+func (hg *Histogram) ObserveDuration(d time.Duration) {
+	hg.Observe(d.Seconds())
+}
+
+// Count returns the number of observations.
+func (hg *Histogram) Count() uint64 {
+	_, _, count := hg.h.series().snapshot()
+	return count
+}
+
+// Sum returns the sum of the observations.
+func (hg *Histogram) Sum() float64 {
+	_, sum, _ := hg.h.series().snapshot()
+	return sum
+}
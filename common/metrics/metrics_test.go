@@ -0,0 +1,142 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"common/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reqs := reg.Counter("http_requests_total", "Requests served.", "code")
+	reqs.With("200").Inc()
+	reqs.With("200").Add(2)
+	reqs.With("500").Add(-1) // ignored
+	assert.Equal(t, 3.0, reqs.With("200").Value())
+	assert.Equal(t, 0.0, reqs.With("500").Value())
+
+	// registered again with the same labels, the same family
+	assert.Equal(t, 3.0, reg.Counter("http_requests_total", "", "code").With("200").Value())
+	assert.Panics(t, func() { reg.Gauge("http_requests_total", "") })
+	assert.Panics(t, func() { reg.Counter("http_requests_total", "", "method") })
+	assert.Panics(t, func() { reqs.Inc() }, "label value missing")
+	assert.Panics(t, func() { reqs.With("200", "GET") })
+	assert.Panics(t, func() { reg.Counter("bad-name", "") })
+	assert.Panics(t, func() { reg.Histogram("h", "", nil, "le") })
+
+	g := reg.Gauge("queue_length", "")
+	g.Set(10)
+	g.Inc()
+	g.Sub(3)
+	assert.Equal(t, 8.0, g.Value())
+
+	h := reg.Histogram("latency_seconds", "", []float64{0.1, 1})
+	h.ObserveDuration(50 * time.Millisecond)
+	h.Observe(0.5)
+	h.Observe(3)
+	assert.Equal(t, uint64(3), h.Count())
+	assert.InDelta(t, 3.55, h.Sum(), 1e-9)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				reqs.With("200").Inc()
+				g.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 8003.0, reqs.With("200").Value())
+	assert.Equal(t, 8008.0, g.Value())
+}
+
+func TestComponentRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+	a := reg.Component("mqtt", "a")
+	b := reg.Component("mqtt", "b")
+	a.Counter("messages_total", "", "topic").With("up").Inc()
+	b.Counter("messages_total", "", "topic").With("up").Add(2)
+	a.Gauge("connected", "").Set(1)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# TYPE connected gauge
+connected{kind="mqtt",id="a"} 1
+# TYPE messages_total counter
+messages_total{kind="mqtt",id="a",topic="up"} 1
+messages_total{kind="mqtt",id="b",topic="up"} 2
+`, buf.String())
+
+	assert.Equal(t, 2, a.DeleteSeries())
+	assert.Equal(t, 0, reg.DeleteSeries())
+	buf.Reset()
+	require.NoError(t, reg.WriteText(&buf))
+	assert.NotContains(t, buf.String(), `id="a"`)
+	assert.Contains(t, buf.String(), `id="b"`)
+}
+
+func TestExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("jobs_total", "Jobs run,\nby \"result\".", "result").With(`ok"\`).Add(1.5)
+	h := reg.Histogram("job_seconds", "Job durations.", []float64{1, 0.5})
+	h.Observe(0.2)
+	h.Observe(0.7)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP job_seconds Job durations.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.5"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 5.9
+job_seconds_count 3
+# HELP jobs_total Jobs run,\nby "result".
+# TYPE jobs_total counter
+jobs_total{result="ok\"\\"} 1.5
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, reg.WriteOpenMetrics(&buf))
+	assert.Equal(t, `# HELP job_seconds Job durations.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.5"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 5.9
+job_seconds_count 3
+# HELP jobs Jobs run,\nby \"result\".
+# TYPE jobs counter
+jobs_total{result="ok\"\\"} 1.5
+# EOF
+`, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Gauge("up", "").Set(1)
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, metrics.TextContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE up gauge\nup 1\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	reg.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, metrics.OpenMetricsContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE up gauge\nup 1\n# EOF\n", rec.Body.String())
+}
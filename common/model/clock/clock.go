@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"time"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ Clock = (*realClock)(nil)
+	_ Clock = (*Fake)(nil)
+)
+
+// Clock abstracts the time source so that timeout logic
+// can be driven by a fake clock in tests.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) *Timer
+	NewTicker(d time.Duration) *Ticker
+}
+
+// Timer mirrors time.Timer, C is the channel on which the time is delivered.
+type Timer struct {
+	C <-chan time.Time
+
+	rt *time.Timer
+	fw *fakeWaiter
+}
+
+// Stop prevents the Timer from firing.
+// It returns false if the timer has already expired or been stopped.
+func (t *Timer) Stop() bool {
+	if t.rt != nil {
+		return t.rt.Stop()
+	}
+	return t.fw.stop()
+}
+
+// Reset changes the timer to expire after duration d.
+// It returns true if the timer had been active.
+func (t *Timer) Reset(d time.Duration) bool {
+	if t.rt != nil {
+		return t.rt.Reset(d)
+	}
+	return t.fw.reset(d, 0)
+}
+
+// Ticker mirrors time.Ticker, C is the channel on which the ticks are delivered.
+type Ticker struct {
+	C <-chan time.Time
+
+	rt *time.Ticker
+	fw *fakeWaiter
+}
+
+// Stop turns off the ticker.
+func (t *Ticker) Stop() {
+	if t.rt != nil {
+		t.rt.Stop()
+		return
+	}
+	t.fw.stop()
+}
+
+// Reset stops the ticker and resets its period to d.
+func (t *Ticker) Reset(d time.Duration) {
+	if t.rt != nil {
+		t.rt.Reset(d)
+		return
+	}
+	t.fw.reset(d, d)
+}
+
+// *************************** real clock ***************************
+
+var realClk Clock = &realClock{}
+
+// Real returns the Clock backed by package time.
+func Real() Clock {
+	return realClk
+}
+
+// OrReal returns clk if it's not nil, otherwise the real Clock.
+func OrReal(clk Clock) Clock {
+	if clk == nil {
+		return realClk
+	}
+	return clk
+}
+
+type realClock struct{}
+
+func (*realClock) Now() time.Time                         { return time.Now() }
+func (*realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (*realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (*realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (*realClock) NewTimer(d time.Duration) *Timer {
+	t := time.NewTimer(d)
+	return &Timer{C: t.C, rt: t}
+}
+
+func (*realClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, rt: t}
+}
@@ -0,0 +1,112 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"common/model/clock"
+)
+
+func TestRealClock(t *testing.T) {
+	clk := clock.Real()
+	tm := clk.NewTimer(time.Millisecond)
+	select {
+	case <-tm.C:
+	case <-time.After(time.Second):
+		t.Fatal("real timer didn't expire in time")
+	}
+
+	if clock.OrReal(nil) != clk {
+		t.Fatal("OrReal(nil) should return the real clock")
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := clock.NewFake(start)
+	tm := fc.NewTimer(time.Second)
+
+	fc.Advance(999 * time.Millisecond)
+	select {
+	case <-tm.C:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	fc.Advance(time.Millisecond)
+	select {
+	case v := <-tm.C:
+		if !v.Equal(start.Add(time.Second)) {
+			t.Fatalf("unexpected fire time: %v", v)
+		}
+	default:
+		t.Fatal("timer didn't fire")
+	}
+
+	if tm.Stop() {
+		t.Fatal("Stop of an expired timer should return false")
+	}
+	if tm.Reset(time.Second) {
+		t.Fatal("Reset of an expired timer should return false")
+	}
+	if !tm.Stop() {
+		t.Fatal("Stop of an active timer should return true")
+	}
+	fc.Advance(time.Hour)
+	select {
+	case <-tm.C:
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if fc.Waiters() != 0 {
+		t.Fatalf("expected no waiters, got %d", fc.Waiters())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	tk := fc.NewTicker(10 * time.Millisecond)
+	defer tk.Stop()
+
+	count := 0
+	for i := 0; i < 5; i++ {
+		fc.Advance(10 * time.Millisecond)
+		select {
+		case <-tk.C:
+			count++
+		default:
+		}
+	}
+	if count != 5 {
+		t.Fatalf("expected 5 ticks, got %d", count)
+	}
+
+	// slow receiver drops ticks like time.Ticker
+	fc.Advance(100 * time.Millisecond)
+	if len(tk.C) != 1 {
+		t.Fatalf("expected one buffered tick, got %d", len(tk.C))
+	}
+}
+
+func TestFakeSleepBlockUntil(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		fc.Sleep(time.Minute)
+		close(done)
+	}()
+
+	fc.BlockUntil(1)
+	fc.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep didn't return after Advance")
+	}
+
+	before := fc.Now()
+	fc.Set(before.Add(-time.Hour))
+	if fc.Since(before) != -time.Hour {
+		t.Fatalf("Set backwards failed: %v", fc.Since(before))
+	}
+}
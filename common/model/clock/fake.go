@@ -0,0 +1,218 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a manual-advance Clock for deterministic tests.
+// Timers and tickers only fire when Advance or Set moves the time past their deadline.
+type Fake struct {
+	mu      *sync.Mutex
+	cond    *sync.Cond // signaled when waiters are added
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	f      *Fake
+	ch     chan time.Time
+	until  time.Time
+	period time.Duration // > 0 for tickers
+	active bool
+}
+
+// NewFake returns a Fake clock starting at the given time.
+// The zero time is replaced with a fixed non-zero instant.
+func NewFake(start time.Time) *Fake {
+	if start.IsZero() {
+		start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	mu := &sync.Mutex{}
+	return &Fake{
+		mu:   mu,
+		cond: sync.NewCond(mu),
+		now:  start,
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until the fake time is advanced by d.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.NewTimer(d).C
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C
+}
+
+func (f *Fake) NewTimer(d time.Duration) *Timer {
+	w := f.addWaiter(d, 0)
+	return &Timer{C: w.ch, fw: w}
+}
+
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := f.addWaiter(d, d)
+	return &Ticker{C: w.ch, fw: w}
+}
+
+// Advance moves the fake time forward by d, firing every timer and ticker
+// whose deadline is reached in chronological order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Set moves the fake time to t. Moving backwards never fires anything.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		f.now = t
+		return
+	}
+	f.advanceTo(t)
+}
+
+// Waiters returns the number of active timers and tickers.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.activeLen()
+}
+
+// BlockUntil blocks until at least n timers or tickers are active,
+// used to make sure a goroutine under test is waiting before Advance.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.activeLen() < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) addWaiter(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{
+		f:      f,
+		ch:     make(chan time.Time, 1),
+		until:  f.now.Add(d),
+		period: period,
+		active: true,
+	}
+	f.waiters = append(f.waiters, w)
+	// a timer with a non-positive duration fires immediately
+	if d <= 0 && period == 0 {
+		f.fire(w)
+	}
+	f.cond.Broadcast()
+	return w
+}
+
+// must hold f.mu
+func (f *Fake) advanceTo(t time.Time) {
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].until.Before(f.waiters[j].until)
+		})
+
+		var next *fakeWaiter
+		for _, w := range f.waiters {
+			if w.active && !w.until.After(t) {
+				next = w
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.until.After(f.now) {
+			f.now = next.until
+		}
+		f.fire(next)
+	}
+	f.now = t
+	f.compact()
+}
+
+// must hold f.mu
+func (f *Fake) fire(w *fakeWaiter) {
+	// drop the tick like time.Ticker when the receiver is slow
+	select {
+	case w.ch <- f.now:
+	default:
+	}
+	if w.period > 0 {
+		w.until = w.until.Add(w.period)
+	} else {
+		w.active = false
+	}
+}
+
+// must hold f.mu
+func (f *Fake) compact() {
+	ws := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.active {
+			ws = append(ws, w)
+		}
+	}
+	for i := len(ws); i < len(f.waiters); i++ {
+		f.waiters[i] = nil
+	}
+	f.waiters = ws
+}
+
+// must hold f.mu
+func (f *Fake) activeLen() int {
+	n := 0
+	for _, w := range f.waiters {
+		if w.active {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *fakeWaiter) stop() bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	wasActive := w.active
+	w.active = false
+	w.f.compact()
+	return wasActive
+}
+
+func (w *fakeWaiter) reset(d, period time.Duration) bool {
+	f := w.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	wasActive := w.active
+	w.until = f.now.Add(d)
+	w.period = period
+	w.active = true
+	if !wasActive {
+		f.waiters = append(f.waiters, w)
+	}
+	if d <= 0 && period == 0 {
+		f.fire(w)
+		f.compact()
+	}
+	f.cond.Broadcast()
+	return wasActive
+}
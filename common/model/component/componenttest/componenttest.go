@@ -0,0 +1,219 @@
+// Package componenttest provides utilities for testing components: a Harness driving the lifecycle
+// of a component and asserting its states, which verifies that the goroutines it started are gone
+// once stopped and finalized, and a FakeContext controlling the context of its CtrlSt.
+package componenttest
+
+import (
+	"slices"
+	"time"
+
+	cmpt "common/model/component"
+
+	"go.uber.org/goleak"
+)
+
+const (
+	// the time a transition has to complete before the Harness reports it hung
+	defaultTimeout = 5 * time.Second
+	// the interval the states are polled at
+	pollInterval = 5 * time.Millisecond
+)
+
+// TB is the part of testing.TB the Harness reports to.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Harness drives the lifecycle of a component in a test. Its methods report the failures to the TB
+// and return whether they passed, the test goes on after a failure.
+//
+//	h := componenttest.New(t, sensor.New())
+//	h.Start()
+//	h.AssertWorkers(1)
+//	h.Shutdown() // Stop, Finalize and no goroutine leaked
+type Harness struct {
+	t       TB
+	cp      cmpt.Cpt
+	timeout time.Duration
+	opts    []goleak.Option
+}
+
+// New returns the Harness of cp. The goroutines running at this time are not reported as leaks,
+// nor those matched by opts, e.g. goleak.IgnoreTopFunction for a pool shared by the process.
+func New(t TB, cp cmpt.Cpt, opts ...goleak.Option) *Harness {
+	t.Helper()
+	return &Harness{
+		t:       t,
+		cp:      cp,
+		timeout: defaultTimeout,
+		opts:    append(slices.Clone(opts), goleak.IgnoreCurrent()),
+	}
+}
+
+// WithTimeout sets the time Finalize and the state assertions wait for, 5s by default.
+func (h *Harness) WithTimeout(d time.Duration) *Harness {
+	if d > 0 {
+		h.timeout = d
+	}
+	return h
+}
+
+// Cpt returns the component driven.
+func (h *Harness) Cpt() cmpt.Cpt {
+	return h.cp
+}
+
+// Start starts the component and asserts it's running.
+func (h *Harness) Start() bool {
+	h.t.Helper()
+	if err := h.cp.Start(); err != nil {
+		h.t.Errorf("component %s: Start: %v", h.cp.CmptInfo(), err)
+		return false
+	}
+	return h.AssertRunning()
+}
+
+// StartFails asserts that starting the component fails and returns the error.
+func (h *Harness) StartFails() error {
+	h.t.Helper()
+	err := h.cp.Start()
+	if err == nil {
+		h.t.Errorf("component %s: Start succeeded, want an error", h.cp.CmptInfo())
+	}
+	return err
+}
+
+// Stop stops the component and asserts it's stopped.
+func (h *Harness) Stop() bool {
+	h.t.Helper()
+	if err := h.cp.Stop(); err != nil {
+		h.t.Errorf("component %s: Stop: %v", h.cp.CmptInfo(), err)
+		return false
+	}
+	return h.AssertStopped()
+}
+
+// Restart restarts the component, see cmpt.Restart, and asserts it's running.
+func (h *Harness) Restart() bool {
+	h.t.Helper()
+	if err := cmpt.Restart(h.cp); err != nil {
+		h.t.Errorf("component %s: Restart: %v", h.cp.CmptInfo(), err)
+		return false
+	}
+	return h.AssertRunning()
+}
+
+// Finalize waits for the workers of the component to exit, through Finalize for a CptRoot.
+// It reports a Finalize returning an error or not returning within the timeout.
+func (h *Harness) Finalize() bool {
+	h.t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		if cr, ok := h.cp.(cmpt.CptRoot); ok {
+			done <- cr.Finalize()
+			return
+		}
+		h.cp.Ctrl().WaitGroup().WaitAsync()
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			h.t.Errorf("component %s: Finalize: %v", h.cp.CmptInfo(), err)
+			return false
+		}
+		return true
+	case <-time.After(h.timeout):
+		h.t.Errorf("component %s: Finalize hung for %v, %d workers active",
+			h.cp.CmptInfo(), h.timeout, h.cp.Ctrl().WaitGroup().Active())
+		return false
+	}
+}
+
+// Shutdown stops the component if running, finalizes it and verifies that no goroutine leaked.
+func (h *Harness) Shutdown() bool {
+	h.t.Helper()
+	ok := true
+	if h.cp.IsRunning() {
+		ok = h.Stop()
+	}
+	// 有协程卡住时不再检查泄漏 避免重复报告
+	return ok && h.Finalize() && h.VerifyNoLeaks()
+}
+
+// VerifyNoLeaks asserts that the goroutines started since New are gone, retrying for a while
+// as the workers exit asynchronously.
+func (h *Harness) VerifyNoLeaks() bool {
+	h.t.Helper()
+	if err := goleak.Find(h.opts...); err != nil {
+		h.t.Errorf("component %s: %v", h.cp.CmptInfo(), err)
+		return false
+	}
+	return true
+}
+
+// AssertRunning asserts the component is running.
+func (h *Harness) AssertRunning() bool {
+	h.t.Helper()
+	if !h.cp.IsRunning() {
+		h.t.Errorf("component %s: stopped, want running", h.cp.CmptInfo())
+		return false
+	}
+	return true
+}
+
+// AssertStopped asserts the component is stopped.
+func (h *Harness) AssertStopped() bool {
+	h.t.Helper()
+	if h.cp.IsRunning() {
+		h.t.Errorf("component %s: running, want stopped", h.cp.CmptInfo())
+		return false
+	}
+	return true
+}
+
+// AssertWorkers asserts that n workers of the component are active within the timeout.
+func (h *Harness) AssertWorkers(n int) bool {
+	h.t.Helper()
+	wg := h.cp.Ctrl().WaitGroup()
+	if !poll(h.timeout, func() bool { return wg.Active() == n }) {
+		h.t.Errorf("component %s: %d workers active, want %d", h.cp.CmptInfo(), wg.Active(), n)
+		return false
+	}
+	return true
+}
+
+// AssertDone asserts that the context of the component is done within the timeout.
+func (h *Harness) AssertDone() bool {
+	h.t.Helper()
+	select {
+	case <-h.cp.Ctrl().Context().Done():
+		return true
+	case <-time.After(h.timeout):
+		h.t.Errorf("component %s: context not done", h.cp.CmptInfo())
+		return false
+	}
+}
+
+// VerifyLifecycle starts cp, stops and finalizes it, and verifies that no goroutine leaked.
+func VerifyLifecycle(t TB, cp cmpt.Cpt, opts ...goleak.Option) bool {
+	t.Helper()
+	h := New(t, cp, opts...)
+	if !h.Start() {
+		return false
+	}
+	return h.Shutdown()
+}
+
+func poll(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(pollInterval)
+	}
+	return true
+}
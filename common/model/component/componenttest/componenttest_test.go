@@ -0,0 +1,154 @@
+package componenttest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mdl "common/model"
+	cmpt "common/model/component"
+	"common/model/component/componenttest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// recorder is a TB recording the failures reported, for the tests expecting them.
+type recorder struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.errs, "\n")
+}
+
+// leaky is a component whose worker starts a goroutine outliving it, or ignoring the cancellation when hung.
+type leaky struct {
+	*cmpt.CptMetaSt
+	hung    bool
+	release chan struct{}
+}
+
+func newLeaky(hung bool) *leaky {
+	l := &leaky{hung: hung, release: make(chan struct{})}
+	l.CptMetaSt = cmpt.NewCptMetaSt(cmpt.KindName("leaky"), cmpt.IdName("l1"), mdl.WorkerRecover(l))
+	return l
+}
+
+func (l *leaky) Work() error {
+	if l.hung {
+		<-l.release
+		return nil
+	}
+	go func() { <-l.release }()
+	<-l.Ctrl().Context().Done()
+	return nil
+}
+
+func TestHarness(t *testing.T) {
+	h := componenttest.New(t, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1")))
+	require.True(t, h.Start())
+	assert.True(t, h.AssertWorkers(1))
+	assert.Error(t, h.StartFails())
+	assert.True(t, h.Restart())
+	assert.True(t, h.AssertWorkers(1))
+	assert.True(t, h.Shutdown())
+	assert.True(t, h.AssertWorkers(0))
+
+	assert.True(t, componenttest.VerifyLifecycle(t, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t2"))))
+
+	// the options of the caller are not appended to in place
+	opts := make([]goleak.Option, 1, 2)
+	opts[0] = goleak.IgnoreTopFunction("main.pool")
+	componenttest.New(t, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t3")), opts...)
+	assert.Nil(t, opts[:2][1])
+}
+
+func TestHarnessFailures(t *testing.T) {
+	// a goroutine outliving the component
+	r := &recorder{}
+	l := newLeaky(false)
+	assert.False(t, componenttest.VerifyLifecycle(r, l))
+	assert.Contains(t, r.String(), "found unexpected goroutines")
+	assert.Contains(t, r.String(), "componenttest_test.(*leaky).Work.func1")
+	close(l.release)
+
+	// a worker not exiting
+	r = &recorder{}
+	l = newLeaky(true)
+	h := componenttest.New(r, l).WithTimeout(50 * time.Millisecond)
+	require.True(t, h.Start())
+	assert.False(t, h.Shutdown())
+	assert.Contains(t, r.String(), "Finalize hung for 50ms, 1 workers active")
+	close(l.release)
+	assert.True(t, componenttest.New(t, l).Finalize())
+
+	r = &recorder{}
+	h = componenttest.New(r, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"))).WithTimeout(20 * time.Millisecond)
+	assert.False(t, h.AssertRunning())
+	assert.False(t, h.Stop())
+	assert.False(t, h.AssertWorkers(1))
+	assert.False(t, h.AssertDone())
+	assert.Len(t, r.errs, 4)
+}
+
+func TestFakeCtrl(t *testing.T) {
+	type key struct{}
+	ctrl, fc := componenttest.NewFakeCtrl()
+	dl := time.Now().Add(time.Hour)
+	fc.WithValue(key{}, "v").WithDeadline(dl)
+	h := componenttest.New(t, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), ctrl))
+	require.True(t, h.Start())
+	assert.Equal(t, "v", ctrl.Context().Value(key{}))
+	got, ok := ctrl.Context().Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, dl, got)
+
+	// the parent timing out ends the work, the component is stopped as usual
+	fc.Expire()
+	assert.True(t, h.AssertDone())
+	assert.True(t, h.AssertWorkers(0))
+	assert.ErrorIs(t, ctrl.Context().Err(), context.DeadlineExceeded)
+	assert.True(t, h.Shutdown())
+
+	// an error of the parent fails Finalize
+	r := &recorder{}
+	ctrl, fc = componenttest.NewFakeCtrl()
+	h = componenttest.New(r, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t2"), ctrl))
+	require.True(t, h.Start())
+	fc.Fail(errors.New("link lost"))
+	fc.Cancel() // no effect once done
+	assert.False(t, h.Shutdown())
+	assert.Contains(t, r.String(), "Finalize: link lost")
+
+	// the contexts derived after the cancellation are done too
+	fc = componenttest.NewFakeContext()
+	fc.Cancel()
+	ctx, cancel := context.WithCancel(fc)
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	// a context derived and cancelled before is released
+	fc = componenttest.NewFakeContext()
+	ctx, cancel = context.WithCancel(fc)
+	cancel()
+	fc.Cancel()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,139 @@
+package componenttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mdl "common/model"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ context.Context = (*FakeContext)(nil)
+)
+
+// FakeContext is a context.Context cancelled by the test, with the error it chooses, e.g. to drive
+// a component as if its parent was cancelled or timed out. The contexts derived from it follow it
+// without a goroutine of their own, which would be reported as a leak.
+type FakeContext struct {
+	mu       *sync.Mutex // guards err deadline values afters
+	done     chan struct{}
+	err      error
+	deadline time.Time
+	values   map[any]any
+	afters   map[*func()]struct{}
+}
+
+// NewFakeContext returns a FakeContext without deadline nor values.
+func NewFakeContext() *FakeContext {
+	return &FakeContext{
+		mu:     &sync.Mutex{},
+		done:   make(chan struct{}),
+		values: make(map[any]any),
+		afters: make(map[*func()]struct{}),
+	}
+}
+
+// NewFakeCtrl returns a CtrlSt on a new FakeContext and the FakeContext.
+func NewFakeCtrl() (*mdl.CtrlSt, *FakeContext) {
+	fc := NewFakeContext()
+	return mdl.NewCtrlSt(fc), fc
+}
+
+// WithDeadline makes Deadline return d, it doesn't expire the context, Expire does.
+func (fc *FakeContext) WithDeadline(d time.Time) *FakeContext {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.deadline = d
+	return fc
+}
+
+// WithValue makes Value return v for key.
+func (fc *FakeContext) WithValue(key, v any) *FakeContext {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.values[key] = v
+	return fc
+}
+
+func (fc *FakeContext) Deadline() (time.Time, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.deadline, !fc.deadline.IsZero()
+}
+
+func (fc *FakeContext) Done() <-chan struct{} {
+	return fc.done
+}
+
+func (fc *FakeContext) Err() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.err
+}
+
+func (fc *FakeContext) Value(key any) any {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.values[key]
+}
+
+// Cancel cancels the context with context.Canceled.
+func (fc *FakeContext) Cancel() {
+	fc.cancel(context.Canceled)
+}
+
+// Expire cancels the context as its deadline was exceeded.
+func (fc *FakeContext) Expire() {
+	fc.cancel(context.DeadlineExceeded)
+}
+
+// Fail cancels the context with err, as a context other than the ones of the context package may,
+// e.g. to make Finalize return err. A nil err is context.Canceled.
+func (fc *FakeContext) Fail(err error) {
+	if err == nil {
+		err = context.Canceled
+	}
+	fc.cancel(err)
+}
+
+func (fc *FakeContext) cancel(err error) {
+	fc.mu.Lock()
+	if fc.err != nil {
+		fc.mu.Unlock()
+		return
+	}
+	fc.err = err
+	afters := fc.afters
+	fc.afters = nil
+	close(fc.done)
+	fc.mu.Unlock()
+
+	for f := range afters {
+		(*f)()
+	}
+}
+
+// AfterFunc calls f once the context is cancelled, the context package uses it to cancel the
+// contexts derived instead of starting a goroutine waiting for Done.
+func (fc *FakeContext) AfterFunc(f func()) (stop func() bool) {
+	fc.mu.Lock()
+	if fc.err != nil {
+		fc.mu.Unlock()
+		go f()
+		return func() bool { return false }
+	}
+	key := &f
+	fc.afters[key] = struct{}{}
+	fc.mu.Unlock()
+	return func() bool {
+		fc.mu.Lock()
+		defer fc.mu.Unlock()
+		if _, ok := fc.afters[key]; !ok {
+			return false
+		}
+		delete(fc.afters, key)
+		return true
+	}
+}
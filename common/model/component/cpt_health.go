@@ -0,0 +1,204 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// Health is the health of a component, or of the process.
+type Health string
+
+const (
+	HealthUp Health = "up"
+	// HealthDegraded works with reduced capacity, e.g. a backlog, it's still live and ready
+	HealthDegraded Health = "degraded"
+	HealthDown     Health = "down"
+)
+
+// HealthStatus is the result of a health check.
+type HealthStatus struct {
+	Status  Health         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// HealthChecker is implemented by the components checking their own health,
+// e.g. the connection to a broker. Check returns before ctx is done.
+// The components without it are up while running.
+type HealthChecker interface {
+	Check(ctx context.Context) HealthStatus
+}
+
+// CptHealth is the health of a component in a HealthReport.
+type CptHealth struct {
+	Kind     KindName      `json:"kind"`
+	Id       IdName        `json:"id"`
+	Critical bool          `json:"critical"`
+	Running  bool          `json:"running"`
+	Duration time.Duration `json:"duration"` // 检查耗时
+	HealthStatus
+}
+
+// HealthReport is the health of the components watched by a HealthAggregator,
+// OK is whether the probe passes.
+type HealthReport struct {
+	Status     Health      `json:"status"`
+	OK         bool        `json:"ok"`
+	Components []CptHealth `json:"components"`
+}
+
+type healthEntry struct {
+	cp       Cpt
+	critical bool
+}
+
+// HealthAggregator checks the health of components for the liveness and readiness probes.
+// Only the critical components fail the probes, the optional ones are reported.
+type HealthAggregator struct {
+	mu      *sync.Mutex // guards entries timeout
+	entries []healthEntry
+	timeout time.Duration
+}
+
+// NewHealthAggregator returns an aggregator without components.
+func NewHealthAggregator() *HealthAggregator {
+	return &HealthAggregator{mu: &sync.Mutex{}, timeout: defaultCheckTimeout}
+}
+
+// WithTimeout bounds each check to d, 2s by default.
+func (ha *HealthAggregator) WithTimeout(d time.Duration) *HealthAggregator {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	if d > 0 {
+		ha.timeout = d
+	}
+	return ha
+}
+
+// AddCritical watches cps, the probes fail when one of them fails.
+func (ha *HealthAggregator) AddCritical(cps ...Cpt) {
+	ha.add(true, cps)
+}
+
+// AddOptional watches cps, their health is reported but never fails the probes.
+func (ha *HealthAggregator) AddOptional(cps ...Cpt) {
+	ha.add(false, cps)
+}
+
+func (ha *HealthAggregator) add(critical bool, cps []Cpt) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	for _, cp := range cps {
+		if cp != nil {
+			ha.entries = append(ha.entries, healthEntry{cp: cp, critical: critical})
+		}
+	}
+}
+
+// Remove stops watching cps.
+func (ha *HealthAggregator) Remove(cps ...Cpt) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	for _, cp := range cps {
+		for i := 0; i < len(ha.entries); i++ {
+			if ha.entries[i].cp == cp {
+				ha.entries = append(ha.entries[:i], ha.entries[i+1:]...)
+				i--
+			}
+		}
+	}
+}
+
+// Liveness checks the components, it fails when a critical one running is down.
+// The components not running are starting or stopping, they don't fail it.
+func (ha *HealthAggregator) Liveness(ctx context.Context) HealthReport {
+	return ha.report(ctx, func(ch CptHealth) bool {
+		return !ch.Running || ch.Status != HealthDown
+	})
+}
+
+// Readiness checks the components, it fails when a critical one is not running or down.
+func (ha *HealthAggregator) Readiness(ctx context.Context) HealthReport {
+	return ha.report(ctx, func(ch CptHealth) bool {
+		return ch.Running && ch.Status != HealthDown
+	})
+}
+
+// report checks the components concurrently, a critical one failing pass fails the report.
+func (ha *HealthAggregator) report(ctx context.Context, pass func(CptHealth) bool) HealthReport {
+	ha.mu.Lock()
+	entries := append([]healthEntry(nil), ha.entries...)
+	timeout := ha.timeout
+	ha.mu.Unlock()
+
+	rp := HealthReport{Status: HealthUp, OK: true, Components: make([]CptHealth, len(entries))}
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rp.Components[i] = check(ctx, e, timeout)
+		}()
+	}
+	wg.Wait()
+
+	for _, ch := range rp.Components {
+		if !ch.Critical {
+			continue
+		}
+		if !pass(ch) {
+			rp.OK = false
+			rp.Status = HealthDown
+		} else if ch.Status == HealthDegraded && rp.Status == HealthUp {
+			rp.Status = HealthDegraded
+		}
+	}
+	return rp
+}
+
+// check runs the HealthChecker of the component, bounded by timeout.
+func check(ctx context.Context, e healthEntry, timeout time.Duration) (ch CptHealth) {
+	ch = CptHealth{
+		Kind:     e.cp.Kind(),
+		Id:       e.cp.Id(),
+		Critical: e.critical,
+		Running:  e.cp.IsRunning(),
+	}
+	hc, ok := e.cp.(HealthChecker)
+	if !ok {
+		ch.Status = HealthUp
+		if !ch.Running {
+			ch.Status = HealthDown
+		}
+		return ch
+	}
+
+	begin := time.Now()
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan HealthStatus, 1)
+	go func() {
+		defer func() {
+			if rc := recover(); rc != nil {
+				done <- HealthStatus{Status: HealthDown, Error: fmt.Sprintf("check panic: %v", rc)}
+			}
+		}()
+		done <- hc.Check(cctx)
+	}()
+	select {
+	case ch.HealthStatus = <-done:
+		if len(ch.Status) == 0 {
+			ch.Status = HealthUp
+		}
+	case <-cctx.Done():
+		ch.HealthStatus = HealthStatus{Status: HealthDown, Error: fmt.Sprintf("check: %v", cctx.Err())}
+	}
+	ch.Duration = time.Since(begin)
+	return ch
+}
@@ -0,0 +1,97 @@
+package component_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cmpt "common/model/component"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// broker is a component checking a connection.
+type broker struct {
+	*cmpt.CptMetaSt
+	mu     sync.Mutex // guards status hang
+	status cmpt.HealthStatus
+	hang   bool
+}
+
+func newBroker(id string, status cmpt.Health) *broker {
+	b := &broker{status: cmpt.HealthStatus{Status: status, Details: map[string]any{"backlog": 3}}}
+	b.CptMetaSt = cmpt.NewCptMetaSt(cmpt.KindName("broker"), cmpt.IdName(id), b)
+	return b
+}
+
+func (b *broker) set(status cmpt.HealthStatus, hang bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status, b.hang = status, hang
+}
+
+func (b *broker) Check(ctx context.Context) cmpt.HealthStatus {
+	b.mu.Lock()
+	status, hang := b.status, b.hang
+	b.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+	}
+	return status
+}
+
+func TestHealthAggregator(t *testing.T) {
+	mqtt := newBroker("mqtt", cmpt.HealthUp)
+	cache := newBroker("cache", cmpt.HealthDown)
+	plain := cmpt.NewCptMetaSt(cmpt.KindName("poller"), cmpt.IdName("p1"))
+	ha := cmpt.NewHealthAggregator().WithTimeout(50 * time.Millisecond)
+	ha.AddCritical(mqtt, plain)
+	ha.AddOptional(cache)
+	ctx := context.Background()
+
+	// nothing running yet: live but not ready
+	rp := ha.Liveness(ctx)
+	assert.True(t, rp.OK)
+	rp = ha.Readiness(ctx)
+	assert.False(t, rp.OK)
+	assert.Equal(t, cmpt.HealthDown, rp.Status)
+
+	for _, cp := range []cmpt.Cpt{mqtt, cache, plain} {
+		require.NoError(t, cp.Start())
+	}
+	// the optional cache down doesn't fail the probes
+	rp = ha.Readiness(ctx)
+	assert.True(t, rp.OK)
+	assert.Equal(t, cmpt.HealthUp, rp.Status)
+	require.Len(t, rp.Components, 3)
+	assert.Equal(t, cmpt.CptHealth{Kind: "broker", Id: "cache", Critical: false, Running: true,
+		Duration: rp.Components[2].Duration, HealthStatus: cache.status}, rp.Components[2])
+	assert.Equal(t, cmpt.HealthUp, rp.Components[1].Status)
+
+	mqtt.set(cmpt.HealthStatus{Status: cmpt.HealthDegraded}, false)
+	rp = ha.Readiness(ctx)
+	assert.True(t, rp.OK)
+	assert.Equal(t, cmpt.HealthDegraded, rp.Status)
+
+	// a check not returning in time is down
+	mqtt.set(cmpt.HealthStatus{Status: cmpt.HealthUp}, true)
+	rp = ha.Liveness(ctx)
+	assert.False(t, rp.OK)
+	assert.Contains(t, rp.Components[0].Error, "deadline exceeded")
+	mqtt.set(cmpt.HealthStatus{Status: cmpt.HealthUp}, false)
+
+	ha.Remove(mqtt)
+	require.NoError(t, plain.Stop())
+	rp = ha.Liveness(ctx)
+	assert.True(t, rp.OK)
+	assert.Len(t, rp.Components, 2)
+	assert.False(t, ha.Readiness(ctx).OK)
+
+	for _, cp := range []cmpt.CptRoot{mqtt, cache} {
+		require.NoError(t, cp.Stop())
+		require.NoError(t, cp.Finalize())
+	}
+	require.NoError(t, plain.Finalize())
+}
@@ -0,0 +1,194 @@
+package component
+
+import (
+	"sync"
+	"time"
+
+	"common/metrics"
+	mdl "common/model"
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ MetricsSink        = (*RegistrySink)(nil)
+	_ MetricsSink        = NopSink{}
+	_ mdl.WorkerObserver = (*CptMetaSt)(nil)
+	_ mdl.WorkerObserver = (*observedWorker)(nil)
+)
+
+var (
+	dsmu        = &sync.RWMutex{} // guards defaultSink
+	defaultSink MetricsSink
+)
+
+// MetricsSink receives the lifecycle events of the components, labelled by their kind and id.
+type MetricsSink interface {
+	// Started is called after Start, err is the one returned by it
+	Started(kind KindName, id IdName, d time.Duration, err error)
+	// Stopped is called after Stop, err is the one returned by it
+	Stopped(kind KindName, id IdName, d time.Duration, err error)
+	Restarted(kind KindName, id IdName)
+	// Recovered is called when Recover recovers a panic of a worker
+	Recovered(kind KindName, id IdName)
+	// StateTime is called when the component leaves the state running or stopped after d in it
+	StateTime(kind KindName, id IdName, running bool, d time.Duration)
+	// Workers is called with +1 when a worker of the component starts working and -1 when it exits
+	Workers(kind KindName, id IdName, delta int)
+}
+
+// CptMetrics is implemented by the components reporting their lifecycle to a MetricsSink.
+type CptMetrics interface {
+	MetricsSink() MetricsSink
+	SetMetricsSink(MetricsSink)
+}
+
+// DefaultMetricsSink returns the sink of the components without one of their own,
+// a RegistrySink on metrics.Default unless replaced by SetDefaultMetricsSink.
+func DefaultMetricsSink() MetricsSink {
+	dsmu.RLock()
+	s := defaultSink
+	dsmu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	dsmu.Lock()
+	defer dsmu.Unlock()
+	if defaultSink == nil {
+		defaultSink = NewRegistrySink(metrics.Default)
+	}
+	return defaultSink
+}
+
+// SetDefaultMetricsSink replaces the default sink, NopSink{} disables the lifecycle metrics.
+func SetDefaultMetricsSink(s MetricsSink) {
+	dsmu.Lock()
+	defer dsmu.Unlock()
+	defaultSink = s
+}
+
+// NopSink discards the lifecycle events.
+type NopSink struct{}
+
+func (NopSink) Started(KindName, IdName, time.Duration, error)  {}
+func (NopSink) Stopped(KindName, IdName, time.Duration, error)  {}
+func (NopSink) Restarted(KindName, IdName)                      {}
+func (NopSink) Recovered(KindName, IdName)                      {}
+func (NopSink) StateTime(KindName, IdName, bool, time.Duration) {}
+func (NopSink) Workers(KindName, IdName, int)                   {}
+
+// RegistrySink records the lifecycle events as metrics of a Registry.
+type RegistrySink struct {
+	starts    *metrics.Counter
+	startTime *metrics.Histogram
+	stops     *metrics.Counter
+	stopTime  *metrics.Histogram
+	restarts  *metrics.Counter
+	recovered *metrics.Counter
+	stateTime *metrics.Counter
+	workers   *metrics.Gauge
+}
+
+// NewRegistrySink registers the lifecycle metrics in reg.
+func NewRegistrySink(reg *metrics.Registry) *RegistrySink {
+	return &RegistrySink{
+		starts:    reg.Counter("cpt_starts_total", "Component starts, by result.", "kind", "id", "result"),
+		startTime: reg.Histogram("cpt_start_duration_seconds", "Time spent in component Start.", nil, "kind", "id"),
+		stops:     reg.Counter("cpt_stops_total", "Component stops, by result.", "kind", "id", "result"),
+		stopTime:  reg.Histogram("cpt_stop_duration_seconds", "Time spent in component Stop.", nil, "kind", "id"),
+		restarts:  reg.Counter("cpt_restarts_total", "Component restarts.", "kind", "id"),
+		recovered: reg.Counter("cpt_recovered_panics_total", "Panics of component workers recovered.", "kind", "id"),
+		stateTime: reg.Counter("cpt_state_seconds_total", "Time spent by the component in a lifecycle state.", "kind", "id", "state"),
+		workers:   reg.Gauge("cpt_active_workers", "Worker goroutines of the component working.", "kind", "id"),
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func (rs *RegistrySink) Started(kind KindName, id IdName, d time.Duration, err error) {
+	rs.starts.With(string(kind), string(id), result(err)).Inc()
+	rs.startTime.With(string(kind), string(id)).ObserveDuration(d)
+}
+
+func (rs *RegistrySink) Stopped(kind KindName, id IdName, d time.Duration, err error) {
+	rs.stops.With(string(kind), string(id), result(err)).Inc()
+	rs.stopTime.With(string(kind), string(id)).ObserveDuration(d)
+}
+
+func (rs *RegistrySink) Restarted(kind KindName, id IdName) {
+	rs.restarts.With(string(kind), string(id)).Inc()
+}
+
+func (rs *RegistrySink) Recovered(kind KindName, id IdName) {
+	rs.recovered.With(string(kind), string(id)).Inc()
+}
+
+func (rs *RegistrySink) StateTime(kind KindName, id IdName, running bool, d time.Duration) {
+	state := "stopped"
+	if running {
+		state = "running"
+	}
+	rs.stateTime.With(string(kind), string(id), state).Add(d.Seconds())
+}
+
+func (rs *RegistrySink) Workers(kind KindName, id IdName, delta int) {
+	rs.workers.With(string(kind), string(id)).Add(float64(delta))
+}
+
+// MetricsSink returns the sink the component reports to.
+func (cpbd *CptMetaSt) MetricsSink() MetricsSink {
+	cpbd.mu.Lock()
+	s := cpbd.ms
+	cpbd.mu.Unlock()
+	if s == nil {
+		return DefaultMetricsSink()
+	}
+	return s
+}
+
+// SetMetricsSink makes the component report to s, the default sink if nil.
+func (cpbd *CptMetaSt) SetMetricsSink(s MetricsSink) {
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	cpbd.ms = s
+}
+
+// stateChanged reports the time spent in the state left for running, or for stopped if not running.
+func (cpbd *CptMetaSt) stateChanged(running bool) {
+	now := time.Now()
+	cpbd.mu.Lock()
+	since := cpbd.since
+	cpbd.since = now
+	cpbd.mu.Unlock()
+	if !since.IsZero() {
+		cpbd.MetricsSink().StateTime(cpbd.KindStr, cpbd.IdStr, !running, now.Sub(since))
+	}
+}
+
+func (cpbd *CptMetaSt) WorkerStarted() {
+	cpbd.MetricsSink().Workers(cpbd.KindStr, cpbd.IdStr, 1)
+}
+
+func (cpbd *CptMetaSt) WorkerExited() {
+	cpbd.MetricsSink().Workers(cpbd.KindStr, cpbd.IdStr, -1)
+}
+
+// observedWorker reports the workers of cpbd when the WorkerRecover of a component
+// doesn't embed it. Its Recover is promoted, so recover() still applies to the panic.
+type observedWorker struct {
+	mdl.WorkerRecover
+	cpbd *CptMetaSt
+}
+
+func (ow observedWorker) WorkerStarted() {
+	ow.cpbd.WorkerStarted()
+}
+
+func (ow observedWorker) WorkerExited() {
+	ow.cpbd.WorkerExited()
+}
@@ -0,0 +1,93 @@
+package component_test
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"common/metrics"
+	cmpt "common/model/component"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panicking is a WorkerRecover of its own, not embedding the CptMetaSt.
+type panicking struct {
+	recovered atomic.Int32
+}
+
+func (p *panicking) Work() error {
+	panic("boom")
+}
+
+func (p *panicking) Recover() {
+	if rc := recover(); rc != nil {
+		p.recovered.Add(1)
+	}
+}
+
+func TestCptLifecycleMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	sink := cmpt.NewRegistrySink(reg)
+	gauge := func(name string) float64 {
+		return reg.Gauge(name, "", "kind", "id").With("sensor", "poller").Value()
+	}
+	// counter returns the value of the counter name of the component with the label label=value, if any
+	counter := func(name string, label ...string) float64 {
+		c := reg.Counter(name, "", append([]string{"kind", "id"}, label[:min(1, len(label))]...)...)
+		return c.With(append([]string{"sensor", "poller"}, label[min(1, len(label)):]...)...).Value()
+	}
+
+	w := &countingWorker{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("poller"), cmpt.KindName("sensor"), sink)}
+	w.WorkerRecover = w
+	require.NoError(t, w.Start())
+	assert.Eventually(t, func() bool { return gauge("cpt_active_workers") == 1 }, time.Second, 5*time.Millisecond)
+	assert.Error(t, w.Start())
+	assert.Equal(t, 1.0, counter("cpt_starts_total", "result", "ok"))
+	assert.Equal(t, 1.0, counter("cpt_starts_total", "result", "error"))
+	assert.Positive(t, counter("cpt_state_seconds_total", "state", "stopped"))
+
+	require.NoError(t, cmpt.Restart(w))
+	assert.Equal(t, 1.0, counter("cpt_restarts_total"))
+	assert.Equal(t, 2.0, counter("cpt_starts_total", "result", "ok"))
+	assert.Equal(t, 1.0, counter("cpt_stops_total", "result", "ok"))
+	assert.Positive(t, counter("cpt_state_seconds_total", "state", "running"))
+
+	require.NoError(t, w.Stop())
+	require.NoError(t, w.Finalize())
+	assert.Equal(t, 0.0, gauge("cpt_active_workers"))
+	assert.Equal(t, 0, w.Ctrl().WaitGroup().Active())
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Contains(t, buf.String(), `cpt_start_duration_seconds_count{kind="sensor",id="poller"} 3`)
+	assert.Contains(t, buf.String(), `cpt_stops_total{kind="sensor",id="poller",result="ok"} 2`)
+
+	// the panics recovered by the CptMetaSt are counted
+	cp := cmpt.NewCptMetaSt(cmpt.IdName("poller"), cmpt.KindName("sensor"), sink)
+	pw := &panickingCpt{CptMetaSt: cp}
+	cp.WorkerRecover = pw
+	require.NoError(t, pw.Start())
+	assert.Eventually(t, func() bool { return counter("cpt_recovered_panics_total") == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, pw.Stop())
+	require.NoError(t, pw.Finalize())
+
+	// a WorkerRecover not embedding the CptMetaSt still recovers its panics and has its workers counted
+	p := &panicking{}
+	cp = cmpt.NewCptMetaSt(cmpt.IdName("poller"), cmpt.KindName("sensor"), sink, p)
+	require.NoError(t, cp.Start())
+	assert.Eventually(t, func() bool { return p.recovered.Load() == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, cp.Stop())
+	require.NoError(t, cp.Finalize())
+	assert.Equal(t, 0.0, gauge("cpt_active_workers"))
+}
+
+type panickingCpt struct {
+	*cmpt.CptMetaSt
+}
+
+func (p *panickingCpt) Work() error {
+	panic("boom")
+}
@@ -1,17 +1,27 @@
 package component_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"common/log"
+	mdl "common/model"
 	cmpt "common/model/component"
+	"common/model/component/componenttest"
+	"common/trace"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestReflect(t *testing.T) {
@@ -64,3 +74,183 @@ func TestComponentBase(t *testing.T) {
 	}
 	assert.Equal(t, false, cpbd.IsRunning())
 }
+
+func TestCptLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	base := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel))
+	lf := log.NewFactory(base).WithCtrlLineage(true)
+
+	ctrl := mdl.NewCtrlSt(context.Background())
+	cp := cmpt.NewCptMetaSt(cmpt.IdName("sensor1"), cmpt.KindName("sensor"), ctrl.ForkCtxWg(), lf)
+	cp.Logger().Info("hello")
+
+	out := buf.String()
+	assert.Contains(t, out, `"logger":"sensor"`)
+	assert.Contains(t, out, `"kind":"sensor"`)
+	assert.Contains(t, out, `"id":"sensor1"`)
+	assert.Contains(t, out, `"ctrl":"`+ctrl.Lineage()+`/`)
+	assert.Same(t, lf, cp.LoggerFactory())
+}
+
+func TestCptFinalizeFlushesLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	aw := log.NewAsyncWriter(zapcore.AddSync(buf), nil, log.AsyncConf{FlushInterval: time.Hour}, nil)
+	defer aw.Close()
+	base := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), aw, zap.DebugLevel))
+
+	cp := cmpt.NewCptMetaSt(cmpt.IdName("sensor1"), cmpt.KindName("sensor"), context.Background(), log.NewFactory(base))
+	require.NoError(t, cp.Start())
+	cp.Logger().Info("shutting down")
+	require.NoError(t, cp.Stop())
+	assert.NotContains(t, buf.String(), "shutting down")
+
+	require.NoError(t, cp.Finalize())
+	assert.Contains(t, buf.String(), "shutting down")
+}
+
+type tracedWorker struct {
+	*cmpt.CptMetaSt
+}
+
+func (w *tracedWorker) Work() error {
+	w.Logger().Info("command handled")
+	return w.CptMetaSt.Work()
+}
+
+func TestCptTraceFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	base := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel))
+
+	root := mdl.NewCtrlSt(context.Background()).WithLogger(base).WithTrace("trace1", "span1")
+	ctrl := root.ForkCtxWgTimeout(time.Minute).ForkCtxWg()
+	tr, ok := ctrl.Trace()
+	require.True(t, ok)
+	assert.Equal(t, mdl.Trace{TraceID: "trace1", SpanID: "span1"}, tr)
+
+	w := &tracedWorker{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("act1"), cmpt.KindName("actuator"), ctrl)}
+	w.WorkerRecover = w
+	require.NoError(t, w.Start())
+	require.NoError(t, w.Stop())
+	require.NoError(t, w.Finalize())
+
+	out := buf.String()
+	assert.Contains(t, out, `"msg":"command handled"`)
+	assert.Contains(t, out, `"trace":"trace1"`)
+	assert.Contains(t, out, `"span":"span1"`)
+	assert.Contains(t, out, `"id":"act1"`)
+}
+
+func TestCptSlogLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mdl.SetLog(mdl.NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	defer mdl.SetLog(nil)
+
+	cp := cmpt.NewCptMetaSt(cmpt.IdName("sensor9"), cmpt.KindName("sensor"), context.Background())
+	cp.Log().Info("via slog")
+
+	out := buf.String()
+	assert.Contains(t, out, `"msg":"component initialized.","kind":"sensor","id":"sensor9"`)
+	assert.Contains(t, out, `"msg":"via slog","kind":"sensor","id":"sensor9"`)
+}
+
+type countingWorker struct {
+	*cmpt.CptMetaSt
+	runs atomic.Int32
+}
+
+func (w *countingWorker) Work() error {
+	w.runs.Add(1)
+	return w.CptMetaSt.Work()
+}
+
+func TestCptRestart(t *testing.T) {
+	w := &countingWorker{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("poller"), cmpt.KindName("sensor"))}
+	w.WorkerRecover = w
+	require.NoError(t, w.Start())
+	assert.Eventually(t, func() bool { return w.runs.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, cmpt.Restart(w))
+	assert.True(t, w.IsRunning())
+	assert.NoError(t, w.Ctrl().Context().Err())
+	assert.Eventually(t, func() bool { return w.runs.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, w.Stop())
+	require.NoError(t, w.Finalize())
+}
+
+func TestCptSpans(t *testing.T) {
+	exp := trace.NewMemoryExporter()
+	ctrl := mdl.NewCtrlSt(context.Background()).WithTrace("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	cp := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), ctrl, trace.NewTracer("gw", exp))
+	require.NoError(t, cp.Start())
+	_, sp := cp.StartSpan("sensor.poll", "n", 1)
+	sp.End()
+	require.NoError(t, cp.Stop())
+	assert.Error(t, cp.Stop())
+	require.NoError(t, cp.Finalize())
+
+	spans := exp.Spans()
+	require.Len(t, spans, 4)
+	for i, name := range []string{"cpt.start", "sensor.poll", "cpt.stop", "cpt.stop"} {
+		assert.Equal(t, name, spans[i].Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[i].TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", spans[i].ParentSpanID)
+		assert.Equal(t, "sensor", spans[i].Attrs["cpt.kind"])
+		assert.Equal(t, "t1", spans[i].Attrs["cpt.id"])
+	}
+	assert.Equal(t, 1, spans[1].Attrs["n"])
+	assert.Equal(t, trace.StatusUnset, spans[2].Status)
+	assert.Equal(t, trace.StatusError, spans[3].Status)
+}
+
+func TestCptNoLeaks(t *testing.T) {
+	// the components forking the CtrlSt of a parent share its WorkerWG
+	parent := mdl.NewCtrlSt(context.Background())
+	a := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("a"), parent.ForkCtxWg())
+	b := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("b"), parent.ForkCtxWgTimeout(time.Hour))
+	ha, hb := componenttest.New(t, a), componenttest.New(t, b)
+	require.True(t, ha.Start())
+	require.True(t, hb.Start())
+	ha.AssertWorkers(2)
+	hb.Restart()
+	ha.AssertWorkers(2)
+	ha.Stop()
+	hb.Stop()
+	ha.Finalize()
+	hb.Finalize()
+	hb.VerifyNoLeaks()
+
+	// a component on a timed out CtrlSt
+	h := componenttest.New(t, cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("c"), mdl.NewCtrlSt(context.Background()).WithTimeout(context.Background(), 10*time.Millisecond)))
+	require.True(t, h.Start())
+	h.AssertDone()
+	h.AssertWorkers(0)
+	h.Shutdown()
+}
+
+func TestCptFinalize(t *testing.T) {
+	// cancelled, Finalize waits for the workers and returns nil
+	w := &countingWorker{CptMetaSt: cmpt.NewCptMetaSt(cmpt.IdName("poller"), cmpt.KindName("sensor"))}
+	w.WorkerRecover = w
+	require.NoError(t, w.Start())
+	assert.Eventually(t, func() bool { return w.Ctrl().WaitGroup().Active() == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, w.Stop())
+	require.NoError(t, w.Finalize())
+	assert.Zero(t, w.Ctrl().WaitGroup().Active())
+
+	// timed out
+	cp := cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t1"), mdl.NewCtrlSt(nil).WithTimeout(context.Background(), time.Millisecond))
+	require.NoError(t, cp.Start())
+	require.NoError(t, cp.Finalize())
+	assert.Zero(t, cp.Ctrl().WaitGroup().Active())
+
+	// any other error of the context is returned
+	ctrl, fc := componenttest.NewFakeCtrl()
+	cp = cmpt.NewCptMetaSt(cmpt.KindName("sensor"), cmpt.IdName("t2"), ctrl)
+	require.NoError(t, cp.Start())
+	fc.Fail(errors.New("link lost"))
+	assert.EqualError(t, cp.Finalize(), "link lost")
+}
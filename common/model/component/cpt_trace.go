@@ -0,0 +1,25 @@
+package component
+
+import (
+	"context"
+
+	"common/trace"
+)
+
+// Tracer returns the Tracer of the component, trace.Default unless given to NewCptMetaSt.
+func (cpbd *CptMetaSt) Tracer() *trace.Tracer {
+	cpbd.mu.Lock()
+	t := cpbd.tracer
+	cpbd.mu.Unlock()
+	if t == nil {
+		return trace.Default()
+	}
+	return t
+}
+
+// StartSpan starts the span name of the component, a child of the trace carried by its Ctrl,
+// with the kind and id attributes, e.g. for an iteration of a periodic Work.
+func (cpbd *CptMetaSt) StartSpan(name string, attrs ...any) (context.Context, *trace.Span) {
+	attrs = append([]any{"cpt.kind", string(cpbd.KindStr), "cpt.id", string(cpbd.IdStr)}, attrs...)
+	return cpbd.Tracer().Start(cpbd.Ctrl().Context(), name, attrs...)
+}
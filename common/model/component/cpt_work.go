@@ -9,10 +9,14 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"common/log"
 	mdl "common/model"
+	"common/trace"
 
 	uuid "github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 var (
@@ -20,11 +24,23 @@ var (
 	_ CptRoot           = (*CptMetaSt)(nil)
 	_ Cpt               = (*CptMetaSt)(nil)
 	_ mdl.WorkerRecover = (*CptMetaSt)(nil)
+	_ CptLogger         = (*CptMetaSt)(nil)
 )
 
 type CptMetaSt struct {
-	mu    *sync.Mutex
+	mu    *sync.Mutex // guards ctlSt lf lg il trLg trIl tr ms since tracer
 	ctlSt *mdl.CtrlSt
+	lf    *log.Factory
+	lg    *zap.Logger
+	il    mdl.Logger // the library Logger the component logs through
+	// lg and il with the fields of the trace carried by ctlSt
+	trLg  *zap.Logger
+	trIl  mdl.Logger
+	tr    mdl.Trace
+	ms    MetricsSink // nil reports to DefaultMetricsSink
+	since time.Time   // 进入当前状态的时间
+	// nil starts the spans on trace.Default
+	tracer *trace.Tracer
 
 	IdStr   IdName
 	KindStr KindName
@@ -33,12 +49,13 @@ type CptMetaSt struct {
 }
 
 // 该函数会直接copy创建cm.ControlStruct
-// Accepted type: IdName KindName context.Context context.CancelFunc or *common.CommonStruct
+// Accepted type: IdName KindName mdl.WorkerRecover *mdl.CtrlSt *log.Factory *zap.Logger mdl.Logger MetricsSink or *trace.Tracer
 func NewCpt(v ...any) *CptMetaSt {
 	cpbd := &CptMetaSt{
 		mu:    &sync.Mutex{},
 		ctlSt: nil,
 		State: &atomic.Value{},
+		since: time.Now(),
 	}
 
 	for i := range v {
@@ -55,6 +72,16 @@ func NewCpt(v ...any) *CptMetaSt {
 			cpbd.mu.Lock()
 			cpbd.ctlSt = v[i].(*mdl.CtrlSt)
 			cpbd.mu.Unlock()
+		case *log.Factory:
+			cpbd.lf = v[i].(*log.Factory)
+		case *zap.Logger:
+			cpbd.lg = v[i].(*zap.Logger)
+		case mdl.Logger:
+			cpbd.il = v[i].(mdl.Logger)
+		case MetricsSink:
+			cpbd.ms = v[i].(MetricsSink)
+		case *trace.Tracer:
+			cpbd.tracer = v[i].(*trace.Tracer)
 		}
 	}
 
@@ -71,17 +98,19 @@ func NewCpt(v ...any) *CptMetaSt {
 		cpbd.Id()
 	}
 
-	mdl.L.Sugar().Debugf("component-%s:initialized.", cpbd.CmptInfo())
+	cpbd.initLogger()
+	cpbd.Log().Debug("component initialized.")
 	return cpbd
 }
 
 // 该函数会自己检查和创建 cm.ControlStruct有默认的行为
-// Accepted type: IdName KindName context.Context context.CancelFunc or *common.CommonStruct
+// Accepted type: IdName KindName mdl.WorkerRecover *mdl.CtrlSt *log.Factory *zap.Logger mdl.Logger MetricsSink or *trace.Tracer
 func NewCptMetaSt(v ...any) *CptMetaSt {
 	cpbd := &CptMetaSt{
 		mu:    &sync.Mutex{},
 		ctlSt: nil,
 		State: &atomic.Value{},
+		since: time.Now(),
 	}
 
 	for i := range v {
@@ -102,6 +131,16 @@ func NewCptMetaSt(v ...any) *CptMetaSt {
 			cpbd.mu.Lock()
 			cpbd.ctlSt = v[i].(*mdl.CtrlSt)
 			cpbd.mu.Unlock()
+		case *log.Factory:
+			cpbd.lf = v[i].(*log.Factory)
+		case *zap.Logger:
+			cpbd.lg = v[i].(*zap.Logger)
+		case mdl.Logger:
+			cpbd.il = v[i].(mdl.Logger)
+		case MetricsSink:
+			cpbd.ms = v[i].(MetricsSink)
+		case *trace.Tracer:
+			cpbd.tracer = v[i].(*trace.Tracer)
 		}
 	}
 
@@ -136,10 +175,102 @@ func NewCptMetaSt(v ...any) *CptMetaSt {
 		cpbd.Id()
 	}
 
-	mdl.L.Sugar().Debugf("%s-%s:initialized.", cpbd.CmptInfo(), cpbd.Ctrl().DebugInfo())
+	cpbd.initLogger()
+	cpbd.Log().Debug("component initialized.", "ctrl", cpbd.Ctrl().DebugInfo())
 	return cpbd
 }
 
+// initLogger creates the component logger if it's not given.
+func (cpbd *CptMetaSt) initLogger() {
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	if cpbd.lf == nil {
+		cpbd.lf = log.DefaultFactory()
+	}
+	if cpbd.il == nil && cpbd.lg != nil {
+		// the given zap logger backs the library Logger too
+		cpbd.il = mdl.NewZapLogger(cpbd.lg)
+	}
+	if cpbd.lg == nil {
+		cpbd.lg = cpbd.lf.Cpt(string(cpbd.KindStr), string(cpbd.IdStr), cpbd.ctlSt)
+	}
+	if cpbd.il == nil {
+		cpbd.il = cpbd.lf.CptLog(string(cpbd.KindStr), string(cpbd.IdStr), cpbd.ctlSt)
+	}
+}
+
+// Logger returns the component logger with the kind and id fields,
+// and the trace fields if the context of Ctrl carries a trace.
+func (cpbd *CptMetaSt) Logger() *zap.Logger {
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	if cpbd.lg == nil {
+		return mdl.Zap()
+	}
+	if cpbd.ctlSt == nil {
+		return cpbd.lg
+	}
+	tr, ok := cpbd.ctlSt.Trace()
+	if !ok {
+		return cpbd.lg
+	}
+	cpbd.traced(tr)
+	return cpbd.trLg
+}
+
+// Log returns the library Logger of the component, the internal messages are logged through it.
+// It is backed by Logger unless the library Logger is set to another backend, see log.ReplaceSlogGlobals.
+func (cpbd *CptMetaSt) Log() mdl.Logger {
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	if cpbd.il == nil {
+		return mdl.Log()
+	}
+	if cpbd.ctlSt == nil {
+		return cpbd.il
+	}
+	tr, ok := cpbd.ctlSt.Trace()
+	if !ok {
+		return cpbd.il
+	}
+	cpbd.traced(tr)
+	return cpbd.trIl
+}
+
+// traced updates the loggers with the fields of tr. must hold cpbd.mu
+func (cpbd *CptMetaSt) traced(tr mdl.Trace) {
+	if cpbd.trLg != nil && cpbd.tr == tr {
+		return
+	}
+	cpbd.tr = tr
+	cpbd.trLg = log.WithTrace(cpbd.lg, tr)
+	cpbd.trIl = cpbd.il.With(log.TraceKey, tr.TraceID, log.SpanKey, tr.SpanID)
+}
+
+// LoggerFactory returns the factory the component logger is created from.
+func (cpbd *CptMetaSt) LoggerFactory() *log.Factory {
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	if cpbd.lf == nil {
+		return log.DefaultFactory()
+	}
+	return cpbd.lf
+}
+
+// SetLoggerFactory recreates the component logger from f.
+// A composite should also pass f.Child(kind, id) to its Cpts.
+func (cpbd *CptMetaSt) SetLoggerFactory(f *log.Factory) {
+	if f == nil {
+		f = log.DefaultFactory()
+	}
+	cpbd.mu.Lock()
+	defer cpbd.mu.Unlock()
+	cpbd.lf = f
+	cpbd.lg = f.Cpt(string(cpbd.KindStr), string(cpbd.IdStr), cpbd.ctlSt)
+	cpbd.il = f.CptLog(string(cpbd.KindStr), string(cpbd.IdStr), cpbd.ctlSt)
+	cpbd.trLg, cpbd.trIl = nil, nil
+}
+
 func (cpbd *CptMetaSt) CmptInfo() string {
 	return fmt.Sprintf("(cmpt)[Kd:%s,Id:%s]", cpbd.KindStr, cpbd.IdStr)
 }
@@ -160,7 +291,7 @@ func (cpbd *CptMetaSt) Id() IdName {
 		if uuid, err := uuid.NewUUID(); err == nil {
 			cpbd.IdStr = IdName(uuid.String())
 		} else {
-			mdl.L.Sugar().Debugf("Error generating id: %+v", err)
+			mdl.Log().Debug("Error generating id", "err", err)
 			cpbd.IdStr = (IdName)(fmt.Sprintf("%s_%X", cpbd.Kind(), rand.Intn(int(^uint(0)>>1))))
 		}
 	}
@@ -195,7 +326,7 @@ func (cpbd *CptMetaSt) Work() (err error) {
 			return nil
 		}
 		if errors.Is(err, context.DeadlineExceeded) {
-			mdl.L.Sugar().Debugf("Components-%s  Work timeout error : %+v", cpbd.CmptInfo(), err)
+			cpbd.Log().Debug("Work timeout", "err", err)
 			return nil
 		}
 		return err
@@ -208,42 +339,84 @@ func (cpbd *CptMetaSt) Recover() {
 		var buf [8196]byte
 		//只打印出本golang内部的调用栈
 		n := runtime.Stack(buf[:], false)
-		mdl.L.Sugar().Warnf(`%s Worker Recover :%+v,Stack Trace: %s`, cpbd.CmptInfo(), rc, buf[:n])
+		cpbd.Log().Warn("Worker Recover", "panic", fmt.Sprintf("%+v", rc), "stack", string(buf[:n]))
+		cpbd.MetricsSink().Recovered(cpbd.KindStr, cpbd.IdStr)
 	}
 }
 
-func (cpbd *CptMetaSt) Start() error {
+func (cpbd *CptMetaSt) Start() (err error) {
+	begin := time.Now()
+	_, sp := cpbd.StartSpan("cpt.start")
+	defer func() {
+		cpbd.MetricsSink().Started(cpbd.KindStr, cpbd.IdStr, time.Since(begin), err)
+		sp.SetError(err)
+		sp.End()
+	}()
 	if cpbd.State.Load().(bool) {
 		return fmt.Errorf("component:%s is already Running", cpbd.CmptInfo())
 	}
 
+	var worker mdl.WorkerRecover = cpbd
 	if cpbd.WorkerRecover != nil {
-		cpbd.Ctrl().WaitGroup().StartingWait(cpbd.WorkerRecover)
-	} else {
-		cpbd.Ctrl().WaitGroup().StartingWait(cpbd)
+		worker = cpbd.WorkerRecover
+	}
+	if _, ok := worker.(mdl.WorkerObserver); !ok {
+		worker = observedWorker{WorkerRecover: worker, cpbd: cpbd}
 	}
+	cpbd.Ctrl().WaitGroup().StartingWait(worker)
 	cpbd.Ctrl().WaitGroup().StartAsync()
 	cpbd.State.Store(true)
+	cpbd.stateChanged(true)
 	return nil
 }
 
-func (cpbd *CptMetaSt) Stop() error {
+func (cpbd *CptMetaSt) Stop() (err error) {
+	begin := time.Now()
+	_, sp := cpbd.StartSpan("cpt.stop")
+	defer func() {
+		cpbd.MetricsSink().Stopped(cpbd.KindStr, cpbd.IdStr, time.Since(begin), err)
+		sp.SetError(err)
+		sp.End()
+	}()
 	if !cpbd.State.Load().(bool) {
 		return fmt.Errorf("component:%s is already Stopping", cpbd.CmptInfo())
 	}
 	cpbd.Ctrl().Cancel()
 	<-cpbd.Ctrl().Context().Done()
 	cpbd.State.Store(false)
+	cpbd.stateChanged(false)
 	return nil
 }
 
+// Finalize waits for the context of the component to be done, then for its workers to exit.
+// A context cancelled or timed out is the normal end and Finalize returns nil once the workers
+// exited, any other error of the context is returned without waiting.
 func (cpbd *CptMetaSt) Finalize() error {
 	<-cpbd.Ctrl().Context().Done()
 	if err := cpbd.Ctrl().Context().Err(); err != nil {
-		if !(errors.Is(err, context.Canceled) && errors.Is(err, context.DeadlineExceeded)) {
+		if !(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
 			return err
 		}
 	}
 	cpbd.Ctrl().WaitGroup().WaitAsync()
+	// 工作协程退出后 刷新异步缓冲的日志
+	_ = cpbd.Logger().Sync()
 	return nil
 }
+
+// Restart stops cp if it's running, renews the context of its CtrlSt and starts it again,
+// e.g. to apply a config it can't apply while running. The workers of the previous run
+// see their context done and exit on their own, Restart doesn't wait for them
+// since the WorkerWG may be shared with the CtrlSt forked from the same one.
+func Restart(cp Cpt) error {
+	if cp.IsRunning() {
+		if err := cp.Stop(); err != nil {
+			return err
+		}
+	}
+	cp.Ctrl().Renew()
+	if cm, ok := cp.(CptMetrics); ok {
+		cm.MetricsSink().Restarted(cp.Kind(), cp.Id())
+	}
+	return cp.Start()
+}
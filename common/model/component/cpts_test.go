@@ -1,10 +1,16 @@
 package component_test
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
+	"common/log"
 	cmp "common/model/component"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestComponentsNew(t *testing.T) {
@@ -94,3 +100,20 @@ func BenchmarkRemove(b *testing.B) {
 	tmps.Each(printFunc)
 	fmt.Printf("%s\ncount:%d\n", ss, count)
 }
+
+func TestCptsSetLoggerFactory(t *testing.T) {
+	buf := &bytes.Buffer{}
+	base := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel))
+	lf := log.NewFactory(base)
+
+	child := cmp.NewCptMetaSt(cmp.IdName("child"), cmp.KindName("sensor"))
+	tmps := cmp.NewCpts(child, nil)
+	tmps.SetLoggerFactory(lf.Child("hub", "hub1"))
+	child.Logger().Info("from child")
+
+	out := buf.String()
+	if !strings.Contains(out, `"parents":"hub:hub1"`) || !strings.Contains(out, `"id":"child"`) {
+		t.Errorf("unexpected child log output: %s", out)
+	}
+}
@@ -1,6 +1,8 @@
 package component
 
 import (
+	"common/log"
+
 	multierror "github.com/hashicorp/go-multierror"
 )
 
@@ -67,6 +69,25 @@ func (cps *Cpts) Each(f func(Cpt)) {
 	}
 }
 
+// SetLoggerFactory passes f to each Component carrying its own logger.
+// A composite calls it with f.Child(kind, id) to pass the loggers down the tree.
+func (cps *Cpts) SetLoggerFactory(f *log.Factory) {
+	cps.Each(func(cp Cpt) {
+		if cl, ok := cp.(CptLogger); ok {
+			cl.SetLoggerFactory(f)
+		}
+	})
+}
+
+// SetMetricsSink makes each Component reporting its lifecycle report to s.
+func (cps *Cpts) SetMetricsSink(s MetricsSink) {
+	cps.Each(func(cp Cpt) {
+		if cm, ok := cp.(CptMetrics); ok {
+			cm.SetMetricsSink(s)
+		}
+	})
+}
+
 // Start calls the Start method of each Component in the collection
 func (cps *Cpts) Start() (err error) {
 	for _, cp := range *cps {
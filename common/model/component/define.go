@@ -1,7 +1,10 @@
 package component
 
 import (
+	"common/log"
 	mdl "common/model"
+
+	"go.uber.org/zap"
 )
 
 // *************************** Component ***************************
@@ -33,6 +36,14 @@ type CptRoot interface {
 	Finalize() error
 }
 
+// CptLogger is implemented by the components carrying their own logger,
+// Cpts uses it to pass the logger factory down a composite tree.
+type CptLogger interface {
+	Logger() *zap.Logger
+	Log() mdl.Logger
+	SetLoggerFactory(*log.Factory)
+}
+
 type CptsOperator interface {
 	AddCpts(...Cpt)
 	RemoveCpts(...Cpt)
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey int
+
+const (
+	loggerCtxKey ctxKey = iota
+	traceCtxKey
+)
+
+// Trace is the correlation of a request across the components, e.g. a device command.
+type Trace struct {
+	TraceID string
+	SpanID  string
+}
+
+// ContextWithLogger returns a copy of ctx carrying logger.
+func ContextWithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey, logger)
+}
+
+// LoggerFromContext returns the logger carried by ctx, or nil.
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(loggerCtxKey).(*zap.Logger)
+	return l
+}
+
+// ContextWithTrace returns a copy of ctx carrying the trace and span ids.
+func ContextWithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, traceCtxKey, Trace{TraceID: traceID, SpanID: spanID})
+}
+
+// TraceFromContext returns the trace carried by ctx, ok is false if there is none.
+func TraceFromContext(ctx context.Context) (tr Trace, ok bool) {
+	if ctx == nil {
+		return tr, false
+	}
+	tr, ok = ctx.Value(traceCtxKey).(Trace)
+	return tr, ok
+}
+
+// NewTraceID returns a random 16 bytes trace id in hex, as in W3C trace context.
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID returns a random 8 bytes span id in hex.
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
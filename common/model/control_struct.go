@@ -3,7 +3,9 @@ package common
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tmrp "common/model/timerpool"
@@ -14,10 +16,13 @@ import (
 
 var (
 	// publish  use zap.NewProduction() that error print structure is different.
+	// L is the default library zap logger, read it with Zap since SetZap replaces it.
 	L, _ = zap.NewDevelopment()
 	//L, _ = zap.NewProduction()
 	TimerPool = &tmrp.TimerPool{}
 	Json      = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	ctrlSeq atomic.Uint64 // sequence of CtrlSt ids
 )
 
 func init() {
@@ -30,8 +35,13 @@ type CtrlSt struct {
 	c   context.Context
 	ccl context.CancelFunc
 	wwg *WorkerWG
+	// parent and tm are the context and timeout c is derived from, Renew derives c again
+	parent context.Context
+	tm     time.Duration
 
 	rwm *sync.RWMutex
+	// lineage is the ids of the forked-from CtrlSt and itself, e.g. "1/4/9"
+	lineage string
 }
 
 func NewCtrlSt(ctx context.Context) *CtrlSt {
@@ -39,15 +49,29 @@ func NewCtrlSt(ctx context.Context) *CtrlSt {
 		ctx = context.Background()
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	ctx0, cancel := context.WithCancel(ctx)
 	return &CtrlSt{
-		c:   ctx,
-		ccl: cancel,
-		wwg: NewWorkerWG(),
-		rwm: &sync.RWMutex{},
+		c:       ctx0,
+		ccl:     cancel,
+		wwg:     NewWorkerWG(),
+		parent:  ctx,
+		rwm:     &sync.RWMutex{},
+		lineage: strconv.FormatUint(ctrlSeq.Add(1), 10),
 	}
 }
 
+// Lineage returns the fork path of the CtrlSt from its root, e.g. "1/4/9".
+func (cs *CtrlSt) Lineage() string {
+	cs.rwm.RLock()
+	defer cs.rwm.RUnlock()
+	return cs.lineage
+}
+
+// must hold cs.rwm
+func (cs *CtrlSt) forkLineage() string {
+	return cs.lineage + "/" + strconv.FormatUint(ctrlSeq.Add(1), 10)
+}
+
 func (cs *CtrlSt) DebugInfo() string {
 	cs.rwm.RLock()
 	// don't use # format string placeholders because that raises runtime race condition
@@ -81,10 +105,12 @@ func (cs *CtrlSt) ForkCtxWg() *CtrlSt {
 	defer cs.rwm.RUnlock()
 	ctx, cancel := context.WithCancel(cs.c)
 	return &CtrlSt{
-		c:   ctx,
-		ccl: cancel,
-		wwg: cs.wwg,
-		rwm: &sync.RWMutex{},
+		c:       ctx,
+		ccl:     cancel,
+		wwg:     cs.wwg,
+		parent:  cs.c,
+		rwm:     &sync.RWMutex{},
+		lineage: cs.forkLineage(),
 	}
 }
 
@@ -94,10 +120,13 @@ func (cs *CtrlSt) ForkCtxWgTimeout(tm time.Duration) *CtrlSt {
 
 	ctx, cancel := context.WithTimeout(cs.c, tm)
 	return &CtrlSt{
-		c:   ctx,
-		ccl: cancel,
-		wwg: cs.wwg,
-		rwm: &sync.RWMutex{},
+		c:       ctx,
+		ccl:     cancel,
+		wwg:     cs.wwg,
+		parent:  cs.c,
+		tm:      tm,
+		rwm:     &sync.RWMutex{},
+		lineage: cs.forkLineage(),
 	}
 }
 
@@ -115,14 +144,67 @@ func (cs *CtrlSt) WithCtx(ctx context.Context) *CtrlSt {
 	ctx0, cancel0 := context.WithCancel(ctx)
 	cs.c = ctx0
 	cs.ccl = cancel0
+	cs.parent, cs.tm = ctx, 0
 	return cs
 }
 
 func (cs *CtrlSt) WithTimeout(ctx context.Context, tm time.Duration) *CtrlSt {
 	cs.rwm.Lock()
 	defer cs.rwm.Unlock()
-	ctx, cancel := context.WithTimeout(ctx, tm)
-	cs.c = ctx
+	ctx0, cancel := context.WithTimeout(ctx, tm)
+	cs.c = ctx0
 	cs.ccl = cancel
+	cs.parent, cs.tm = ctx, tm
 	return cs
 }
+
+// Renew derives the context of cs again from its parent after a Cancel, e.g. to start a stopped component again.
+// The timeout of the CtrlSt created with one starts over. Renew does nothing if the parent is done.
+func (cs *CtrlSt) Renew() *CtrlSt {
+	cs.rwm.Lock()
+	defer cs.rwm.Unlock()
+	if cs.parent == nil || cs.parent.Err() != nil || cs.c.Err() == nil {
+		return cs
+	}
+	if cs.tm > 0 {
+		cs.c, cs.ccl = context.WithTimeout(cs.parent, cs.tm)
+	} else {
+		cs.c, cs.ccl = context.WithCancel(cs.parent)
+	}
+	return cs
+}
+
+// WithLogger makes the context of cs carry logger, the CtrlSt forked afterwards inherit it.
+func (cs *CtrlSt) WithLogger(logger *zap.Logger) *CtrlSt {
+	cs.rwm.Lock()
+	defer cs.rwm.Unlock()
+	// the value context is cancelled with the current one, ccl is kept
+	cs.c = ContextWithLogger(cs.c, logger)
+	if cs.parent != nil {
+		cs.parent = ContextWithLogger(cs.parent, logger)
+	}
+	return cs
+}
+
+// WithTrace makes the context of cs carry the trace and span ids, the CtrlSt forked afterwards inherit them.
+// An empty traceID starts a new trace and an empty spanID a new span.
+func (cs *CtrlSt) WithTrace(traceID, spanID string) *CtrlSt {
+	if len(traceID) == 0 {
+		traceID = NewTraceID()
+	}
+	if len(spanID) == 0 {
+		spanID = NewSpanID()
+	}
+	cs.rwm.Lock()
+	defer cs.rwm.Unlock()
+	cs.c = ContextWithTrace(cs.c, traceID, spanID)
+	if cs.parent != nil {
+		cs.parent = ContextWithTrace(cs.parent, traceID, spanID)
+	}
+	return cs
+}
+
+// Trace returns the trace carried by the context of cs.
+func (cs *CtrlSt) Trace() (Trace, bool) {
+	return TraceFromContext(cs.Context())
+}
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	mdl "common/model"
+	"common/model/clock"
+	tmrp "common/model/timerpool"
+	"common/trace"
 )
 
 const (
@@ -38,6 +41,9 @@ type EvtChans struct {
 
 	// mu     *sync.Mutex // guards closed
 	closed bool
+
+	tp     *tmrp.TimerPool // nil uses the global mdl.TimerPool
+	tracer *trace.Tracer   // nil uses trace.Default
 }
 
 func NewEvtChans(chanlen uint) *EvtChans {
@@ -56,6 +62,23 @@ func NewEvtChans(chanlen uint) *EvtChans {
 	return evtcs
 }
 
+// WithClock makes PublishAsync measure its timeout on clk.
+func (ecs *EvtChans) WithClock(clk clock.Clock) *EvtChans {
+	ecs.rwmu.Lock()
+	defer ecs.rwmu.Unlock()
+	ecs.tp = tmrp.NewTimerPool(clk)
+	return ecs
+}
+
+func (ecs *EvtChans) timerPool() *tmrp.TimerPool {
+	ecs.rwmu.RLock()
+	defer ecs.rwmu.RUnlock()
+	if ecs.tp == nil {
+		return mdl.TimerPool
+	}
+	return ecs.tp
+}
+
 // create a new channel for the given topic
 func (ecs *EvtChans) Subscribe(topic string) <-chan any {
 	if topic == "" {
@@ -155,8 +178,9 @@ func (ecs *EvtChans) PublishAsync(ctx context.Context, tm time.Duration, topic s
 		return ErrChansClose
 	}
 
-	timer := mdl.TimerPool.Get(tm)
-	defer mdl.TimerPool.Put(timer)
+	tp := ecs.timerPool()
+	timer := tp.Get(tm)
+	defer tp.Put(timer)
 	ecs.rwmu.RLock()
 	defer ecs.rwmu.RUnlock()
 	for _, ch := range ecs.subs[topic] {
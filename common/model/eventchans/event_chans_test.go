@@ -8,7 +8,10 @@ import (
 	"testing"
 	"time"
 
+	mdl "common/model"
+	"common/model/clock"
 	ec "common/model/eventchans"
+	"common/trace"
 
 	"go.uber.org/goleak"
 )
@@ -22,6 +25,36 @@ func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
 }
 
+func TestPublishAsyncFakeClock(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	ecs := ec.NewEvtChans(10).WithClock(fc)
+	topic := "topic"
+	c := ecs.Subscribe(topic)
+
+	// fill the buffer so that the next publish has to wait on the timer
+	for i := 0; i < 10; i++ {
+		if !ecs.Publish(topic, i) {
+			t.Fatal("Publish failed")
+		}
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ecs.PublishAsync(context.Background(), time.Second, topic, 10)
+	}()
+	fc.BlockUntil(1)
+	fc.Advance(time.Second)
+	if err := <-errc; err != ec.ErrAsyncTimeOut {
+		t.Fatalf("expected ErrAsyncTimeOut, got %v", err)
+	}
+
+	ecs.Close()
+	for range c {
+	}
+	_ = ecs.UnSubscribe(topic, c)
+	ecs.WaitAsync()
+}
+
 func TestNew(t *testing.T) {
 	ecs := ec.NewEvtChans(1)
 	if ecs == nil {
@@ -329,3 +362,45 @@ func TestManySubscribe(t *testing.T) {
 	}
 	mu.Unlock()
 }
+
+func TestPublishCtxDeliver(t *testing.T) {
+	exp := trace.NewMemoryExporter()
+	ecs := ec.NewEvtChans(10).WithTracer(trace.NewTracer("gw", exp))
+	topic := "device.cmd"
+	c := ecs.Subscribe(topic)
+
+	ctx := mdl.ContextWithTrace(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	if err := ecs.PublishCtx(ctx, time.Second, topic, "on"); err != nil {
+		t.Fatal(err)
+	}
+
+	dctx, msg, end := ecs.Deliver(context.Background(), <-c)
+	if msg != "on" {
+		t.Fatalf("delivered %v, want on", msg)
+	}
+	end(nil)
+
+	pub, dlv := exp.Named("publish "+topic), exp.Named("deliver "+topic)
+	if len(pub) != 1 || len(dlv) != 1 {
+		t.Fatalf("spans %+v", exp.Spans())
+	}
+	if pub[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || pub[0].ParentSpanID != "00f067aa0ba902b7" ||
+		pub[0].Kind != trace.KindProducer || pub[0].Attrs["messaging.subscribers"] != 1 {
+		t.Errorf("publish span %+v", pub[0])
+	}
+	if dlv[0].TraceID != pub[0].TraceID || dlv[0].ParentSpanID != pub[0].SpanID || dlv[0].Kind != trace.KindConsumer {
+		t.Errorf("deliver span %+v not a child of %+v", dlv[0], pub[0])
+	}
+	if tr, _ := mdl.TraceFromContext(dctx); tr.SpanID != dlv[0].SpanID {
+		t.Errorf("deliver context carries %+v, want span %s", tr, dlv[0].SpanID)
+	}
+
+	// a message published without context is delivered as is
+	ecs.Publish(topic, "off")
+	if _, msg, _ = ecs.Deliver(context.Background(), <-c); msg != "off" {
+		t.Fatalf("delivered %v, want off", msg)
+	}
+	if err := ecs.UnSubscribe(topic, c); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,79 @@
+package eventchans
+
+import (
+	"context"
+	"time"
+
+	mdl "common/model"
+	"common/trace"
+)
+
+// Message is a message published by PublishCtx, carrying the trace of its publisher
+// across the channel. The subscribers unwrap it with Deliver.
+type Message struct {
+	Trace     mdl.Trace
+	Topic     string
+	Published time.Time
+	Msg       any
+}
+
+// WithTracer records the spans of PublishCtx and Deliver on t instead of trace.Default.
+func (ecs *EvtChans) WithTracer(t *trace.Tracer) *EvtChans {
+	ecs.rwmu.Lock()
+	defer ecs.rwmu.Unlock()
+	ecs.tracer = t
+	return ecs
+}
+
+func (ecs *EvtChans) getTracer() *trace.Tracer {
+	ecs.rwmu.RLock()
+	defer ecs.rwmu.RUnlock()
+	if ecs.tracer == nil {
+		return trace.Default()
+	}
+	return ecs.tracer
+}
+
+// PublishCtx publishes msgs as PublishAsync does, each wrapped in a Message carrying the trace
+// of ctx. It records a producer span "publish <topic>", the parent of the deliver spans.
+func (ecs *EvtChans) PublishCtx(ctx context.Context, tm time.Duration, topic string, msgs ...any) (err error) {
+	tracer := ecs.getTracer()
+	sctx, sp := tracer.Start(ctx, "publish "+topic, "messaging.destination", topic,
+		"messaging.batch.message_count", len(msgs), "messaging.subscribers", max(0, ecs.HasChansLen(topic)))
+	sp.SetKind(trace.KindProducer)
+	defer func() {
+		sp.SetError(err)
+		sp.End()
+	}()
+
+	tr, _ := mdl.TraceFromContext(sctx)
+	now := time.Now()
+	wrapped := make([]any, len(msgs))
+	for i, msg := range msgs {
+		wrapped[i] = Message{Trace: tr, Topic: topic, Published: now, Msg: msg}
+	}
+	return ecs.PublishAsync(ctx, tm, topic, wrapped...)
+}
+
+// Deliver unwraps m received from a subscription. For a Message it returns ctx carrying its trace
+// and a consumer span "deliver <topic>" child of the publish one, ended by end when m is handled.
+// Any other m is returned as is with ctx.
+func (ecs *EvtChans) Deliver(ctx context.Context, m any) (dctx context.Context, msg any, end func(err error)) {
+	em, ok := m.(Message)
+	if !ok {
+		return ctx, m, func(error) {}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(em.Trace.TraceID) > 0 {
+		ctx = mdl.ContextWithTrace(ctx, em.Trace.TraceID, em.Trace.SpanID)
+	}
+	dctx, sp := ecs.getTracer().Start(ctx, "deliver "+em.Topic, "messaging.destination", em.Topic,
+		"messaging.queue_wait", time.Since(em.Published))
+	sp.SetKind(trace.KindConsumer)
+	return dctx, em.Msg, func(err error) {
+		sp.SetError(err)
+		sp.End()
+	}
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+var (
+	gLog atomic.Pointer[Logger]
+	gZap atomic.Pointer[zap.Logger]
+
+	//Verify Satisfies interfaces
+	_ Logger = (*zapLogger)(nil)
+	_ Logger = (*slogLogger)(nil)
+)
+
+// Logger is the logging interface the library logs through,
+// kv are alternating keys and values as in log/slog.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+	With(kv ...any) Logger
+}
+
+// Log returns the library Logger set by SetLog, or the one of Zap if there is none.
+func Log() Logger {
+	if l := gLog.Load(); l != nil {
+		return *l
+	}
+	return NewZapLogger(Zap())
+}
+
+// SetLog sets the library Logger, nil restores the one of Zap.
+func SetLog(l Logger) {
+	if l == nil {
+		gLog.Store(nil)
+		return
+	}
+	gLog.Store(&l)
+}
+
+// Zap returns the library zap logger set by SetZap, or L if there is none.
+func Zap() *zap.Logger {
+	if l := gZap.Load(); l != nil {
+		return l
+	}
+	return L
+}
+
+// SetZap sets the library zap logger, nil restores L.
+func SetZap(l *zap.Logger) {
+	gZap.Store(l)
+}
+
+// ZapOf returns the zap logger of a Logger of NewZapLogger.
+func ZapOf(l Logger) (*zap.Logger, bool) {
+	if zl, ok := l.(*zapLogger); ok {
+		return zl.l.Desugar().WithOptions(zap.AddCallerSkip(-1)), true
+	}
+	return nil, false
+}
+
+type zapLogger struct {
+	l *zap.SugaredLogger
+}
+
+// NewZapLogger returns the Logger backed by l.
+func NewZapLogger(l *zap.Logger) Logger {
+	// skip the frame of the adapter so that the caller is the one of the library
+	return &zapLogger{l: l.WithOptions(zap.AddCallerSkip(1)).Sugar()}
+}
+
+func (z *zapLogger) Debug(msg string, kv ...any) { z.l.Debugw(msg, kv...) }
+func (z *zapLogger) Info(msg string, kv ...any)  { z.l.Infow(msg, kv...) }
+func (z *zapLogger) Warn(msg string, kv ...any)  { z.l.Warnw(msg, kv...) }
+func (z *zapLogger) Error(msg string, kv ...any) { z.l.Errorw(msg, kv...) }
+
+func (z *zapLogger) With(kv ...any) Logger {
+	return &zapLogger{l: z.l.With(kv...)}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns the Logger backed by l.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(msg string, kv ...any) { s.l.Debug(msg, kv...) }
+func (s *slogLogger) Info(msg string, kv ...any)  { s.l.Info(msg, kv...) }
+func (s *slogLogger) Warn(msg string, kv ...any)  { s.l.Warn(msg, kv...) }
+func (s *slogLogger) Error(msg string, kv ...any) { s.l.Error(msg, kv...) }
+
+func (s *slogLogger) With(kv ...any) Logger {
+	return &slogLogger{l: s.l.With(kv...)}
+}
@@ -3,22 +3,36 @@ package timerpool
 import (
 	"sync"
 	"time"
+
+	"common/model/clock"
 )
 
-// TimerPool provides GC-able pooling of *time.Timer's.
+// TimerPool provides GC-able pooling of *clock.Timer's.
 // can be used by multiple goroutines concurrently.
+// The zero value uses the real clock.
 type TimerPool struct {
-	p sync.Pool
+	p   sync.Pool
+	clk clock.Clock
+}
+
+// NewTimerPool returns a TimerPool whose timers are created by clk.
+func NewTimerPool(clk clock.Clock) *TimerPool {
+	return &TimerPool{clk: clk}
+}
+
+// Clock returns the clock the pool creates timers from.
+func (tp *TimerPool) Clock() clock.Clock {
+	return clock.OrReal(tp.clk)
 }
 
 // Get returns a timer that completes after the given duration.
-func (tp *TimerPool) Get(d time.Duration) *time.Timer {
-	if t, _ := tp.p.Get().(*time.Timer); t != nil {
+func (tp *TimerPool) Get(d time.Duration) *clock.Timer {
+	if t, _ := tp.p.Get().(*clock.Timer); t != nil {
 		t.Reset(d)
 		return t
 	}
 
-	return time.NewTimer(d)
+	return tp.Clock().NewTimer(d)
 }
 
 // Put pools the given timer.
@@ -28,7 +42,7 @@ func (tp *TimerPool) Get(d time.Duration) *time.Timer {
 // Put will try to stop the timer before pooling. If the
 // given timer already expired, Put will read the unreceived
 // value if there is one.
-func (tp *TimerPool) Put(t *time.Timer) {
+func (tp *TimerPool) Put(t *clock.Timer) {
 	if !t.Stop() {
 		select {
 		case <-t.C:
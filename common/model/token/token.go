@@ -7,6 +7,8 @@ import (
 	"time"
 
 	cm "common/model"
+	"common/model/clock"
+	tmrp "common/model/timerpool"
 )
 
 const (
@@ -80,6 +82,7 @@ type BaseToken struct {
 	rwl      *sync.RWMutex
 	complete chan struct{}
 	err      error
+	tp       *tmrp.TimerPool // nil uses the global cm.TimerPool
 }
 
 func NewBaseToken() *BaseToken {
@@ -89,6 +92,23 @@ func NewBaseToken() *BaseToken {
 	}
 }
 
+// WithClock makes WaitTimeout measure its timeout on clk.
+func (b *BaseToken) WithClock(clk clock.Clock) *BaseToken {
+	b.rwl.Lock()
+	defer b.rwl.Unlock()
+	b.tp = tmrp.NewTimerPool(clk)
+	return b
+}
+
+func (b *BaseToken) timerPool() *tmrp.TimerPool {
+	b.rwl.RLock()
+	defer b.rwl.RUnlock()
+	if b.tp == nil {
+		return cm.TimerPool
+	}
+	return b.tp
+}
+
 func (b *BaseToken) Reset() {
 	b.rwl.Lock()
 	defer b.rwl.Unlock()
@@ -118,8 +138,9 @@ func (b *BaseToken) WaitTimeout(d time.Duration) bool {
 		return false
 	}
 
-	timer := cm.TimerPool.Get(d)
-	defer cm.TimerPool.Put(timer)
+	tp := b.timerPool()
+	timer := tp.Get(d)
+	defer tp.Put(timer)
 	select {
 	case _, ok := <-b.complete:
 		if !timer.Stop() {
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"common/model/clock"
 	token "common/model/token"
 )
 
@@ -73,6 +74,35 @@ func TestClosedChan02(t *testing.T) {
 exit:
 }
 
+func TestWaitTimeoutFakeClock(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	tk := token.NewBaseToken().WithClock(fc)
+
+	result := make(chan bool, 1)
+	go func() {
+		result <- tk.WaitTimeout(5 * time.Second)
+	}()
+
+	fc.BlockUntil(1)
+	fc.Advance(5 * time.Second)
+	if <-result {
+		t.Fatal("Should have timed out")
+	}
+	if err := tk.Err(); !errors.Is(err, token.ErrWaitedTimeOut) {
+		t.Fatalf("expected ErrWaitedTimeOut, got %v", err)
+	}
+
+	tk.Reset()
+	go func() {
+		result <- tk.WaitTimeout(5 * time.Second)
+	}()
+	fc.BlockUntil(1)
+	go tk.Completed()
+	if !<-result {
+		t.Fatal("Should have completed before the timeout")
+	}
+}
+
 func TestWaitTimeout(t *testing.T) {
 	b := token.BaseToken{}
 	if b.Wait() {
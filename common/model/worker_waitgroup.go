@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 )
 
 // 无交互的goroutine接口
@@ -20,6 +21,13 @@ type WorkerRecover interface {
 	Recover
 }
 
+// WorkerObserver is notified by the WorkerWG when the worker implementing it
+// starts working and when it exits, after a panic recovered too.
+type WorkerObserver interface {
+	WorkerStarted()
+	WorkerExited()
+}
+
 // type WorkerWrapper interface {
 // 	StartingWait(worker WorkerRecover)
 // 	Started() bool
@@ -31,16 +39,23 @@ type WorkerWG struct {
 	startChanClosed bool
 	wrwm            *sync.RWMutex // guards worker
 	wm              *sync.Mutex   // guards waitgroup wait and add(+n)
+	active          *atomic.Int64 // 正在Work的协程数
 }
 
 func NewWorkerWG() *WorkerWG {
 	return &WorkerWG{
-		wg:   &sync.WaitGroup{},
-		wrwm: &sync.RWMutex{},
-		wm:   &sync.Mutex{},
+		wg:     &sync.WaitGroup{},
+		wrwm:   &sync.RWMutex{},
+		wm:     &sync.Mutex{},
+		active: &atomic.Int64{},
 	}
 }
 
+// Active returns the number of workers working.
+func (w *WorkerWG) Active() int {
+	return int(w.active.Load())
+}
+
 func (w *WorkerWG) DebugInfo() string {
 	w.wrwm.RLock()
 	defer w.wrwm.RUnlock()
@@ -75,6 +90,12 @@ func (w *WorkerWG) StartingWait(worker WorkerRecover) {
 		if startchan != nil {
 			<-startchan
 		}
+		w.active.Add(1)
+		defer w.active.Add(-1)
+		if o, ok := worker.(WorkerObserver); ok {
+			o.WorkerStarted()
+			defer o.WorkerExited()
+		}
 		defer worker.Recover()
 		runtime.Gosched()
 		worker.Work()
@@ -3,11 +3,15 @@ package common
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"common/metrics"
 	mdl "common/model"
+	"common/model/clock"
+	"common/trace"
 )
 
 // 优化后的IOT组件架构实现
@@ -385,50 +389,95 @@ type PerformanceMonitor interface {
 	RecordCPUUsage(percentage float64)
 }
 
-// SimplePerformanceMonitor 简单性能监控实现
+// SimplePerformanceMonitor 基于metrics实现的性能监控
+// 耗时记录为直方图 同时保留最后一次的值
 type SimplePerformanceMonitor struct {
-	mu    sync.RWMutex
-	stats map[string]interface{}
+	mu          sync.RWMutex // guards the metrics
+	creation    *metrics.Histogram
+	start       *metrics.Histogram
+	lastCreate  *metrics.Gauge
+	lastStart   *metrics.Gauge
+	memoryUsage *metrics.Gauge
+	cpuUsage    *metrics.Gauge
+	recorded    map[string]bool // 已记录过的统计项
+}
+
+// NewSimplePerformanceMonitor returns the monitor recording in a Registry of its own,
+// see WithRegistry.
+func NewSimplePerformanceMonitor() *SimplePerformanceMonitor {
+	spm := &SimplePerformanceMonitor{}
+	spm.register(metrics.NewRegistry())
+	return spm
 }
 
-func NewSimplePerformanceMonitor() *SimplePerformanceMonitor {
-	return &SimplePerformanceMonitor{
-		stats: make(map[string]interface{}),
-	}
+// WithRegistry records the metrics in reg, e.g. metrics.Default to expose them.
+func (spm *SimplePerformanceMonitor) WithRegistry(reg *metrics.Registry) *SimplePerformanceMonitor {
+	spm.mu.Lock()
+	defer spm.mu.Unlock()
+	spm.register(reg)
+	return spm
+}
+
+func (spm *SimplePerformanceMonitor) register(reg *metrics.Registry) {
+	spm.creation = reg.Histogram("component_creation_seconds", "Time to create a component.", nil)
+	spm.start = reg.Histogram("component_start_seconds", "Time to start a component.", nil)
+	spm.lastCreate = reg.Gauge("component_creation_last_seconds", "Time to create the last component.")
+	spm.lastStart = reg.Gauge("component_start_last_seconds", "Time to start the last component.")
+	spm.memoryUsage = reg.Gauge("memory_usage_bytes", "Memory used.")
+	spm.cpuUsage = reg.Gauge("cpu_usage_percent", "CPU used, in percent.")
+	spm.recorded = make(map[string]bool)
 }
 
 func (spm *SimplePerformanceMonitor) RecordComponentCreation(duration time.Duration) {
 	spm.mu.Lock()
 	defer spm.mu.Unlock()
-	spm.stats["component_creation_time"] = duration
+	spm.creation.ObserveDuration(duration)
+	spm.lastCreate.Set(duration.Seconds())
+	spm.recorded["component_creation_time"] = true
 }
 
 func (spm *SimplePerformanceMonitor) RecordComponentStart(duration time.Duration) {
 	spm.mu.Lock()
 	defer spm.mu.Unlock()
-	spm.stats["component_start_time"] = duration
+	spm.start.ObserveDuration(duration)
+	spm.lastStart.Set(duration.Seconds())
+	spm.recorded["component_start_time"] = true
 }
 
 func (spm *SimplePerformanceMonitor) RecordMemoryUsage(bytes int64) {
 	spm.mu.Lock()
 	defer spm.mu.Unlock()
-	spm.stats["memory_usage"] = bytes
+	spm.memoryUsage.Set(float64(bytes))
+	spm.recorded["memory_usage"] = true
 }
 
 func (spm *SimplePerformanceMonitor) RecordCPUUsage(percentage float64) {
 	spm.mu.Lock()
 	defer spm.mu.Unlock()
-	spm.stats["cpu_usage"] = percentage
+	spm.cpuUsage.Set(percentage)
+	spm.recorded["cpu_usage"] = true
 }
 
+// GetStats returns the last values recorded, read from the metrics.
 func (spm *SimplePerformanceMonitor) GetStats() map[string]interface{} {
 	spm.mu.RLock()
 	defer spm.mu.RUnlock()
 
-	// 返回副本
+	seconds := func(g *metrics.Gauge) time.Duration {
+		return time.Duration(math.Round(g.Value() * float64(time.Second)))
+	}
 	stats := make(map[string]interface{})
-	for k, v := range spm.stats {
-		stats[k] = v
+	if spm.recorded["component_creation_time"] {
+		stats["component_creation_time"] = seconds(spm.lastCreate)
+	}
+	if spm.recorded["component_start_time"] {
+		stats["component_start_time"] = seconds(spm.lastStart)
+	}
+	if spm.recorded["memory_usage"] {
+		stats["memory_usage"] = int64(spm.memoryUsage.Value())
+	}
+	if spm.recorded["cpu_usage"] {
+		stats["cpu_usage"] = spm.cpuUsage.Value()
 	}
 	return stats
 }
@@ -533,6 +582,8 @@ type BatchEventProcessor struct {
 	eventChan chan *Event
 	done      chan struct{}
 	mu        sync.Mutex
+	clk       clock.Clock
+	tracer    *trace.Tracer // nil uses trace.Default
 }
 
 func NewBatchEventProcessor(batchSize int, processor func([]*Event)) *BatchEventProcessor {
@@ -542,9 +593,22 @@ func NewBatchEventProcessor(batchSize int, processor func([]*Event)) *BatchEvent
 		processor: processor,
 		eventChan: make(chan *Event, 1000),
 		done:      make(chan struct{}),
+		clk:       clock.Real(),
 	}
 }
 
+// WithClock 设置批量处理间隔使用的时钟 需要在Start之前调用
+func (bep *BatchEventProcessor) WithClock(clk clock.Clock) *BatchEventProcessor {
+	bep.clk = clock.OrReal(clk)
+	return bep
+}
+
+// WithTracer 设置记录每批处理span的Tracer 需要在Start之前调用
+func (bep *BatchEventProcessor) WithTracer(t *trace.Tracer) *BatchEventProcessor {
+	bep.tracer = t
+	return bep
+}
+
 func (bep *BatchEventProcessor) Start() {
 	go bep.process()
 }
@@ -563,7 +627,7 @@ func (bep *BatchEventProcessor) SendEvent(event *Event) {
 }
 
 func (bep *BatchEventProcessor) process() {
-	ticker := time.NewTicker(10 * time.Millisecond) // 批量处理间隔
+	ticker := bep.clk.NewTicker(10 * time.Millisecond) // 批量处理间隔
 	defer ticker.Stop()
 
 	for {
@@ -580,12 +644,7 @@ func (bep *BatchEventProcessor) process() {
 				bep.mu.Unlock()
 
 				// 批量处理事件
-				bep.processor(events)
-
-				// 归还事件对象到池中
-				for _, e := range events {
-					eventPool.Put(e)
-				}
+				bep.handle(events, "size")
 			} else {
 				bep.mu.Unlock()
 			}
@@ -599,12 +658,7 @@ func (bep *BatchEventProcessor) process() {
 				bep.events = bep.events[:0]
 				bep.mu.Unlock()
 
-				bep.processor(events)
-
-				// 归还事件对象到池中
-				for _, e := range events {
-					eventPool.Put(e)
-				}
+				bep.handle(events, "interval")
 			} else {
 				bep.mu.Unlock()
 			}
@@ -613,10 +667,7 @@ func (bep *BatchEventProcessor) process() {
 			// 处理剩余事件
 			bep.mu.Lock()
 			if len(bep.events) > 0 {
-				bep.processor(bep.events)
-				for _, e := range bep.events {
-					eventPool.Put(e)
-				}
+				bep.handle(bep.events, "stop")
 			}
 			bep.mu.Unlock()
 			return
@@ -624,6 +675,23 @@ func (bep *BatchEventProcessor) process() {
 	}
 }
 
+// handle 处理一批事件并记录span trigger为触发处理的原因 size interval或stop
+func (bep *BatchEventProcessor) handle(events []*Event, trigger string) {
+	tracer := bep.tracer
+	if tracer == nil {
+		tracer = trace.Default()
+	}
+	_, sp := tracer.Start(context.Background(), "batch.process", "batch.size", len(events), "batch.trigger", trigger)
+	defer sp.End()
+
+	bep.processor(events)
+
+	// 归还事件对象到池中
+	for _, e := range events {
+		eventPool.Put(e)
+	}
+}
+
 // EventRouter 智能事件路由器
 type EventRouter struct {
 	routes    map[string][]*IOTDevice // 基于路由键的设备分组
@@ -744,23 +812,35 @@ type BackpressureController struct {
 	lastCheck    time.Time
 	currentRate  float64 // 当前速率
 	adaptiveRate float64 // 自适应速率
+	clk          clock.Clock
 }
 
 func NewBackpressureController(windowSize int, rateLimit int) *BackpressureController {
+	clk := clock.Real()
 	return &BackpressureController{
 		windowSize:   windowSize,
 		window:       make([]time.Time, windowSize),
 		rateLimit:    rateLimit,
-		lastCheck:    time.Now(),
+		lastCheck:    clk.Now(),
 		adaptiveRate: float64(rateLimit),
+		clk:          clk,
 	}
 }
 
+// WithClock 设置滑动窗口使用的时钟
+func (bc *BackpressureController) WithClock(clk clock.Clock) *BackpressureController {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.clk = clock.OrReal(clk)
+	bc.lastCheck = bc.clk.Now()
+	return bc
+}
+
 func (bc *BackpressureController) ShouldAccept() bool {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	now := time.Now()
+	now := bc.clk.Now()
 
 	// 更新滑动窗口
 	bc.window[bc.windowIndex] = now
@@ -820,6 +900,12 @@ func NewAdaptiveEventDispatcher(windowSize, rateLimit int) *AdaptiveEventDispatc
 	}
 }
 
+// WithClock 设置背压控制使用的时钟
+func (aed *AdaptiveEventDispatcher) WithClock(clk clock.Clock) *AdaptiveEventDispatcher {
+	aed.backpressure.WithClock(clk)
+	return aed
+}
+
 func (aed *AdaptiveEventDispatcher) SendEvent(deviceID, eventType string, data interface{}) {
 	// 检查背压控制
 	if !aed.backpressure.ShouldAccept() {
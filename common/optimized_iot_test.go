@@ -1,9 +1,15 @@
 package common
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
+
+	"common/metrics"
+	"common/model/clock"
+	"common/trace"
 )
 
 // 测试优化后的IOT组件架构
@@ -238,6 +244,18 @@ func TestPerformanceMonitor(t *testing.T) {
 	if stats["cpu_usage"] != 25.5 {
 		t.Error("CPU usage not recorded correctly")
 	}
+
+	// 通过metrics暴露
+	reg := metrics.NewRegistry()
+	monitor.WithRegistry(reg).RecordComponentStart(2 * time.Second)
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "component_start_seconds_count 1\n") ||
+		!strings.Contains(buf.String(), "component_start_last_seconds 2\n") {
+		t.Errorf("Component start time not exposed, got %s", buf.String())
+	}
 }
 
 // 基准测试：比较原始组件和优化组件的性能
@@ -538,3 +556,58 @@ func TestBackpressureController(t *testing.T) {
 		t.Errorf("Expected adaptive rate to be reduced when current rate is %f, got %f", currentRate, adaptiveRate)
 	}
 }
+
+func TestBackpressureControllerFakeClock(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	bc := NewBackpressureController(5, 10).WithClock(fc)
+
+	for i := 0; i < 5; i++ {
+		if !bc.ShouldAccept() {
+			t.Fatal("Should accept events at normal rate")
+		}
+		fc.Advance(100 * time.Millisecond)
+	}
+
+	// 窗口过期后速率归零
+	fc.Advance(10 * time.Second)
+	bc.ShouldAccept()
+	if rate := bc.GetCurrentRate(); rate != 0.2 {
+		t.Errorf("Expected current rate 0.2 after the window expired, got %f", rate)
+	}
+}
+
+func TestBatchEventProcessorFakeClock(t *testing.T) {
+	fc := clock.NewFake(time.Time{})
+	exp := trace.NewMemoryExporter()
+	batches := make(chan int, 1)
+	processor := NewBatchEventProcessor(100, func(events []*Event) {
+		batches <- len(events)
+	}).WithClock(fc).WithTracer(trace.NewTracer("gw", exp))
+	processor.Start()
+	defer processor.Stop()
+
+	fc.BlockUntil(1)
+	processor.SendEvent(&Event{DeviceID: "device", Type: "data"})
+
+	// 事件进入通道后推进时钟触发定时批处理
+	for {
+		fc.Advance(10 * time.Millisecond)
+		select {
+		case n := <-batches:
+			if n != 1 {
+				t.Fatalf("Expected batch of 1 event, got %d", n)
+			}
+			// 每批处理记录一个span
+			deadline := time.Now().Add(time.Second)
+			for len(exp.Named("batch.process")) == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			spans := exp.Named("batch.process")
+			if len(spans) != 1 || spans[0].Attrs["batch.size"] != 1 || spans[0].Attrs["batch.trigger"] != "interval" {
+				t.Fatalf("Expected a batch.process span of 1 event on interval, got %+v", spans)
+			}
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -3,7 +3,10 @@ package common
 import (
 	"os"
 	"runtime"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	jsoniter "github.com/json-iterator/go"
 )
 
@@ -16,27 +19,139 @@ func init() {
 }
 
 type OSInfo struct {
-	OsType              string `json:"os_type,omitempty"`
-	OsArch              string `json:"os_arch,omitempty"`
-	OsMaxProcessorCount int    `json:"os_max_processor_count,omitempty"`
-	OsHostname          string `json:"os_hostname,omitempty"`
+	mu        sync.RWMutex // guards the fields
+	root      string       // 读取/proc /etc的根目录 空为"/"
+	diskPaths []string     // 统计磁盘使用的路径
+
+	OsType              string   `json:"os_type,omitempty"`
+	OsArch              string   `json:"os_arch,omitempty"`
+	OsMaxProcessorCount int      `json:"os_max_processor_count,omitempty"`
+	OsHostname          string   `json:"os_hostname,omitempty"`
+	Limits              OSLimits `json:"limits"`
+
+	KernelVersion string         `json:"kernel_version,omitempty"`
+	Distro        OSRelease      `json:"distro"`
+	MachineID     string         `json:"machine_id,omitempty"`
+	BootTime      time.Time      `json:"boot_time,omitempty"`
+	Uptime        time.Duration  `json:"uptime,omitempty"`
+	MemTotal      uint64         `json:"mem_total,omitempty"`     // 总内存 字节
+	MemAvailable  uint64         `json:"mem_available,omitempty"` // 可用内存 字节
+	Disks         []DiskUsage    `json:"disks,omitempty"`
+	Interfaces    []NetInterface `json:"interfaces,omitempty"`
+	Build         BuildInfo      `json:"build"`
+	RefreshedAt   time.Time      `json:"refreshed_at,omitempty"`
+}
+
+// OSLimits are the limits of the cgroup of the process and the runtime values applied from them,
+// zero is unlimited or not detected.
+type OSLimits struct {
+	CgroupVersion int     `json:"cgroup_version,omitempty"`
+	CPUQuota      float64 `json:"cpu_quota,omitempty"`    // cgroup的CPU核数配额
+	MemoryLimit   int64   `json:"memory_limit,omitempty"` // cgroup的内存限制
+	GOMAXPROCS    int     `json:"gomaxprocs,omitempty"`   // 实际的GOMAXPROCS
+	GOMEMLIMIT    int64   `json:"gomemlimit,omitempty"`   // 实际的GOMEMLIMIT 未设置为0
+}
+
+// NewOSInfo returns an empty OSInfo, filled by Refresh.
+func NewOSInfo() *OSInfo {
+	return &OSInfo{}
+}
+
+// WithRoot reads /proc and /etc under root instead of "/", e.g. for a test tree
+// or the host filesystem mounted in a container.
+func (osi *OSInfo) WithRoot(root string) *OSInfo {
+	osi.mu.Lock()
+	defer osi.mu.Unlock()
+	osi.root = root
+	return osi
+}
+
+// WithDiskPaths sets the paths whose filesystem usage is reported in Disks, from the next Refresh.
+func (osi *OSInfo) WithDiskPaths(paths ...string) *OSInfo {
+	osi.mu.Lock()
+	defer osi.mu.Unlock()
+	osi.diskPaths = append([]string(nil), paths...)
+	return osi
 }
 
 func (osi *OSInfo) String() string {
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	osi.mu.RLock()
 	sbuf, _ := json.Marshal(osi)
+	osi.mu.RUnlock()
 	return string(sbuf)
 }
 
+// SetLimits records the limits detected and applied, see the runtime package.
+func (osi *OSInfo) SetLimits(l OSLimits) {
+	osi.mu.Lock()
+	defer osi.mu.Unlock()
+	osi.Limits = l
+	if l.GOMAXPROCS > 0 {
+		osi.OsMaxProcessorCount = l.GOMAXPROCS
+	}
+}
+
+// GetLimits returns the limits recorded by SetLimits.
+func (osi *OSInfo) GetLimits() OSLimits {
+	osi.mu.RLock()
+	defer osi.mu.RUnlock()
+	return osi.Limits
+}
+
+// GetOSInfo refreshes the information ignoring the errors, see Refresh.
 func (osi *OSInfo) GetOSInfo() {
+	_ = osi.Refresh()
+}
+
+// Refresh reads the host information again, the Limits are kept.
+// The parts that can't be read are left zero and their errors returned together.
+func (osi *OSInfo) Refresh() error {
+	osi.mu.RLock()
+	root, diskPaths := osi.root, osi.diskPaths
+	osi.mu.RUnlock()
+
+	// 在锁外读取 读取较慢时不阻塞String
+	h := hostReader{root: root}
+	var errs *multierror.Error
+	kernel, err := h.kernelVersion()
+	errs = multierror.Append(errs, err)
+	distro, err := h.osRelease()
+	errs = multierror.Append(errs, err)
+	machineID, err := h.machineID()
+	errs = multierror.Append(errs, err)
+	boot, err := h.bootTime()
+	errs = multierror.Append(errs, err)
+	uptime, err := h.uptime()
+	errs = multierror.Append(errs, err)
+	memTotal, memAvail, err := h.memInfo()
+	errs = multierror.Append(errs, err)
+	disks, err := diskUsages(diskPaths)
+	errs = multierror.Append(errs, err)
+	ifaces, err := netInterfaces()
+	errs = multierror.Append(errs, err)
+	hostname, herr := os.Hostname()
+	errs = multierror.Append(errs, herr)
+
+	osi.mu.Lock()
+	defer osi.mu.Unlock()
 	//runtime.GOARCH 返回当前的系统架构
 	//runtime.GOOS 返回当前的操作系统
 	osi.OsType = runtime.GOOS
 	osi.OsArch = runtime.GOARCH
 	osi.OsMaxProcessorCount = runtime.GOMAXPROCS(0)
-
-	name, err := os.Hostname()
-	if err == nil {
-		osi.OsHostname = name
+	if herr == nil {
+		osi.OsHostname = hostname
 	}
+	osi.KernelVersion = kernel
+	osi.Distro = distro
+	osi.MachineID = machineID
+	osi.BootTime = boot
+	osi.Uptime = uptime
+	osi.MemTotal, osi.MemAvailable = memTotal, memAvail
+	osi.Disks = disks
+	osi.Interfaces = ifaces
+	osi.Build = readBuildInfo()
+	osi.RefreshedAt = time.Now()
+	return errs.ErrorOrNil()
 }
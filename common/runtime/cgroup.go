@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup"
+	defaultProcCgroup = "/proc/self/cgroup"
+
+	// cgroup v1 reports no memory limit as the largest page aligned int64
+	cgroupV1Unlimited = math.MaxInt64 &^ 4095
+)
+
+var (
+	ErrNoCgroup = errors.New("runtime: cgroup not found")
+)
+
+// Limits are the CPU and memory limits of the cgroup of the process, zero is unlimited.
+type Limits struct {
+	CgroupVersion int `json:"cgroup_version,omitempty"`
+	// CPUQuota is the number of cores the quota allows, e.g. 1.5
+	CPUQuota    float64 `json:"cpu_quota,omitempty"`
+	MemoryLimit int64   `json:"memory_limit,omitempty"`
+	MemoryUsage int64   `json:"memory_usage,omitempty"`
+}
+
+// Cgroup reads the limits of the cgroup of the process, v1 or v2, from the cgroup filesystem.
+type Cgroup struct {
+	root       string
+	procCgroup string
+}
+
+// NewCgroup returns the Cgroup of the process read from /sys/fs/cgroup.
+func NewCgroup() *Cgroup {
+	return &Cgroup{root: defaultCgroupRoot, procCgroup: defaultProcCgroup}
+}
+
+// WithRoot reads the cgroup filesystem mounted at root and the cgroups of the process from procCgroup,
+// e.g. for a test tree.
+func (cg *Cgroup) WithRoot(root, procCgroup string) *Cgroup {
+	cg.root = root
+	cg.procCgroup = procCgroup
+	return cg
+}
+
+// Version returns 2 for the unified hierarchy, 1 for the v1 one and 0 without cgroup.
+func (cg *Cgroup) Version() int {
+	if _, err := os.Stat(filepath.Join(cg.root, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if _, err := os.Stat(filepath.Join(cg.root, "memory")); err == nil {
+		return 1
+	}
+	if _, err := os.Stat(filepath.Join(cg.root, "cpu")); err == nil {
+		return 1
+	}
+	return 0
+}
+
+// Limits reads the limits of the cgroup of the process.
+func (cg *Cgroup) Limits() (Limits, error) {
+	paths, err := cg.paths()
+	if err != nil {
+		return Limits{}, err
+	}
+	switch cg.Version() {
+	case 2:
+		return cg.limitsV2(paths[""]), nil
+	case 1:
+		return cg.limitsV1(paths), nil
+	}
+	return Limits{}, ErrNoCgroup
+}
+
+// paths returns the cgroup path of the process by controller, "" for the unified hierarchy.
+func (cg *Cgroup) paths() (map[string]string, error) {
+	f, err := os.Open(cg.procCgroup)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoCgroup, err)
+	}
+	defer f.Close()
+
+	paths := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if len(parts[1]) == 0 {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, ctrl := range strings.Split(parts[1], ",") {
+			paths[ctrl] = parts[2]
+		}
+	}
+	return paths, sc.Err()
+}
+
+// dir returns the first directory of dirs under the root that exists.
+func (cg *Cgroup) dir(dirs ...string) string {
+	for _, d := range dirs {
+		p := filepath.Join(cg.root, d)
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+func (cg *Cgroup) limitsV2(path string) Limits {
+	l := Limits{CgroupVersion: 2}
+	// in a cgroup namespace the path is "/", the files of the root are the ones of the container
+	dir := cg.dir(path, "/")
+	if len(dir) == 0 {
+		return l
+	}
+	if fields := strings.Fields(readString(filepath.Join(dir, "cpu.max"))); len(fields) == 2 && fields[0] != "max" {
+		quota, qerr := strconv.ParseFloat(fields[0], 64)
+		period, perr := strconv.ParseFloat(fields[1], 64)
+		if qerr == nil && perr == nil && period > 0 {
+			l.CPUQuota = quota / period
+		}
+	}
+	if s := readString(filepath.Join(dir, "memory.max")); s != "max" {
+		l.MemoryLimit, _ = strconv.ParseInt(s, 10, 64)
+	}
+	l.MemoryUsage, _ = strconv.ParseInt(readString(filepath.Join(dir, "memory.current")), 10, 64)
+	return l
+}
+
+func (cg *Cgroup) limitsV1(paths map[string]string) Limits {
+	l := Limits{CgroupVersion: 1}
+	if cpu := cg.dir(filepath.Join("cpu", paths["cpu"]), filepath.Join("cpu,cpuacct", paths["cpu"]), "cpu", "cpu,cpuacct"); len(cpu) > 0 {
+		quota, qerr := strconv.ParseFloat(readString(filepath.Join(cpu, "cpu.cfs_quota_us")), 64)
+		period, perr := strconv.ParseFloat(readString(filepath.Join(cpu, "cpu.cfs_period_us")), 64)
+		if qerr == nil && perr == nil && quota > 0 && period > 0 {
+			l.CPUQuota = quota / period
+		}
+	}
+	if mem := cg.dir(filepath.Join("memory", paths["memory"]), "memory"); len(mem) > 0 {
+		if n, err := strconv.ParseInt(readString(filepath.Join(mem, "memory.limit_in_bytes")), 10, 64); err == nil && n < cgroupV1Unlimited {
+			l.MemoryLimit = n
+		}
+		l.MemoryUsage, _ = strconv.ParseInt(readString(filepath.Join(mem, "memory.usage_in_bytes")), 10, 64)
+	}
+	return l
+}
+
+// readString returns the trimmed content of the file at path, empty if it can't be read.
+func readString(path string) string {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bs))
+}
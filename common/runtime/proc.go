@@ -0,0 +1,74 @@
+package runtime
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultProcSelf = "/proc/self"
+)
+
+// ProcStats are the resources of the process read from /proc, zero where /proc is not available.
+type ProcStats struct {
+	RSS    int64 `json:"rss,omitempty"`
+	FDs    int   `json:"fds,omitempty"`
+	MaxFDs int64 `json:"max_fds,omitempty"`
+}
+
+// Proc reads the resources of a process from its /proc directory.
+type Proc struct {
+	dir string
+}
+
+// NewProc returns the Proc of the process itself.
+func NewProc() *Proc {
+	return &Proc{dir: defaultProcSelf}
+}
+
+// WithDir reads from the /proc directory dir, e.g. /proc/1 or a test tree.
+func (p *Proc) WithDir(dir string) *Proc {
+	p.dir = dir
+	return p
+}
+
+// Stats reads the resident set size, the open file descriptors and their soft limit.
+func (p *Proc) Stats() ProcStats {
+	var ps ProcStats
+	if f, err := os.Open(filepath.Join(p.dir, "status")); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			// VmRSS:	   12345 kB
+			if v, ok := strings.CutPrefix(sc.Text(), "VmRSS:"); ok {
+				if fields := strings.Fields(v); len(fields) > 0 {
+					kb, _ := strconv.ParseInt(fields[0], 10, 64)
+					ps.RSS = kb * 1024
+				}
+				break
+			}
+		}
+		f.Close()
+	}
+
+	if entries, err := os.ReadDir(filepath.Join(p.dir, "fd")); err == nil {
+		ps.FDs = len(entries)
+	}
+
+	if f, err := os.Open(filepath.Join(p.dir, "limits")); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			// Max open files            1024                 4096                 files
+			if v, ok := strings.CutPrefix(sc.Text(), "Max open files"); ok {
+				if fields := strings.Fields(v); len(fields) > 0 {
+					ps.MaxFDs, _ = strconv.ParseInt(fields[0], 10, 64)
+				}
+				break
+			}
+		}
+		f.Close()
+	}
+	return ps
+}
@@ -1 +1,256 @@
+// Package runtime introspects the process: the Go runtime metrics, the cgroup limits
+// and the resources of /proc, collected periodically by a component.
 package runtime
+
+import (
+	"context"
+	"math"
+	goruntime "runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	mdl "common/model"
+	"common/model/clock"
+	cmpt "common/model/component"
+	evc "common/model/eventchans"
+)
+
+const (
+	// Topic is the EvtChans topic the Collector publishes its Stats on
+	Topic = "runtime.stats"
+
+	defaultInterval = 10 * time.Second
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ cmpt.Cpt          = (*Collector)(nil)
+	_ mdl.WorkerRecover = (*Collector)(nil)
+)
+
+// the runtime/metrics read by the Collector, the unsupported ones are left zero
+const (
+	mGoroutines   = "/sched/goroutines:goroutines"
+	mHeapAlloc    = "/memory/classes/heap/objects:bytes"
+	mHeapObjects  = "/gc/heap/objects:objects"
+	mHeapGoal     = "/gc/heap/goal:bytes"
+	mTotalMemory  = "/memory/classes/total:bytes"
+	mMemoryLimit  = "/gc/gomemlimit:bytes"
+	mGCCycles     = "/gc/cycles/total:gc-cycles"
+	mGCCPU        = "/cpu/classes/gc/total:cpu-seconds"
+	mGCPauses     = "/sched/pauses/total/gc:seconds"
+	mGCPausesPre  = "/gc/pauses:seconds" // before go1.22
+	mAllocBytes   = "/gc/heap/allocs:bytes"
+	mAllocObjects = "/gc/heap/allocs:objects"
+)
+
+// Stats is a snapshot of the resources of the process.
+type Stats struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	GOMAXPROCS int       `json:"gomaxprocs"`
+	NumCPU     int       `json:"num_cpu"`
+
+	HeapAlloc    uint64 `json:"heap_alloc"`   // 堆上存活和未回收对象的字节数
+	HeapObjects  uint64 `json:"heap_objects"` // 堆上的对象数
+	HeapGoal     uint64 `json:"heap_goal"`    // 下次GC的堆大小目标
+	TotalMemory  uint64 `json:"total_memory"` // 运行时向操作系统申请的内存
+	MemoryLimit  int64  `json:"memory_limit"` // GOMEMLIMIT
+	AllocBytes   uint64 `json:"alloc_bytes"`  // 累计分配的字节数
+	AllocObjects uint64 `json:"alloc_objects"`
+
+	GCCycles     uint64        `json:"gc_cycles"`
+	GCCPUSeconds float64       `json:"gc_cpu_seconds"`
+	GCPauseP99   time.Duration `json:"gc_pause_p99"`
+	GCPauseMax   time.Duration `json:"gc_pause_max"`
+
+	Limits Limits    `json:"limits"`
+	Proc   ProcStats `json:"proc"`
+}
+
+func (s Stats) String() string {
+	bs, _ := mdl.Json.MarshalToString(s)
+	return bs
+}
+
+// Collector is the component collecting the Stats every interval and publishing them on Topic.
+type Collector struct {
+	*cmpt.CptMetaSt
+	interval time.Duration
+	evts     *evc.EvtChans
+	cg       *Cgroup
+	proc     *Proc
+	clk      clock.Clock
+
+	mu      *sync.Mutex // guards samples last
+	samples []metrics.Sample
+	last    Stats
+}
+
+// NewCollector returns the Collector publishing on evts every interval, evts may be nil,
+// the default interval is 10s. Accepted type of v as NewCptMetaSt, e.g. *mdl.CtrlSt.
+func NewCollector(interval time.Duration, evts *evc.EvtChans, v ...any) *Collector {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	c := &Collector{
+		interval: interval,
+		evts:     evts,
+		cg:       NewCgroup(),
+		proc:     NewProc(),
+		clk:      clock.Real(),
+		mu:       &sync.Mutex{},
+	}
+	for _, name := range []string{mGoroutines, mHeapAlloc, mHeapObjects, mHeapGoal, mTotalMemory, mMemoryLimit,
+		mGCCycles, mGCCPU, mGCPauses, mGCPausesPre, mAllocBytes, mAllocObjects} {
+		c.samples = append(c.samples, metrics.Sample{Name: name})
+	}
+	v = append([]any{cmpt.KindName("runtime"), cmpt.IdName("collector")}, v...)
+	c.CptMetaSt = cmpt.NewCptMetaSt(append(v, mdl.WorkerRecover(c))...)
+	return c
+}
+
+// WithClock makes the Collector tick and timestamp on clk.
+func (c *Collector) WithClock(clk clock.Clock) *Collector {
+	c.clk = clock.OrReal(clk)
+	return c
+}
+
+// WithCgroup reads the limits from cg.
+func (c *Collector) WithCgroup(cg *Cgroup) *Collector {
+	c.cg = cg
+	return c
+}
+
+// WithProc reads the resources of the process from p.
+func (c *Collector) WithProc(p *Proc) *Collector {
+	c.proc = p
+	return c
+}
+
+// Latest returns the last Stats collected, zero before the first.
+func (c *Collector) Latest() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Collect takes a snapshot of the Stats.
+func (c *Collector) Collect() Stats {
+	s := Stats{
+		Time:       c.clk.Now(),
+		GOMAXPROCS: goruntime.GOMAXPROCS(0),
+		NumCPU:     goruntime.NumCPU(),
+	}
+	s.Limits, _ = c.cg.Limits()
+	s.Proc = c.proc.Stats()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metrics.Read(c.samples)
+	for _, sm := range c.samples {
+		switch sm.Name {
+		case mGoroutines:
+			s.Goroutines = int(uint64Of(sm))
+		case mHeapAlloc:
+			s.HeapAlloc = uint64Of(sm)
+		case mHeapObjects:
+			s.HeapObjects = uint64Of(sm)
+		case mHeapGoal:
+			s.HeapGoal = uint64Of(sm)
+		case mTotalMemory:
+			s.TotalMemory = uint64Of(sm)
+		case mMemoryLimit:
+			s.MemoryLimit = int64(uint64Of(sm))
+		case mAllocBytes:
+			s.AllocBytes = uint64Of(sm)
+		case mAllocObjects:
+			s.AllocObjects = uint64Of(sm)
+		case mGCCycles:
+			s.GCCycles = uint64Of(sm)
+		case mGCCPU:
+			if sm.Value.Kind() == metrics.KindFloat64 {
+				s.GCCPUSeconds = sm.Value.Float64()
+			}
+		case mGCPauses, mGCPausesPre:
+			if sm.Value.Kind() == metrics.KindFloat64Histogram && s.GCPauseMax == 0 {
+				s.GCPauseP99, s.GCPauseMax = pauses(sm.Value.Float64Histogram())
+			}
+		}
+	}
+	c.last = s
+	return s
+}
+
+func uint64Of(sm metrics.Sample) uint64 {
+	if sm.Value.Kind() == metrics.KindUint64 {
+		return sm.Value.Uint64()
+	}
+	return 0
+}
+
+// pauses returns the 99th percentile and the maximum of the pause histogram,
+// as the upper bounds of their buckets.
+func pauses(h *metrics.Float64Histogram) (p99, max time.Duration) {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	bound := func(i int) time.Duration {
+		b := h.Buckets[i+1]
+		if math.IsInf(b, 1) {
+			b = h.Buckets[i]
+		}
+		return time.Duration(b * float64(time.Second))
+	}
+	target := uint64(math.Ceil(float64(total) * 0.99))
+	var acc uint64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		acc += n
+		if p99 == 0 && acc >= target {
+			p99 = bound(i)
+		}
+		max = bound(i)
+	}
+	return p99, max
+}
+
+// Work collects and publishes the Stats every interval until the Collector is stopped.
+func (c *Collector) Work() error {
+	ctx := c.Ctrl().Context()
+	tk := c.clk.NewTicker(c.interval)
+	defer tk.Stop()
+	c.collect(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tk.C:
+			c.collect(ctx)
+		}
+	}
+}
+
+// collect is an iteration of Work, traced as the span runtime.collect.
+func (c *Collector) collect(ctx context.Context) {
+	_, sp := c.StartSpan("runtime.collect")
+	defer sp.End()
+	c.publish(ctx, c.Collect())
+}
+
+func (c *Collector) publish(ctx context.Context, s Stats) {
+	if c.evts == nil || c.evts.HasChansLen(Topic) <= 0 {
+		return
+	}
+	// a slow subscriber misses the snapshot rather than delaying the next one
+	if err := c.evts.PublishAsync(ctx, c.interval, Topic, s); err != nil && ctx.Err() == nil {
+		c.Log().Warn("runtime stats not delivered", "err", err)
+	}
+}
@@ -1 +1,187 @@
 package runtime_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"common"
+	"common/model/clock"
+	evc "common/model/eventchans"
+	rt "common/runtime"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree writes the files of tree under a temporary directory and returns it.
+func writeTree(t *testing.T, tree map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range tree {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return root
+}
+
+func TestCgroupV2(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"proc/cgroup":                            "0::/app.slice/gw.service\n",
+		"fs/cgroup.controllers":                  "cpu memory\n",
+		"fs/app.slice/gw.service/cpu.max":        "150000 100000\n",
+		"fs/app.slice/gw.service/memory.max":     "536870912\n",
+		"fs/app.slice/gw.service/memory.current": "1048576\n",
+	})
+	cg := rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup"))
+	l, err := cg.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, rt.Limits{CgroupVersion: 2, CPUQuota: 1.5, MemoryLimit: 512 << 20, MemoryUsage: 1 << 20}, l)
+
+	// unlimited, in a cgroup namespace
+	root = writeTree(t, map[string]string{
+		"proc/cgroup":           "0::/\n",
+		"fs/cgroup.controllers": "cpu memory\n",
+		"fs/cpu.max":            "max 100000\n",
+		"fs/memory.max":         "max\n",
+	})
+	l, err = rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup")).Limits()
+	require.NoError(t, err)
+	assert.Equal(t, rt.Limits{CgroupVersion: 2}, l)
+}
+
+func TestCgroupV1(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"proc/cgroup": "4:memory:/docker/abc\n2:cpu,cpuacct:/docker/abc\n",
+		"fs/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  "50000\n",
+		"fs/cpu,cpuacct/docker/abc/cpu.cfs_period_us": "100000\n",
+		"fs/memory/docker/abc/memory.limit_in_bytes":  "268435456\n",
+		"fs/memory/docker/abc/memory.usage_in_bytes":  "4096\n",
+	})
+	l, err := rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup")).Limits()
+	require.NoError(t, err)
+	assert.Equal(t, rt.Limits{CgroupVersion: 1, CPUQuota: 0.5, MemoryLimit: 256 << 20, MemoryUsage: 4096}, l)
+
+	root = writeTree(t, map[string]string{
+		"proc/cgroup":                     "4:memory:/\n2:cpu:/\n",
+		"fs/cpu/cpu.cfs_quota_us":         "-1\n",
+		"fs/cpu/cpu.cfs_period_us":        "100000\n",
+		"fs/memory/memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	l, err = rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup")).Limits()
+	require.NoError(t, err)
+	assert.Equal(t, rt.Limits{CgroupVersion: 1}, l)
+
+	_, err = rt.NewCgroup().WithRoot(t.TempDir(), filepath.Join(root, "missing")).Limits()
+	assert.ErrorIs(t, err, rt.ErrNoCgroup)
+}
+
+func TestProc(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"status": "Name:\tgw\nVmPeak:\t  9000 kB\nVmRSS:\t    2048 kB\n",
+		"limits": "Limit                     Soft Limit           Hard Limit           Units\nMax open files            1024                 4096                 files\n",
+		"fd/0":   "",
+		"fd/1":   "",
+		"fd/2":   "",
+	})
+	assert.Equal(t, rt.ProcStats{RSS: 2 << 20, FDs: 3, MaxFDs: 1024}, rt.NewProc().WithDir(root).Stats())
+}
+
+func TestCollector(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"proc/cgroup":           "0::/\n",
+		"fs/cgroup.controllers": "",
+		"fs/cpu.max":            "200000 100000\n",
+		"fs/memory.max":         "1073741824\n",
+		"self/status":           "VmRSS:\t1024 kB\n",
+	})
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	evts := evc.NewEvtChans(10)
+	ch := evts.Subscribe(rt.Topic)
+	c := rt.NewCollector(time.Second, evts).
+		WithClock(clk).
+		WithCgroup(rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup"))).
+		WithProc(rt.NewProc().WithDir(filepath.Join(root, "self")))
+	require.NoError(t, c.Start())
+
+	recv := func() rt.Stats {
+		select {
+		case msg := <-ch:
+			return msg.(rt.Stats)
+		case <-time.After(time.Second):
+			t.Fatal("no stats published")
+		}
+		return rt.Stats{}
+	}
+	s := recv()
+	assert.Equal(t, clk.Now(), s.Time)
+	assert.Positive(t, s.Goroutines)
+	assert.Positive(t, s.GOMAXPROCS)
+	assert.Positive(t, s.HeapAlloc)
+	assert.Positive(t, s.TotalMemory)
+	assert.Equal(t, 2.0, s.Limits.CPUQuota)
+	assert.Equal(t, int64(1<<30), s.Limits.MemoryLimit)
+	assert.Equal(t, int64(1<<20), s.Proc.RSS)
+	assert.Contains(t, s.String(), `"cpu_quota":2`)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	s = recv()
+	assert.Equal(t, clk.Now(), s.Time)
+	assert.Equal(t, s, c.Latest())
+
+	require.NoError(t, c.Stop())
+	require.NoError(t, c.Finalize())
+}
+
+func TestTune(t *testing.T) {
+	prevProcs := goruntime.GOMAXPROCS(goruntime.NumCPU() + 1)
+	prevLimit := debug.SetMemoryLimit(math.MaxInt64)
+	defer func() {
+		goruntime.GOMAXPROCS(prevProcs)
+		debug.SetMemoryLimit(prevLimit)
+		common.GOsInfo.SetLimits(common.OSLimits{})
+	}()
+
+	root := writeTree(t, map[string]string{
+		"proc/cgroup":           "0::/\n",
+		"fs/cgroup.controllers": "",
+		"fs/cpu.max":            "150000 100000\n",
+		"fs/memory.max":         "1000000000\n",
+	})
+	cg := rt.NewCgroup().WithRoot(filepath.Join(root, "fs"), filepath.Join(root, "proc/cgroup"))
+
+	// opted out, only the limits are reported
+	tn, err := rt.Tune(cg, rt.TuneConf{Disable: true})
+	require.NoError(t, err)
+	assert.False(t, tn.MaxProcsApplied || tn.MemLimitApplied)
+	assert.Equal(t, goruntime.NumCPU()+1, goruntime.GOMAXPROCS(0))
+	assert.Equal(t, common.OSLimits{CgroupVersion: 2, CPUQuota: 1.5, MemoryLimit: 1e9, GOMAXPROCS: goruntime.NumCPU() + 1},
+		common.GOsInfo.GetLimits())
+
+	// kept when set by the environment
+	t.Setenv("GOMEMLIMIT", "off")
+	tn, err = rt.Tune(cg, rt.TuneConf{})
+	require.NoError(t, err)
+	assert.True(t, tn.MaxProcsApplied)
+	assert.False(t, tn.MemLimitApplied)
+	assert.Equal(t, int64(math.MaxInt64), debug.SetMemoryLimit(-1))
+
+	os.Unsetenv("GOMEMLIMIT")
+	tn, err = rt.Tune(cg, rt.TuneConf{MemoryLimitRatio: 0.5})
+	require.NoError(t, err)
+	assert.Equal(t, 1, goruntime.GOMAXPROCS(0))
+	assert.True(t, tn.MemLimitApplied)
+	assert.Equal(t, int64(5e8), debug.SetMemoryLimit(-1))
+	assert.Equal(t, common.OSLimits{CgroupVersion: 2, CPUQuota: 1.5, MemoryLimit: 1e9, GOMAXPROCS: 1, GOMEMLIMIT: 5e8},
+		common.GOsInfo.GetLimits())
+	assert.Contains(t, common.GOsInfo.String(), `"limits":{"cgroup_version":2,"cpu_quota":1.5,"memory_limit":1000000000,"gomaxprocs":1,"gomemlimit":500000000}`)
+
+	_, err = rt.Tune(cg, rt.TuneConf{MemoryLimitRatio: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package runtime
+
+import (
+	"errors"
+	"math"
+	"os"
+	goruntime "runtime"
+	"runtime/debug"
+
+	"common"
+	mdl "common/model"
+)
+
+const (
+	defaultMemoryLimitRatio = 0.9
+)
+
+// TuneConf configures Tune.
+type TuneConf struct {
+	// 不根据cgroup调整GOMAXPROCS和GOMEMLIMIT 只记录检测到的限制
+	Disable bool `mapstructure:"disable" json:"disable" yaml:"disable" desc:"keep GOMAXPROCS and GOMEMLIMIT, only report the cgroup limits"`
+	// GOMEMLIMIT为cgroup内存限制的比例 为栈和非Go内存留出余量
+	MemoryLimitRatio float64 `mapstructure:"memory-limit-ratio" json:"memory-limit-ratio" yaml:"memory-limit-ratio" default:"0.9" validate:"gt=0,max=1" desc:"GOMEMLIMIT as a ratio of the cgroup memory limit"`
+}
+
+func (tc *TuneConf) Validate() error {
+	if tc.MemoryLimitRatio < 0 || tc.MemoryLimitRatio > 1 {
+		return errors.New("runtime: memory-limit-ratio must be in (0, 1]")
+	}
+	return nil
+}
+
+// Tuning is the outcome of Tune: the limits detected and the runtime values after it.
+type Tuning struct {
+	Limits     Limits
+	GOMAXPROCS int
+	// GOMEMLIMIT is math.MaxInt64 when there is none
+	GOMEMLIMIT      int64
+	MaxProcsApplied bool
+	MemLimitApplied bool
+}
+
+// Tune sets GOMAXPROCS to the CPU quota of the cgroup, rounded down and at least 1, and GOMEMLIMIT
+// to MemoryLimitRatio of its memory limit. The values set by the environment variables GOMAXPROCS
+// and GOMEMLIMIT are kept, as they are with Disable. The decisions are logged and the limits
+// recorded in common.GOsInfo. A nil cg reads the cgroup of the process.
+func Tune(cg *Cgroup, conf TuneConf) (tn Tuning, err error) {
+	if cg == nil {
+		cg = NewCgroup()
+	}
+	if conf.MemoryLimitRatio == 0 {
+		conf.MemoryLimitRatio = defaultMemoryLimitRatio
+	}
+	if err = conf.Validate(); err != nil {
+		return tn, err
+	}
+
+	tn.GOMAXPROCS = goruntime.GOMAXPROCS(0)
+	tn.GOMEMLIMIT = debug.SetMemoryLimit(-1)
+	defer func() {
+		l := common.OSLimits{
+			CgroupVersion: tn.Limits.CgroupVersion,
+			CPUQuota:      tn.Limits.CPUQuota,
+			MemoryLimit:   tn.Limits.MemoryLimit,
+			GOMAXPROCS:    tn.GOMAXPROCS,
+		}
+		if tn.GOMEMLIMIT != math.MaxInt64 {
+			l.GOMEMLIMIT = tn.GOMEMLIMIT
+		}
+		common.GOsInfo.SetLimits(l)
+	}()
+
+	tn.Limits, err = cg.Limits()
+	if err != nil {
+		if errors.Is(err, ErrNoCgroup) {
+			mdl.Log().Info("runtime tuning skipped, no cgroup", "err", err)
+			return tn, nil
+		}
+		return tn, err
+	}
+	if conf.Disable {
+		mdl.Log().Info("runtime tuning disabled", "cpu_quota", tn.Limits.CPUQuota, "memory_limit", tn.Limits.MemoryLimit,
+			"gomaxprocs", tn.GOMAXPROCS)
+		return tn, nil
+	}
+
+	tn.tuneMaxProcs()
+	tn.tuneMemLimit(conf.MemoryLimitRatio)
+	return tn, nil
+}
+
+func (tn *Tuning) tuneMaxProcs() {
+	if env, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		mdl.Log().Info("GOMAXPROCS kept, set by the environment", "GOMAXPROCS", env, "cpu_quota", tn.Limits.CPUQuota)
+		return
+	}
+	if tn.Limits.CPUQuota <= 0 {
+		mdl.Log().Info("GOMAXPROCS kept, no cpu quota", "gomaxprocs", tn.GOMAXPROCS)
+		return
+	}
+	procs := int(math.Floor(tn.Limits.CPUQuota))
+	procs = max(1, min(procs, goruntime.NumCPU()))
+	if procs == tn.GOMAXPROCS {
+		mdl.Log().Info("GOMAXPROCS kept, it matches the cpu quota", "gomaxprocs", procs, "cpu_quota", tn.Limits.CPUQuota)
+		return
+	}
+	prev := goruntime.GOMAXPROCS(procs)
+	tn.GOMAXPROCS = procs
+	tn.MaxProcsApplied = true
+	mdl.Log().Info("GOMAXPROCS set from the cpu quota", "gomaxprocs", procs, "previous", prev, "cpu_quota", tn.Limits.CPUQuota)
+}
+
+func (tn *Tuning) tuneMemLimit(ratio float64) {
+	if env, ok := os.LookupEnv("GOMEMLIMIT"); ok {
+		mdl.Log().Info("GOMEMLIMIT kept, set by the environment", "GOMEMLIMIT", env, "memory_limit", tn.Limits.MemoryLimit)
+		return
+	}
+	if tn.Limits.MemoryLimit <= 0 {
+		mdl.Log().Info("GOMEMLIMIT kept, no memory limit")
+		return
+	}
+	limit := int64(float64(tn.Limits.MemoryLimit) * ratio)
+	prev := debug.SetMemoryLimit(limit)
+	tn.GOMEMLIMIT = limit
+	tn.MemLimitApplied = true
+	mdl.Log().Info("GOMEMLIMIT set from the memory limit", "gomemlimit", limit, "previous", prev,
+		"memory_limit", tn.Limits.MemoryLimit, "ratio", ratio)
+}
@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mdl "common/model"
+)
+
+const (
+	defaultQueueSize     = 2048
+	defaultBatchSize     = 512
+	defaultBatchInterval = 5 * time.Second
+)
+
+var (
+	//Verify Satisfies interfaces
+	_ Exporter = (*BatchExporter)(nil)
+)
+
+// BatchConf sizes the queue of a BatchExporter, the zero values are the defaults.
+type BatchConf struct {
+	// 队列中最多的span数 满了之后丢弃新的span 默认2048
+	QueueSize int
+	// 每次导出的最多span数 队列达到时立即导出 默认512
+	BatchSize int
+	// 定期导出的间隔 默认5s
+	Interval time.Duration
+}
+
+// BatchExporter queues the spans ended and exports them in batches to the wrapped Exporter
+// from its own goroutine, every interval or as soon as a batch is full, so that ending a span
+// doesn't encode nor write it. The spans are dropped when the queue is full.
+type BatchExporter struct {
+	exp       Exporter
+	batchSize int
+	queueSize int
+	interval  time.Duration
+
+	mu     *sync.Mutex // guards queue closed
+	queue  []SpanData
+	closed bool
+
+	emu       *sync.Mutex // serializes the exports to exp
+	errLogged bool
+	dropped   atomic.Uint64
+
+	wake chan struct{}
+	done chan struct{}
+	wg   *sync.WaitGroup
+}
+
+// NewBatchExporter starts the BatchExporter of exp.
+func NewBatchExporter(exp Exporter, conf BatchConf) *BatchExporter {
+	be := &BatchExporter{
+		exp:       exp,
+		batchSize: conf.BatchSize,
+		queueSize: conf.QueueSize,
+		interval:  conf.Interval,
+		mu:        &sync.Mutex{},
+		emu:       &sync.Mutex{},
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		wg:        &sync.WaitGroup{},
+	}
+	if be.queueSize <= 0 {
+		be.queueSize = defaultQueueSize
+	}
+	if be.batchSize <= 0 {
+		be.batchSize = defaultBatchSize
+	}
+	be.batchSize = min(be.batchSize, be.queueSize)
+	if be.interval <= 0 {
+		be.interval = defaultBatchInterval
+	}
+	be.wg.Add(1)
+	go be.loop()
+	return be
+}
+
+// Export queues the spans, those not fitting in the queue are dropped.
+func (be *BatchExporter) Export(spans []SpanData) error {
+	be.mu.Lock()
+	if be.closed {
+		be.mu.Unlock()
+		return ErrExporterShutdown
+	}
+	n := min(len(spans), be.queueSize-len(be.queue))
+	be.queue = append(be.queue, spans[:n]...)
+	full := len(be.queue) >= be.batchSize
+	be.mu.Unlock()
+
+	if n < len(spans) {
+		be.dropped.Add(uint64(len(spans) - n))
+	}
+	if full {
+		select {
+		case be.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of spans dropped since the BatchExporter was created.
+func (be *BatchExporter) Dropped() uint64 {
+	return be.dropped.Load()
+}
+
+// Flush exports the spans queued.
+func (be *BatchExporter) Flush() error {
+	be.emu.Lock()
+	defer be.emu.Unlock()
+	return be.flush()
+}
+
+// Shutdown stops the goroutine, exports the spans queued and shuts the wrapped Exporter down.
+func (be *BatchExporter) Shutdown() error {
+	be.mu.Lock()
+	if be.closed {
+		be.mu.Unlock()
+		return nil
+	}
+	be.closed = true
+	be.mu.Unlock()
+
+	close(be.done)
+	be.wg.Wait()
+	ferr := be.Flush()
+	if err := be.exp.Shutdown(); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func (be *BatchExporter) loop() {
+	defer be.wg.Done()
+	tk := time.NewTicker(be.interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-be.done:
+			return
+		case <-tk.C:
+		case <-be.wake:
+		}
+		be.emu.Lock()
+		if err := be.flush(); err != nil && !be.errLogged {
+			// 只记录第一次导出失败
+			be.errLogged = true
+			mdl.Log().Warn("trace export failed", "err", err)
+		}
+		be.emu.Unlock()
+	}
+}
+
+// flush exports the queue in batches of batchSize. must hold be.emu
+func (be *BatchExporter) flush() error {
+	be.mu.Lock()
+	spans := be.queue
+	be.queue = nil
+	be.mu.Unlock()
+
+	var err error
+	for len(spans) > 0 {
+		n := min(len(spans), be.batchSize)
+		if eerr := be.exp.Export(spans[:n]); eerr != nil && err == nil {
+			err = eerr
+		}
+		spans = spans[n:]
+	}
+	return err
+}
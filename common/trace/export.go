@@ -0,0 +1,254 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	mdl "common/model"
+)
+
+const (
+	// the instrumentation scope of the spans in OTLP
+	scopeName = "common"
+)
+
+var (
+	ErrExporterShutdown = errors.New("trace: exporter shut down")
+
+	//Verify Satisfies interfaces
+	_ Exporter = (*MemoryExporter)(nil)
+	_ Exporter = (*FileExporter)(nil)
+	_ Exporter = (*fileWriter)(nil)
+)
+
+// MemoryExporter keeps the spans in memory, for the tests.
+type MemoryExporter struct {
+	mu    *sync.Mutex // guards spans
+	spans []SpanData
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{mu: &sync.Mutex{}}
+}
+
+func (me *MemoryExporter) Export(spans []SpanData) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+func (me *MemoryExporter) Shutdown() error {
+	return nil
+}
+
+// Spans returns the spans exported, in the order they ended.
+func (me *MemoryExporter) Spans() []SpanData {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return slices.Clone(me.spans)
+}
+
+// Named returns the spans exported named name.
+func (me *MemoryExporter) Named(name string) []SpanData {
+	var sds []SpanData
+	for _, sd := range me.Spans() {
+		if sd.Name == name {
+			sds = append(sds, sd)
+		}
+	}
+	return sds
+}
+
+// Reset drops the spans exported.
+func (me *MemoryExporter) Reset() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.spans = nil
+}
+
+// FileExporter appends the spans to a file in the OTLP/JSON file format, a line per batch
+// holding an ExportTraceServiceRequest, as read by the file receiver of the OpenTelemetry collector.
+// The spans are batched by a BatchExporter, Export doesn't write the file.
+type FileExporter struct {
+	*BatchExporter
+}
+
+// NewFileExporter opens path for appending, creating it and its directory if needed,
+// and writes the spans in batches of conf.
+func NewFileExporter(path string, conf ...BatchConf) (*FileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	var bc BatchConf
+	if len(conf) > 0 {
+		bc = conf[0]
+	}
+	return &FileExporter{BatchExporter: NewBatchExporter(&fileWriter{mu: &sync.Mutex{}, f: f}, bc)}, nil
+}
+
+// fileWriter writes a line per export to f.
+type fileWriter struct {
+	mu *sync.Mutex // guards f
+	f  *os.File
+}
+
+func (fe *fileWriter) Export(spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	bs, err := mdl.Json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.f == nil {
+		return ErrExporterShutdown
+	}
+	_, err = fe.f.Write(append(bs, '\n'))
+	return err
+}
+
+// Shutdown syncs and closes the file.
+func (fe *fileWriter) Shutdown() error {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.f == nil {
+		return nil
+	}
+	err := errors.Join(fe.f.Sync(), fe.f.Close())
+	fe.f = nil
+	return err
+}
+
+// the OTLP/JSON messages, the ids are hex and the 64 bits integers strings
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpRequest groups the spans by service, the resource of OTLP.
+func otlpRequest(spans []SpanData) otlpTraces {
+	var req otlpTraces
+	byService := make(map[string]int)
+	for _, sd := range spans {
+		i, ok := byService[sd.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			byService[sd.Service] = i
+			var attrs []otlpKeyValue
+			if len(sd.Service) > 0 {
+				attrs = append(attrs, otlpAttr("service.name", sd.Service))
+			}
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: attrs},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}}},
+			})
+		}
+		ss := &req.ResourceSpans[i].ScopeSpans[0]
+		ss.Spans = append(ss.Spans, otlpSpanOf(sd))
+	}
+	return req
+}
+
+func otlpSpanOf(sd SpanData) otlpSpan {
+	sp := otlpSpan{
+		TraceID:           sd.TraceID,
+		SpanID:            sd.SpanID,
+		ParentSpanID:      sd.ParentSpanID,
+		Name:              sd.Name,
+		Kind:              sd.Kind,
+		StartTimeUnixNano: strconv.FormatInt(sd.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(sd.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: sd.Status, Message: sd.StatusMsg},
+	}
+	keys := make([]string, 0, len(sd.Attrs))
+	for k := range sd.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sp.Attributes = append(sp.Attributes, otlpAttr(k, sd.Attrs[k]))
+	}
+	return sp
+}
+
+func otlpAttr(key string, v any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch x := v.(type) {
+	case string:
+		kv.Value.StringValue = &x
+	case bool:
+		kv.Value.BoolValue = &x
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		s := fmt.Sprint(x)
+		kv.Value.IntValue = &s
+	case float32:
+		f := float64(x)
+		kv.Value.DoubleValue = &f
+	case float64:
+		kv.Value.DoubleValue = &x
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
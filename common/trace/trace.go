@@ -0,0 +1,264 @@
+// Package trace records spans of the work of the components and exports them, in memory for
+// the tests or as OTLP/JSON to a file. The trace and span ids are the ones of mdl.Trace,
+// carried by the context so that the logs of a span have its ids.
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	mdl "common/model"
+	"common/model/clock"
+)
+
+// Kind is the role of a span, as the SpanKind of OpenTelemetry.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+	KindProducer Kind = 4
+	KindConsumer Kind = 5
+)
+
+// StatusCode is the status of a span, as the StatusCode of OpenTelemetry.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+var (
+	dtmu          = &sync.RWMutex{} // guards defaultTracer
+	defaultTracer = NewTracer("", nil)
+)
+
+// SpanData is a span ended, as exported.
+type SpanData struct {
+	Service      string         `json:"service,omitempty"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Kind         Kind           `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attrs        map[string]any `json:"attrs,omitempty"`
+	Status       StatusCode     `json:"status,omitempty"`
+	StatusMsg    string         `json:"status_msg,omitempty"`
+}
+
+// Duration returns the time between the start and the end of the span.
+func (sd SpanData) Duration() time.Duration {
+	return sd.End.Sub(sd.Start)
+}
+
+// Exporter exports the spans ended.
+type Exporter interface {
+	Export(spans []SpanData) error
+	// Shutdown flushes and releases the exporter, Export isn't called afterwards
+	Shutdown() error
+}
+
+// Tracer starts spans and exports them when they end, it records nothing without an Exporter.
+type Tracer struct {
+	service string
+	exp     Exporter
+	clk     clock.Clock
+
+	mu        *sync.Mutex // guards errLogged
+	errLogged bool
+}
+
+// NewTracer returns the Tracer of service exporting to exp, exp nil disables the tracing.
+func NewTracer(service string, exp Exporter) *Tracer {
+	return &Tracer{service: service, exp: exp, clk: clock.Real(), mu: &sync.Mutex{}}
+}
+
+// WithClock timestamps the spans on clk.
+func (t *Tracer) WithClock(clk clock.Clock) *Tracer {
+	t.clk = clock.OrReal(clk)
+	return t
+}
+
+// Enabled reports whether the spans are recorded.
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.exp != nil
+}
+
+// Start starts the span name, the child of the span carried by ctx if any, with the attributes
+// given as key, value pairs. The returned context carries the span, the logs of the components
+// through it have its ids. A disabled Tracer returns ctx and a span recording nothing.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sd := SpanData{
+		Service: t.service,
+		SpanID:  mdl.NewSpanID(),
+		Name:    name,
+		Kind:    KindInternal,
+		Start:   t.clk.Now(),
+	}
+	if parent, ok := mdl.TraceFromContext(ctx); ok && len(parent.TraceID) > 0 {
+		sd.TraceID = parent.TraceID
+		sd.ParentSpanID = parent.SpanID
+	} else {
+		sd.TraceID = mdl.NewTraceID()
+	}
+	sp := &Span{t: t, mu: &sync.Mutex{}, data: sd}
+	sp.SetAttrs(attrs...)
+	return mdl.ContextWithTrace(ctx, sd.TraceID, sd.SpanID), sp
+}
+
+// Shutdown shuts the Exporter down.
+func (t *Tracer) Shutdown() error {
+	if !t.Enabled() {
+		return nil
+	}
+	return t.exp.Shutdown()
+}
+
+func (t *Tracer) export(sd SpanData) {
+	err := t.exp.Export([]SpanData{sd})
+	if err == nil {
+		return
+	}
+	// 只记录第一次导出失败 避免每个span都记录日志
+	t.mu.Lock()
+	logged := t.errLogged
+	t.errLogged = true
+	t.mu.Unlock()
+	if !logged {
+		mdl.Log().Warn("trace export failed", "service", t.service, "err", err)
+	}
+}
+
+// Default returns the Tracer of the process, disabled unless set by SetDefault.
+func Default() *Tracer {
+	dtmu.RLock()
+	defer dtmu.RUnlock()
+	return defaultTracer
+}
+
+// SetDefault replaces the Tracer of the process, nil disables the tracing.
+func SetDefault(t *Tracer) {
+	if t == nil {
+		t = NewTracer("", nil)
+	}
+	dtmu.Lock()
+	defer dtmu.Unlock()
+	defaultTracer = t
+}
+
+// Start starts a span on the Default Tracer, see Tracer.Start.
+func Start(ctx context.Context, name string, attrs ...any) (context.Context, *Span) {
+	return Default().Start(ctx, name, attrs...)
+}
+
+// Span is a span being recorded. The methods of a nil Span, returned by a disabled Tracer, do nothing.
+type Span struct {
+	t *Tracer
+
+	mu    *sync.Mutex // guards data ended
+	data  SpanData
+	ended bool
+}
+
+// SetAttrs sets the attributes given as key, value pairs, a key not a string is formatted.
+func (s *Span) SetAttrs(kv ...any) {
+	if s == nil || len(kv) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attrs == nil {
+		s.data.Attrs = make(map[string]any, len(kv)/2)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var v any = "(missing)"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		s.data.Attrs[key] = v
+	}
+}
+
+// SetKind sets the role of the span, KindInternal by default.
+func (s *Span) SetKind(k Kind) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = k
+}
+
+// SetError marks the span failed with err, a nil err or context.Canceled leaves it unchanged.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = StatusError
+	s.data.StatusMsg = err.Error()
+}
+
+// SetStatus sets the status of the span.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.StatusMsg = code, msg
+}
+
+// TraceID returns the trace id of the span, empty for a nil Span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+// SpanID returns the id of the span, empty for a nil Span.
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.SpanID
+}
+
+// End ends the span and exports it, only the first call does.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.t.clk.Now()
+	sd := s.data
+	sd.Attrs = maps.Clone(s.data.Attrs)
+	s.mu.Unlock()
+	s.t.export(sd)
+}
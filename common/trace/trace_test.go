@@ -0,0 +1,123 @@
+package trace_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mdl "common/model"
+	"common/model/clock"
+	"common/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	exp := trace.NewMemoryExporter()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tr := trace.NewTracer("gw", exp).WithClock(clk)
+
+	ctx, root := tr.Start(context.Background(), "command", "device", "lamp-1")
+	clk.Advance(time.Millisecond)
+	cctx, child := tr.Start(ctx, "actuate", "retries", 2)
+	carried, ok := mdl.TraceFromContext(cctx)
+	require.True(t, ok)
+	assert.Equal(t, mdl.Trace{TraceID: root.TraceID(), SpanID: child.SpanID()}, carried)
+	child.SetError(errors.New("timeout"))
+	clk.Advance(time.Millisecond)
+	child.End()
+	child.End() // only exported once
+	root.SetAttrs("ok", true)
+	root.End()
+
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, trace.SpanData{
+		Service:      "gw",
+		TraceID:      root.TraceID(),
+		SpanID:       child.SpanID(),
+		ParentSpanID: root.SpanID(),
+		Name:         "actuate",
+		Kind:         trace.KindInternal,
+		Start:        time.Unix(1700000000, 0).Add(time.Millisecond),
+		End:          time.Unix(1700000000, 0).Add(2 * time.Millisecond),
+		Attrs:        map[string]any{"retries": 2},
+		Status:       trace.StatusError,
+		StatusMsg:    "timeout",
+	}, spans[0])
+	assert.Empty(t, spans[1].ParentSpanID)
+	assert.Equal(t, 2*time.Millisecond, spans[1].Duration())
+	assert.Equal(t, map[string]any{"device": "lamp-1", "ok": true}, spans[1].Attrs)
+
+	// disabled, the context is kept and the span is a no-op
+	ctx = context.Background()
+	dctx, sp := trace.NewTracer("gw", nil).Start(ctx, "noop")
+	assert.Equal(t, ctx, dctx)
+	sp.SetAttrs("k", "v")
+	sp.End()
+	assert.Empty(t, sp.TraceID())
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	exp, err := trace.NewFileExporter(path)
+	require.NoError(t, err)
+	tr := trace.NewTracer("gw", exp)
+
+	ctx := mdl.ContextWithTrace(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	_, sp := tr.Start(ctx, "publish device.cmd", "topic", "device.cmd", "count", 3, "ratio", 0.5, "wait", time.Second)
+	sp.SetKind(trace.KindProducer)
+	sp.SetError(errors.New("no subscriber"))
+	sp.End()
+	_, sp = tr.Start(ctx, "deliver device.cmd")
+	sp.End()
+	require.NoError(t, tr.Shutdown())
+	assert.ErrorIs(t, exp.Export([]trace.SpanData{{}}), trace.ErrExporterShutdown)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	// the spans are written in a batch on Shutdown
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"gw"}}]},"scopeSpans":[{"scope":{"name":"common"},"spans":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"`)
+	assert.Contains(t, lines[0], `"parentSpanId":"00f067aa0ba902b7","name":"publish device.cmd","kind":4,"startTimeUnixNano":"`)
+	assert.Contains(t, lines[0], `"attributes":[{"key":"count","value":{"intValue":"3"}},{"key":"ratio","value":{"doubleValue":0.5}},{"key":"topic","value":{"stringValue":"device.cmd"}},{"key":"wait","value":{"stringValue":"1s"}}],"status":{"code":2,"message":"no subscriber"}}`)
+	assert.Contains(t, lines[0], `"name":"deliver device.cmd","kind":1`)
+}
+
+func TestBatchExporter(t *testing.T) {
+	mem := trace.NewMemoryExporter()
+	be := trace.NewBatchExporter(mem, trace.BatchConf{QueueSize: 4, BatchSize: 2, Interval: time.Hour})
+	tr := trace.NewTracer("gw", be)
+
+	_, sp := tr.Start(context.Background(), "a")
+	sp.End()
+	assert.Empty(t, mem.Spans())
+	// a full batch is exported at once
+	_, sp = tr.Start(context.Background(), "b")
+	sp.End()
+	assert.Eventually(t, func() bool { return len(mem.Spans()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// the spans beyond the queue are dropped
+	require.NoError(t, be.Export(make([]trace.SpanData, 6)))
+	assert.EqualValues(t, 2, be.Dropped())
+	require.NoError(t, be.Flush())
+	assert.Len(t, mem.Spans(), 6)
+
+	_, sp = tr.Start(context.Background(), "c")
+	sp.End()
+	require.NoError(t, tr.Shutdown())
+	assert.Len(t, mem.Named("c"), 1)
+	assert.ErrorIs(t, be.Export(make([]trace.SpanData, 1)), trace.ErrExporterShutdown)
+	assert.NoError(t, be.Shutdown())
+}